@@ -1,184 +1,129 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	_ "time/tzdata"
+
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
-	"github.com/joho/godotenv"
+	"github.com/kn9ka/fundbot-go/services/access"
 	"github.com/kn9ka/fundbot-go/services/alphaVantage"
+	"github.com/kn9ka/fundbot-go/services/bot"
+	"github.com/kn9ka/fundbot-go/services/categories"
+	"github.com/kn9ka/fundbot-go/services/config"
 	"github.com/kn9ka/fundbot-go/services/contact"
 	"github.com/kn9ka/fundbot-go/services/corona"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/services/queue"
+	"github.com/kn9ka/fundbot-go/services/scheduler"
 	"github.com/kn9ka/fundbot-go/services/sheets"
 	"github.com/kn9ka/fundbot-go/services/unistream"
-	"github.com/kn9ka/fundbot-go/services/utils"
-	"log"
-	"os"
-	"strconv"
-	"strings"
+	"github.com/kn9ka/fundbot-go/services/users"
 )
 
-func initialize(path string) {
-	if path == "" {
-		path = ".env-dev"
+func main() {
+	envPath := flag.String("env", config.DefaultEnvPath, "path to the dotenv file")
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "path to the optional YAML config file")
+	flag.Parse()
+
+	cfg, err := config.Load(*envPath, *configPath)
+	if err != nil {
+		log.Fatalf("Unable to load config: %v", err)
 	}
 
-	if err := godotenv.Load(path); err != nil {
-		log.Fatal("Error loading .env file")
+	location, err := cfg.Location()
+	if err != nil {
+		log.Fatalf("Unable to load timezone: %v", err)
 	}
-	log.Printf("%v config initialize!", path)
-}
 
-func main() {
-	initialize(".env")
-	tgApiKey := os.Getenv("BOT_TOKEN")
-	sheetsClient := sheets.NewService()
-
-	myCommands := map[string]tgbotapi.BotCommand{
-		"start": {Command: "/start", Description: "Список доступных команд"},
-		"list":  {Command: "/list", Description: "Список долгов"},
-		"rates": {Command: "/list", Description: "Курсы валют"},
+	sheetsClient, err := sheets.NewService(cfg.Sheets, location)
+	if err != nil {
+		log.Fatalf("Unable to connect to google sheets: %v", err)
+	}
+	columns, err := sheets.EnabledColumns(cfg.Sheets.ExtraColumns)
+	if err != nil {
+		log.Fatalf("Unable to enable sheet columns: %v", err)
 	}
+	httpClient := httpclient.New(cfg.Http)
+	officialRates := alphaVantage.NewService(cfg.AlphaVantage, httpClient, alphaVantage.ApiUrl)
 
-	bot, err := tgbotapi.NewBotAPI(tgApiKey)
+	pending, err := queue.New(filepath.Join(cfg.DataDir, "pending.json"), sheetsClient)
+	if err != nil {
+		log.Fatalf("Unable to load pending ledger entries: %v", err)
+	}
+
+	dictionary, err := categories.New(filepath.Join(cfg.DataDir, "categories.json"))
+	if err != nil {
+		log.Fatalf("Unable to load categories: %v", err)
+	}
+
+	schedules, err := scheduler.New(filepath.Join(cfg.DataDir, "schedules.json"), location)
+	if err != nil {
+		log.Fatalf("Unable to load schedules: %v", err)
+	}
+
+	allowlist, err := access.New(filepath.Join(cfg.DataDir, "access.json"), cfg.Access)
+	if err != nil {
+		log.Fatalf("Unable to load access lists: %v", err)
+	}
+	if !allowlist.Enabled() {
+		log.Printf("Access control is disabled, set ADMINS to restrict the bot")
+	}
+
+	registry, err := users.New(filepath.Join(cfg.DataDir, "users.json"))
+	if err != nil {
+		log.Fatalf("Unable to load users: %v", err)
+	}
+
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(cfg.BotToken, cfg.BotApiEndpoint)
 
 	if err != nil {
 		log.Fatalf(" Unable to create telegram bot: %v", err)
 	}
 
-	tgbotapi.NewSetMyCommands(myCommands["start"], myCommands["list"], myCommands["rates"])
-
-	updateConfig := tgbotapi.NewUpdate(0)
-	updateConfig.Timeout = 30
-	updates := bot.GetUpdatesChan(updateConfig)
-
-	// Let's go through each update that we're getting from Telegram.
-	for update := range updates {
-		msgId := update.Message.MessageID
-		chatId := update.Message.Chat.ID
-
-		// ignore all replies
-		if update.Message.ReplyToMessage != nil {
-			continue
-		}
-
-		if !update.Message.IsCommand() {
-			msgText := update.Message.Text
-			parts := strings.Split(msgText, " ")
-
-			var amount float64 = 0
-			if len(parts) >= 1 {
-				s := strings.Replace(parts[0], ",", ".", -1)
-				amount, _ = strconv.ParseFloat(s, 64)
-			} else {
-				continue
-			}
-
-			var reason = ""
-			if len(parts) >= 2 {
-				reason = strings.Join(parts[1:], " ")
-			}
-
-			values := [][]interface{}{
-				{
-					msgId,
-					amount,
-					reason,
-					"",
-					update.Message.Date,
-					update.Message.From.UserName,
-					true,
-				},
-			}
-
-			res := sheetsClient.Write(values)
-			msg := tgbotapi.NewMessage(chatId, "")
-
-			if res {
-				msg.Text = fmt.Sprintf("Сохранил: %.5f %s", amount, reason)
-			} else {
-				msg.Text = "При сохранении возникла ошибка"
-			}
-
-			if _, err := bot.Send(msg); err != nil {
-				log.Fatalf("Unable to send bot message from basic input: %v", err)
-			}
-			continue
-		}
-
-		currentBotCommand := update.Message.Command()
-		msg := tgbotapi.NewMessage(chatId, "")
-		typingMsg := tgbotapi.NewChatAction(chatId, tgbotapi.ChatTyping)
-
-		_, _ = bot.Send(typingMsg)
-
-		switch currentBotCommand {
-		case "start":
-			msg.Text = "/list - for list active debts \n/rates - for exchange RUB => USD/EUR/GEL rates"
-
-		case "rates":
-			currencies := []string{"USD", "GEL", "EUR"}
-			officialRates := alphaVantage.GetRates()
-			unistreamRates := unistream.GetRates()
-			coronaRates := corona.GetRates()
-			contactRates := contact.GetRates()
-
-			msg.ParseMode = "HTML"
-			msg.Text = ""
-
-			for _, currency := range currencies {
-				msg.Text += fmt.Sprintf("<b>[%s]</b>\n", currency)
-
-				if officialRate, ok := officialRates[currency]; ok {
-					msg.Text += fmt.Sprintf("  official rate: %s\n", utils.ConvertRate(officialRate))
-				}
-
-				if unistreamRate, ok := unistreamRates[currency]; ok {
-					msg.Text += fmt.Sprintf(
-						"  <a href='%s'>%s</a>: %s\n",
-						unistream.SiteUrl,
-						unistream.Name,
-						utils.ConvertRate(unistreamRate),
-					)
-				}
-
-				if coronaRate, ok := coronaRates[currency]; ok {
-					msg.Text += fmt.Sprintf(
-						"  <a href='%s'>%s</a>: %s\n",
-						corona.SiteUrl,
-						corona.Name,
-						utils.ConvertRate(coronaRate),
-					)
-				}
-
-				if contactRate, ok := contactRates[currency]; ok {
-					msg.Text += fmt.Sprintf(
-						"  <a href='%s'>%s</a>: %s\n",
-						contact.SiteUrl,
-						contact.Name,
-						utils.ConvertRate(contactRate),
-					)
-				}
-
-				msg.Text += "\n"
-			}
-
-		case "list":
-			exp := sheetsClient.LoadTotalByUsers(true)
-			str := "Ничего не найдено"
-
-			for _, row := range exp {
-				str = fmt.Sprintf("<b>@%s</b>: %.2f \n", row.Name, row.Total)
-			}
-
-			msg.ParseMode = "HTML"
-			msg.Text = str
-
-		default:
-			msg.ParseMode = "HTML"
-			msg.Text = "Unknown command, bro"
-		}
-
-		if _, err := bot.Send(msg); err != nil {
-			log.Fatalf("Unable to send bot message after command: %v", err)
-		}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go pending.Run(ctx)
+
+	b := bot.New(api, bot.Services{
+		Sheets:     sheetsClient,
+		Official:   officialRates,
+		Unistream:  unistream.NewService(httpClient, unistream.ApiUrl),
+		Corona:     corona.NewService(httpClient, corona.ApiUrl),
+		Contact:    contact.NewService(httpClient, contact.ApiUrl),
+		Queue:      pending,
+		Categories: dictionary,
+		Scheduler:  schedules,
+		Location:   location,
+		Access:     allowlist,
+		Users:      registry,
+		Columns:    columns,
+
+		UndoWindow:   cfg.UndoWindow,
+		FileEndpoint: cfg.BotFileEndpoint,
+
+		ConversationTimeout: cfg.ConversationTimeout,
+	})
+	if err := b.SetCommands(); err != nil {
+		log.Printf("Unable to publish bot commands: %v", err)
+	}
+	// rows written by usernames before ids were stored
+	b.MigrateUsers()
+	b.RunScheduler(ctx)
+	b.Run(ctx)
+	log.Println("Shutting down, waiting for in-flight updates...")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := b.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Unclean shutdown: %v", err)
 	}
+	log.Println("Bot stopped")
 }
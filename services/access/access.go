@@ -0,0 +1,183 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/kn9ka/fundbot-go/services/config"
+	"github.com/kn9ka/fundbot-go/services/store"
+)
+
+type Role string
+
+const (
+	// Chat is a group the bot works in.
+	Chat Role = "chat"
+	// User may use the bot in private chats.
+	User Role = "user"
+	// Admin may use the bot anywhere and manage the lists.
+	Admin Role = "admin"
+)
+
+// ErrConfigured is returned when removing an id listed in the configuration,
+// which can only be changed there.
+var ErrConfigured = errors.New("id is set in the configuration")
+
+// Member is an id holding a role.
+type Member struct {
+	Id int64
+	// Configured members come from the configuration and cannot be removed.
+	Configured bool
+}
+
+type state struct {
+	Chats  []int64 `json:"chats"`
+	Users  []int64 `json:"users"`
+	Admins []int64 `json:"admins"`
+}
+
+// List keeps the ids allowed to use the bot. The ones from the configuration
+// are always allowed, the ones added at runtime are stored on disk.
+type List struct {
+	mu         sync.Mutex
+	file       *store.File
+	state      state
+	configured map[Role]map[int64]bool
+	enabled    bool
+}
+
+func New(path string, cfg config.Access) (*List, error) {
+	l := &List{
+		file:    store.NewFile(path),
+		enabled: cfg.Enabled(),
+		configured: map[Role]map[int64]bool{
+			Chat:  set(cfg.Chats),
+			User:  set(cfg.Users),
+			Admin: set(cfg.Admins),
+		},
+	}
+	if err := l.file.Load(&l.state); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func set(ids []int64) map[int64]bool {
+	result := map[int64]bool{}
+	for _, id := range ids {
+		result[id] = true
+	}
+	return result
+}
+
+// Enabled reports whether access is restricted, everyone holds every role
+// otherwise.
+func (l *List) Enabled() bool {
+	return l.enabled
+}
+
+// Has reports whether id holds role. Admins are users as well.
+func (l *List) Has(role Role, id int64) bool {
+	if !l.enabled {
+		return true
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if role == User && l.has(Admin, id) {
+		return true
+	}
+	return l.has(role, id)
+}
+
+// has checks role without the implied ones, l.mu must be held.
+func (l *List) has(role Role, id int64) bool {
+	if l.configured[role][id] {
+		return true
+	}
+	for _, stored := range *l.stored(role) {
+		if stored == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Add gives id the role and reports whether it did not hold it yet.
+func (l *List) Add(role Role, id int64) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.configured[role]; !ok {
+		return false, fmt.Errorf("unknown role %q", role)
+	}
+	if l.has(role, id) {
+		return false, nil
+	}
+	ids := l.stored(role)
+	*ids = append(*ids, id)
+	if err := l.file.Save(l.state); err != nil {
+		*ids = (*ids)[:len(*ids)-1]
+		return false, err
+	}
+	return true, nil
+}
+
+// Remove takes the role from id and reports whether it held it.
+func (l *List) Remove(role Role, id int64) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.configured[role]; !ok {
+		return false, fmt.Errorf("unknown role %q", role)
+	}
+	if l.configured[role][id] {
+		return false, ErrConfigured
+	}
+	ids := l.stored(role)
+	for i, stored := range *ids {
+		if stored == id {
+			previous := append([]int64(nil), *ids...)
+			*ids = append((*ids)[:i], (*ids)[i+1:]...)
+			if err := l.file.Save(l.state); err != nil {
+				*ids = previous
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Members returns the ids holding role sorted by id.
+func (l *List) Members(role Role) []Member {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var members []Member
+	for id := range l.configured[role] {
+		members = append(members, Member{Id: id, Configured: true})
+	}
+	for _, id := range *l.stored(role) {
+		if !l.configured[role][id] {
+			members = append(members, Member{Id: id})
+		}
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].Id < members[j].Id })
+	return members
+}
+
+// stored returns the list of role kept on disk, l.mu must be held.
+func (l *List) stored(role Role) *[]int64 {
+	switch role {
+	case Chat:
+		return &l.state.Chats
+	case User:
+		return &l.state.Users
+	default:
+		return &l.state.Admins
+	}
+}
@@ -0,0 +1,69 @@
+package access_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/access"
+	"github.com/kn9ka/fundbot-go/services/config"
+)
+
+func TestDisabled(t *testing.T) {
+	l, err := access.New(filepath.Join(t.TempDir(), "access.json"), config.Access{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if l.Enabled() || !l.Has(access.Admin, 42) || !l.Has(access.Chat, -100) {
+		t.Errorf("empty configuration should allow everyone")
+	}
+}
+
+func TestList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.json")
+	l, err := access.New(path, config.Access{Admins: []int64{1}, Chats: []int64{-100}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if !l.Has(access.Admin, 1) || !l.Has(access.User, 1) {
+		t.Errorf("configured admin should be an admin and a user")
+	}
+	if l.Has(access.User, 2) || l.Has(access.Chat, -200) {
+		t.Errorf("unknown ids should not be allowed")
+	}
+
+	if added, err := l.Add(access.User, 2); !added || err != nil {
+		t.Errorf("Add() = %v, %v", added, err)
+	}
+	if added, err := l.Add(access.User, 2); added || err != nil {
+		t.Errorf("second Add() = %v, %v, want not added", added, err)
+	}
+	if _, err := l.Add(access.Role("owner"), 3); err == nil {
+		t.Errorf("Add() of an unknown role, want error")
+	}
+	if _, err := l.Remove(access.Chat, -100); !errors.Is(err, access.ErrConfigured) {
+		t.Errorf("Remove() of a configured chat error = %v, want ErrConfigured", err)
+	}
+
+	// runtime changes survive a restart
+	reloaded, err := access.New(path, config.Access{Admins: []int64{1}})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if !reloaded.Has(access.User, 2) {
+		t.Errorf("added user was not persisted")
+	}
+	want := []access.Member{{Id: 1, Configured: true}}
+	if got := reloaded.Members(access.Admin); !reflect.DeepEqual(got, want) {
+		t.Errorf("Members() = %+v, want %+v", got, want)
+	}
+
+	if removed, err := reloaded.Remove(access.User, 2); !removed || err != nil {
+		t.Errorf("Remove() = %v, %v", removed, err)
+	}
+	if reloaded.Has(access.User, 2) {
+		t.Errorf("removed user is still allowed")
+	}
+}
@@ -2,14 +2,15 @@ package alphaVantage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/kn9ka/fundbot-go/services/config"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/services/money"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
-	"os"
-	"strconv"
-	"strings"
 )
 
 const (
@@ -18,6 +19,11 @@ const (
 )
 
 type ResponseBody struct {
+	// the API answers 200 with one of these instead of the rate on errors
+	ErrorMessage string `json:"Error Message"`
+	Note         string `json:"Note"`
+	Information  string `json:"Information"`
+
 	RealtimeCurrencyExchangeRate struct {
 		FromCurrencyCode string `json:"1. From_Currency Code"`
 		FromCurrencyName string `json:"2. From_Currency Name"`
@@ -31,44 +37,70 @@ type ResponseBody struct {
 	} `json:"Realtime Currency Exchange Rate"`
 }
 
-func GetRates() map[string]string {
-	rates := map[string]string{}
+type Service struct {
+	apiKey string
+	apiUrl string
+	client *httpclient.Client
+}
+
+// NewService creates a provider calling apiUrl, which is ApiUrl in production.
+func NewService(cfg config.AlphaVantage, client *httpclient.Client, apiUrl string) *Service {
+	return &Service{
+		apiKey: cfg.ApiKey,
+		apiUrl: apiUrl,
+		client: client,
+	}
+}
+
+// GetRates returns the rates it managed to fetch along with the errors of the failed ones.
+func (s *Service) GetRates() (map[string]money.Rate, error) {
+	rates := map[string]money.Rate{}
+	var errs []error
 
-	if rubUsd, err := getRate("USD", "RUB"); err == nil {
+	if rubUsd, err := s.getRate("USD", "RUB"); err == nil {
 		rates["USD"] = rubUsd
+	} else {
+		errs = append(errs, err)
 	}
-	if rubEur, err := getRate("EUR", "RUB"); err == nil {
+	if rubEur, err := s.getRate("EUR", "RUB"); err == nil {
 		rates["EUR"] = rubEur
+	} else {
+		errs = append(errs, err)
 	}
-	if eurGel, err := getRate("EUR", "GEL"); err == nil {
-		rates["GEL"] = fmt.Sprintf("%.5f", parseFloat(rates["EUR"])/parseFloat(eurGel))
+	if eurGel, err := s.getRate("EUR", "GEL"); err != nil {
+		errs = append(errs, err)
+	} else if rubEur, ok := rates["EUR"]; ok {
+		if rubGel, err := rubEur.Cross(eurGel); err == nil {
+			rates["GEL"] = rubGel
+		} else {
+			errs = append(errs, err)
+		}
 	}
 
-	return rates
+	return rates, errors.Join(errs...)
 }
 
-func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
+func (s *Service) getRate(inCurrencyCode string, outCurrencyCode string) (money.Rate, error) {
 	params := url.Values{}
 	params.Add("function", Function)
 	params.Add("from_currency", inCurrencyCode)
 	params.Add("to_currency", outCurrencyCode)
-	params.Add("apikey", os.Getenv("ALPHA_VANTAGE_API_KEY"))
+	params.Add("apikey", s.apiKey)
 
-	req, err := http.NewRequest("GET", ApiUrl, nil)
+	req, err := http.NewRequest("GET", s.apiUrl, nil)
 
 	if err != nil {
 		log.Printf("Unable to create request: %v", err)
-		return "", err
+		return money.Rate{}, err
 	}
 
 	req.URL.RawQuery = params.Encode()
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 
 	if err != nil {
 		log.Printf("Unable to send request: %v", err)
-		return "", err
+		return money.Rate{}, err
 	}
 
 	defer func(Body io.ReadCloser) {
@@ -80,24 +112,26 @@ func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("failed to fetch exchange rate: %v", err)
-		return "", fmt.Errorf("failed to fetch exchange rate: %s", resp.Status)
+		return money.Rate{}, fmt.Errorf("failed to fetch exchange rate: %s", resp.Status)
 	}
 
 	var jsonResp ResponseBody
 	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
 		log.Printf("failed to decode response: %v", err)
-		return "", err
+		return money.Rate{}, err
 	}
 
-	return fmt.Sprintf("%s", jsonResp.RealtimeCurrencyExchangeRate.ExchangeRate), nil
-
-}
+	rate := jsonResp.RealtimeCurrencyExchangeRate.ExchangeRate
+	if rate == "" {
+		reason := jsonResp.ErrorMessage + jsonResp.Note + jsonResp.Information
+		log.Printf("no exchange rate in response: %s", reason)
+		return money.Rate{}, fmt.Errorf("no exchange rate for %s => %s: %s", inCurrencyCode, outCurrencyCode, reason)
+	}
 
-func parseFloat(str string) float64 {
-	amount, err := strconv.ParseFloat(strings.Replace(str, ",", ".", -1), 64)
+	value, err := money.Parse(rate)
 	if err != nil {
-		log.Printf("failed to parse float: %v", err)
-		return 0
+		log.Printf("failed to parse exchange rate: %v", err)
+		return money.Rate{}, fmt.Errorf("failed to parse exchange rate for %s => %s: %s", inCurrencyCode, outCurrencyCode, err)
 	}
-	return amount
+	return money.Rate{From: inCurrencyCode, To: outCurrencyCode, Value: value}, nil
 }
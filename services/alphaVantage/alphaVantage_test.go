@@ -0,0 +1,84 @@
+package alphaVantage_test
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/alphaVantage"
+	"github.com/kn9ka/fundbot-go/services/config"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/testing/fakes"
+)
+
+func newService(apiUrl string) *alphaVantage.Service {
+	return alphaVantage.NewService(config.AlphaVantage{ApiKey: "demo"}, fakes.NewHttpClient(), apiUrl)
+}
+
+func TestGetRatesRecorded(t *testing.T) {
+	server := fakes.NewAlphaVantage()
+	defer server.Close()
+
+	rates, err := newService(server.ApiUrl).GetRates()
+	if err != nil {
+		t.Fatalf("GetRates() error = %v", err)
+	}
+
+	want := map[string]string{"USD": "92.41", "EUR": "100.12", "GEL": "34.824348"}
+	for currency, rate := range want {
+		if got := rates[currency]; got.Value.String() != rate || got.From != currency || got.To != "RUB" {
+			t.Errorf("rates[%s] = %s, want %s in RUB", currency, got, rate)
+		}
+	}
+
+	for _, req := range server.Requests() {
+		if got := req.Query.Get("apikey"); got != "demo" {
+			t.Errorf("apikey = %q, want %q", got, "demo")
+		}
+	}
+}
+
+func TestGetRatesMissingApiKey(t *testing.T) {
+	server := fakes.NewAlphaVantage()
+	defer server.Close()
+
+	service := alphaVantage.NewService(config.AlphaVantage{}, fakes.NewHttpClient(), server.ApiUrl)
+	_, err := service.GetRates()
+	if err == nil || !strings.Contains(err.Error(), "apikey") {
+		t.Fatalf("GetRates() error = %v, want apikey error", err)
+	}
+}
+
+func TestGetRatesFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		scenario   fakes.Scenario
+		statusCode int
+	}{
+		{name: "rate limit note", scenario: fakes.Empty},
+		{name: "malformed body", scenario: fakes.Malformed},
+		{name: "server error", scenario: fakes.ServerError, statusCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakes.NewAlphaVantage()
+			defer server.Close()
+			server.SetScenario(tt.scenario)
+
+			rates, err := newService(server.ApiUrl).GetRates()
+			if err == nil {
+				t.Fatalf("GetRates() error = nil, rates = %v", rates)
+			}
+			if len(rates) != 0 {
+				t.Errorf("GetRates() rates = %v, want none", rates)
+			}
+
+			var statusErr *httpclient.StatusError
+			if tt.statusCode != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.statusCode) {
+				t.Errorf("GetRates() error = %v, want status %d", err, tt.statusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package bot
+
+import (
+	"log"
+	"regexp"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/conversation"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+// addFlowName is the flow of /add, see addFlow.
+const addFlowName = "add"
+
+// autoCategory is the category answer classifying the expense by its reason.
+const autoCategory = string(i18n.AutoCategoryAnswer)
+
+var (
+	currencyPattern = regexp.MustCompile(`^[A-Z]{3}$`)
+	usernamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+)
+
+// addFlow asks for an expense step by step, its steps are named after the
+// expense fields. Prompts, errors and options marked as keys are rendered
+// in the language of the user answering. Values of disabled ledger columns are
+// not asked for, they could not be saved.
+func (b *Bot) addFlow() conversation.Flow {
+	steps := []conversation.Step{{
+		Name:   "amount",
+		Prompt: string(i18n.AskAmount),
+		Parse:  parseAmountAnswer,
+	}}
+	if b.hasColumn("currency") {
+		steps = append(steps, conversation.Step{
+			Name:    "currency",
+			Prompt:  string(i18n.AskCurrency),
+			Options: func() []conversation.Option { return textOptions(append([]string{"RUB"}, rateCurrencies...)...) },
+			Parse:   parseCurrencyAnswer,
+		})
+	}
+	steps = append(steps,
+		conversation.Step{
+			Name:    "reason",
+			Prompt:  string(i18n.AskReason),
+			Options: func() []conversation.Option { return []conversation.Option{keyOption(i18n.SkipAnswer)} },
+			Parse: func(answer string) (string, error) {
+				if i18n.Is(answer, i18n.SkipAnswer) {
+					return "", nil
+				}
+				return answer, nil
+			},
+		},
+		conversation.Step{
+			Name:    "category",
+			Prompt:  string(i18n.AskCategory),
+			Options: b.categoryOptions,
+			Parse: func(answer string) (string, error) {
+				switch {
+				case i18n.Is(answer, i18n.SkipAnswer):
+					return "", nil
+				case i18n.Is(answer, i18n.AutoCategoryAnswer):
+					return autoCategory, nil
+				}
+				return b.categories.Canonical(strings.TrimPrefix(answer, "#")), nil
+			},
+		},
+	)
+	if b.hasColumn("participants") {
+		steps = append(steps, conversation.Step{
+			Name:    "participants",
+			Prompt:  string(i18n.AskParticipants),
+			Options: func() []conversation.Option { return []conversation.Option{keyOption(i18n.EveryoneAnswer)} },
+			Parse:   parseParticipantsAnswer,
+		})
+	}
+	return conversation.Flow{Name: addFlowName, Steps: steps}
+}
+
+// hasColumn reports whether the ledger column is enabled.
+func (b *Bot) hasColumn(name string) bool {
+	return b.columns == nil || b.columns[name]
+}
+
+// categoryOptions suggests classifying by the reason, the known categories
+// and no category at all. Category names are shown as the users gave them.
+func (b *Bot) categoryOptions() []conversation.Option {
+	options := []conversation.Option{keyOption(i18n.AutoCategoryAnswer)}
+	for _, category := range b.categories.Categories() {
+		options = append(options, textOptions(category.Name)...)
+	}
+	return append(options, keyOption(i18n.SkipAnswer))
+}
+
+func keyOption(key i18n.Key) conversation.Option {
+	return conversation.Option{Label: string(key), Key: true}
+}
+
+func textOptions(labels ...string) []conversation.Option {
+	options := make([]conversation.Option, len(labels))
+	for i, label := range labels {
+		options[i] = conversation.Option{Label: label}
+	}
+	return options
+}
+
+// answerError rejects an answer, the message under key is shown to the user.
+type answerError struct {
+	key i18n.Key
+}
+
+func (e answerError) Error() string {
+	return "invalid answer: " + string(e.key)
+}
+
+func parseAmountAnswer(answer string) (string, error) {
+	amount, err := money.Parse(answer)
+	if err != nil || amount.Sign() <= 0 {
+		return "", answerError{i18n.BadAmount}
+	}
+	return amount.String(), nil
+}
+
+func parseCurrencyAnswer(answer string) (string, error) {
+	currency := strings.ToUpper(answer)
+	if !currencyPattern.MatchString(currency) {
+		return "", answerError{i18n.BadCurrency}
+	}
+	return currency, nil
+}
+
+// parseParticipantsAnswer keeps the usernames separated by spaces, empty
+// for everyone.
+func parseParticipantsAnswer(answer string) (string, error) {
+	if i18n.Is(answer, i18n.EveryoneAnswer) {
+		return "", nil
+	}
+	var names []string
+	for _, name := range strings.FieldsFunc(answer, func(r rune) bool { return r == ' ' || r == ',' }) {
+		name = strings.TrimPrefix(name, "@")
+		if !usernamePattern.MatchString(name) {
+			return "", answerError{i18n.BadParticipants}
+		}
+		names = append(names, name)
+	}
+	return strings.Join(names, " "), nil
+}
+
+// finishAdd saves the expense answered in the add flow, message is the last
+// answer and gives the expense its id and date.
+func (b *Bot) finishAdd(message *tgbotapi.Message, values map[string]string) {
+	amount, err := money.Parse(values["amount"])
+	if err != nil {
+		log.Printf("Unable to parse amount %q of /add: %v", values["amount"], err)
+		return
+	}
+
+	category := values["category"]
+	if category == autoCategory {
+		category = b.categories.Classify(values["reason"])
+	}
+
+	b.saveExpense(message, sheets.Expense{
+		Id:           int64(message.MessageID),
+		Amount:       amount,
+		Reason:       values["reason"],
+		Date:         message.Time(),
+		Username:     message.From.UserName,
+		UserId:       message.From.ID,
+		ChatId:       message.Chat.ID,
+		Active:       true,
+		Category:     category,
+		Currency:     values["currency"],
+		Participants: strings.Fields(values["participants"]),
+	})
+}
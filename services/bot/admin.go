@@ -0,0 +1,195 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/access"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+)
+
+// allowed reports whether id holds role, everyone does without access
+// control.
+func (b *Bot) allowed(role access.Role, id int64) bool {
+	return b.access == nil || b.access.Has(role, id)
+}
+
+// permitted reports whether user may use the bot in chat: admins anywhere,
+// users in private chats and everyone in an allowed group.
+func (b *Bot) permitted(chat *tgbotapi.Chat, user *tgbotapi.User) bool {
+	if user != nil && b.allowed(access.Admin, user.ID) {
+		return true
+	}
+	if chat == nil || chat.IsPrivate() {
+		return user != nil && b.allowed(access.User, user.ID)
+	}
+	return b.allowed(access.Chat, chat.ID)
+}
+
+// authorize filters updates from unknown chats and users. It answers them
+// or leaves their group, and reports whether the update may be handled.
+func (b *Bot) authorize(update tgbotapi.Update) bool {
+	switch {
+	case update.MyChatMember != nil:
+		b.handleMembership(update.MyChatMember)
+		return false
+
+	case update.CallbackQuery != nil:
+		query := update.CallbackQuery
+		var chat *tgbotapi.Chat
+		if query.Message != nil {
+			chat = query.Message.Chat
+		}
+		if b.permitted(chat, query.From) {
+			return true
+		}
+		if _, err := b.api.Request(tgbotapi.NewCallback(query.ID, b.lang(query.From).T(i18n.NoAccess))); err != nil {
+			log.Printf("Unable to answer callback query: %v", err)
+		}
+		return false
+
+	case update.Message != nil:
+		message := update.Message
+		if b.permitted(message.Chat, message.From) {
+			return true
+		}
+		if !message.Chat.IsPrivate() {
+			b.leave(message.Chat.ID)
+			return false
+		}
+		if message.From != nil {
+			msg := tgbotapi.NewMessage(message.Chat.ID, b.lang(message.From).T(i18n.NoAccessId, message.From.ID))
+			if _, err := b.api.Send(msg); err != nil {
+				log.Printf("Unable to send bot message to unknown user: %v", err)
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// handleMembership keeps the bot in the groups it is added to by an admin,
+// which become allowed, and leaves the other ones.
+func (b *Bot) handleMembership(update *tgbotapi.ChatMemberUpdated) {
+	chat := update.Chat
+	status := update.NewChatMember.Status
+	if chat.IsPrivate() || (status != "member" && status != "administrator") || b.allowed(access.Chat, chat.ID) {
+		return
+	}
+
+	if b.allowed(access.Admin, update.From.ID) {
+		if _, err := b.access.Add(access.Chat, chat.ID); err != nil {
+			log.Printf("Unable to allow chat %d: %v", chat.ID, err)
+		} else {
+			log.Printf("Chat %d allowed by admin %d", chat.ID, update.From.ID)
+			return
+		}
+	}
+	b.leave(chat.ID)
+}
+
+func (b *Bot) leave(chatId int64) {
+	log.Printf("Leaving unauthorised chat %d", chatId)
+	if _, err := b.api.Request(tgbotapi.LeaveChatConfig{ChatID: chatId}); err != nil {
+		log.Printf("Unable to leave chat %d: %v", chatId, err)
+	}
+}
+
+// adminText manages the access lists, see adminUsage.
+func (b *Bot) adminText(tr i18n.Lang, message *tgbotapi.Message, args string) string {
+	if b.access == nil || !b.access.Enabled() {
+		return tr.T(i18n.AccessOpen)
+	}
+	if !b.allowed(access.Admin, message.From.ID) {
+		return tr.T(i18n.AdminOnly)
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 || fields[0] == "list" {
+		return b.accessText(tr)
+	}
+	if len(fields) < 2 || len(fields) > 3 || (fields[0] != "add" && fields[0] != "remove") {
+		return tr.T(i18n.AdminUsage)
+	}
+
+	role := access.Role(fields[1])
+	if role != access.Chat && role != access.User && role != access.Admin {
+		return tr.T(i18n.AdminUsage)
+	}
+	roleName := tr.T(roleNames[role])
+	var id int64
+	switch {
+	case len(fields) == 3:
+		var err error
+		if id, err = strconv.ParseInt(fields[2], 10, 64); err != nil {
+			return tr.T(i18n.AdminUsage)
+		}
+	case role == access.Chat:
+		id = message.Chat.ID
+	default:
+		return tr.T(i18n.AdminUsage)
+	}
+
+	if fields[0] == "add" {
+		added, err := b.access.Add(role, id)
+		if err != nil {
+			log.Printf("Unable to add %s %d: %v", role, id, err)
+			return tr.T(i18n.SaveLater)
+		}
+		if !added {
+			return tr.T(i18n.MemberExists, roleName, id)
+		}
+		return tr.T(i18n.MemberAdded, roleName, id)
+	}
+
+	removed, err := b.access.Remove(role, id)
+	if errors.Is(err, access.ErrConfigured) {
+		return tr.T(i18n.MemberConfigured, roleName, id)
+	}
+	if err != nil {
+		log.Printf("Unable to remove %s %d: %v", role, id, err)
+		return tr.T(i18n.SaveLater)
+	}
+	if !removed {
+		return tr.T(i18n.MemberMissing, roleName, id)
+	}
+	return tr.T(i18n.MemberRemoved, roleName, id)
+}
+
+var roleNames = map[access.Role]i18n.Key{
+	access.Chat:  i18n.RoleChat,
+	access.User:  i18n.RoleUser,
+	access.Admin: i18n.RoleAdmin,
+}
+
+// accessText lists the members of every role, the configured ones marked.
+func (b *Bot) accessText(tr i18n.Lang) string {
+	str := ""
+	for _, section := range []struct {
+		role  access.Role
+		title i18n.Key
+	}{
+		{access.Admin, i18n.AdminsTitle},
+		{access.User, i18n.UsersTitle},
+		{access.Chat, i18n.ChatsTitle},
+	} {
+		str += fmt.Sprintf("<b>%s</b>\n", tr.T(section.title))
+		members := b.access.Members(section.role)
+		if len(members) == 0 {
+			str += "—\n"
+		}
+		for _, member := range members {
+			str += strconv.FormatInt(member.Id, 10)
+			if member.Configured {
+				str += tr.T(i18n.ConfiguredMark)
+			}
+			str += "\n"
+		}
+		str += "\n"
+	}
+	return str + tr.T(i18n.AdminUsage)
+}
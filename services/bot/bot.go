@@ -0,0 +1,357 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/access"
+	"github.com/kn9ka/fundbot-go/services/alphaVantage"
+	"github.com/kn9ka/fundbot-go/services/callback"
+	"github.com/kn9ka/fundbot-go/services/categories"
+	"github.com/kn9ka/fundbot-go/services/contact"
+	"github.com/kn9ka/fundbot-go/services/conversation"
+	"github.com/kn9ka/fundbot-go/services/corona"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+	"github.com/kn9ka/fundbot-go/services/queue"
+	"github.com/kn9ka/fundbot-go/services/scheduler"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+	"github.com/kn9ka/fundbot-go/services/unistream"
+	"github.com/kn9ka/fundbot-go/services/users"
+)
+
+const (
+	pollTimeout = 30
+	retryDelay  = 3 * time.Second
+)
+
+// ShutdownFunc is called once the bot stopped processing updates,
+// e.g. to flush pending queues before the process exits.
+type ShutdownFunc func(ctx context.Context) error
+
+// Services are the dependencies the bot handlers work with.
+type Services struct {
+	Sheets    sheets.ISheetsAPI
+	Official  *alphaVantage.Service
+	Unistream *unistream.Service
+	Corona    *corona.Service
+	Contact   *contact.Service
+	// Queue keeps expenses the ledger failed to accept.
+	Queue *queue.Queue
+	// Categories classifies expenses by keywords of their reason.
+	Categories *categories.Dictionary
+	// Scheduler keeps the per-chat schedules of /schedule, see RunScheduler.
+	Scheduler *scheduler.Scheduler
+	// Location is the timezone periods such as /list month are counted in.
+	Location *time.Location
+	// Now is the clock periods and button deadlines are counted from,
+	// time.Now when nil.
+	Now func() time.Time
+	// UndoWindow is how long the button under a saved expense can undo it,
+	// there is no button when it is zero.
+	UndoWindow time.Duration
+	// FileEndpoint is the URL format to download files sent to the bot,
+	// tgbotapi.FileEndpoint by default.
+	FileEndpoint string
+	// ConversationTimeout is how long multi-step commands such as /add wait
+	// for the next answer, defaultConversationTimeout when zero.
+	ConversationTimeout time.Duration
+	// Access restricts the chats and users the bot works for, nil allows
+	// everyone.
+	Access *access.List
+	// Users keeps the Telegram users seen by the bot, rows are shown with
+	// their current username.
+	Users *users.Registry
+	// Columns are the enabled ledger columns, see sheets.EnabledColumns.
+	// Values of disabled columns are not asked for, every column is
+	// enabled when nil.
+	Columns []sheets.Column
+}
+
+type Bot struct {
+	api        *tgbotapi.BotAPI
+	sheets     sheets.ISheetsAPI
+	official   *alphaVantage.Service
+	unistream  *unistream.Service
+	corona     *corona.Service
+	contact    *contact.Service
+	queue      *queue.Queue
+	categories *categories.Dictionary
+	scheduler  *scheduler.Scheduler
+	location   *time.Location
+	now        func() time.Time
+	access     *access.List
+	users      *users.Registry
+	// columns are the names of the enabled ledger columns, nil when all are
+	columns map[string]bool
+
+	fileEndpoint  string
+	callbacks     *callback.Codec
+	undoWindow    time.Duration
+	importMu      sync.Mutex
+	imports       map[int64]pendingImport
+	conversations *conversation.Machine
+
+	mu     sync.Mutex
+	offset int
+
+	inFlight   sync.WaitGroup
+	onShutdown []ShutdownFunc
+}
+
+// commands are shown by Telegram clients in the command menu, described
+// in the language of the client.
+var commands = []struct {
+	Command     string
+	Description i18n.Key
+}{
+	{"/start", i18n.CmdStart},
+	{"/list", i18n.CmdList},
+	{"/add", i18n.CmdAdd},
+	{"/cancel", i18n.CmdCancel},
+	{"/rates", i18n.CmdRates},
+	{"/pending", i18n.CmdPending},
+	{"/report", i18n.CmdReport},
+	{"/categories", i18n.CmdCategories},
+	{"/schedule", i18n.CmdSchedule},
+	{"/export", i18n.CmdExport},
+	{"/import", i18n.CmdImport},
+	{"/receipt", i18n.CmdReceipt},
+	{"/doctor", i18n.CmdDoctor},
+	{"/admin", i18n.CmdAdmin},
+	{"/lang", i18n.CmdLang},
+}
+
+func botCommands(tr i18n.Lang) []tgbotapi.BotCommand {
+	result := make([]tgbotapi.BotCommand, 0, len(commands))
+	for _, command := range commands {
+		result = append(result, tgbotapi.BotCommand{Command: command.Command, Description: tr.T(command.Description)})
+	}
+	return result
+}
+
+// callbackHandler handles a press of an inline button made with Bot.button,
+// the returned text is shown to the user as a notification in tr.
+type callbackHandler func(b *Bot, tr i18n.Lang, query *tgbotapi.CallbackQuery, args []string) string
+
+// callbackHandlers are the inline button actions by name, kept short since
+// callback data is limited to 64 bytes.
+var callbackHandlers = map[string]callbackHandler{
+	undoAction:    (*Bot).undo,
+	ratesAction:   (*Bot).toggleRates,
+	settleAction:  (*Bot).settle,
+	receiptAction: (*Bot).confirmReceipt,
+	dismissAction: (*Bot).dismiss,
+}
+
+// New creates the bot core. api may point to any Bot API endpoint, see
+// tgbotapi.NewBotAPIWithAPIEndpoint.
+func New(api *tgbotapi.BotAPI, services Services) *Bot {
+	b := &Bot{
+		api:        api,
+		sheets:     services.Sheets,
+		official:   services.Official,
+		unistream:  services.Unistream,
+		corona:     services.Corona,
+		contact:    services.Contact,
+		queue:      services.Queue,
+		categories: services.Categories,
+		scheduler:  services.Scheduler,
+		location:   services.Location,
+		now:        services.Now,
+		access:     services.Access,
+		users:      services.Users,
+
+		fileEndpoint: services.FileEndpoint,
+		callbacks:    callback.NewCodec(api.Token),
+		undoWindow:   services.UndoWindow,
+		imports:      map[int64]pendingImport{},
+	}
+	if b.location == nil {
+		b.location = time.UTC
+	}
+	if b.now == nil {
+		b.now = time.Now
+	}
+	if b.fileEndpoint == "" {
+		b.fileEndpoint = tgbotapi.FileEndpoint
+	}
+	if services.Columns != nil {
+		b.columns = map[string]bool{}
+		for _, column := range services.Columns {
+			b.columns[column.Name] = true
+		}
+	}
+	timeout := services.ConversationTimeout
+	if timeout <= 0 {
+		timeout = defaultConversationTimeout
+	}
+	b.conversations = conversation.New(timeout, b.now, b.addFlow())
+	// entries that still fail stay on disk and are retried after a restart
+	b.OnShutdown(func(ctx context.Context) error {
+		if err := b.queue.Flush(ctx); err != nil {
+			return fmt.Errorf("%d pending ledger entries kept until next start: %w", len(b.queue.Pending()), err)
+		}
+		return nil
+	})
+
+	return b
+}
+
+// SetCommands publishes the command menu in every language, clients in
+// other languages get the default one.
+func (b *Bot) SetCommands() error {
+	if _, err := b.api.Request(tgbotapi.NewSetMyCommands(botCommands(i18n.Default)...)); err != nil {
+		return fmt.Errorf("failed to set bot commands: %s", err)
+	}
+	for _, lang := range i18n.Langs {
+		config := tgbotapi.NewSetMyCommandsWithScopeAndLanguage(tgbotapi.NewBotCommandScopeDefault(), string(lang), botCommands(lang)...)
+		if _, err := b.api.Request(config); err != nil {
+			return fmt.Errorf("failed to set %s bot commands: %s", lang, err)
+		}
+	}
+	return nil
+}
+
+// OnShutdown registers fn to be run by Shutdown after in-flight updates are drained.
+func (b *Bot) OnShutdown(fn ShutdownFunc) {
+	b.onShutdown = append(b.onShutdown, fn)
+}
+
+// Run receives and processes updates until ctx is cancelled. It returns as
+// soon as ctx is done, the update being handled at that moment is drained by
+// Shutdown.
+func (b *Bot) Run(ctx context.Context) {
+	b.inFlight.Add(1)
+	go func() {
+		defer b.inFlight.Done()
+		b.poll(ctx)
+	}()
+
+	<-ctx.Done()
+}
+
+// poll fetches updates in batches and processes them one by one. Updates are
+// only acknowledged after they were processed, so a batch that was fetched
+// but not handled is redelivered by Telegram after a restart.
+func (b *Bot) poll(ctx context.Context) {
+	for ctx.Err() == nil {
+		updates, err := b.fetch(ctx)
+		if err != nil {
+			log.Printf("Failed to get updates, retrying in %v: %v", retryDelay, err)
+			select {
+			case <-ctx.Done():
+			case <-time.After(retryDelay):
+			}
+			continue
+		}
+
+		for _, update := range updates {
+			if ctx.Err() != nil {
+				return
+			}
+			b.process(update)
+		}
+	}
+}
+
+// Shutdown waits for the update being handled to finish, runs the registered
+// shutdown hooks and acknowledges the last processed update. Run must have
+// been stopped by cancelling its context before calling Shutdown.
+func (b *Bot) Shutdown(ctx context.Context) error {
+	drained := make(chan struct{})
+	go func() {
+		b.inFlight.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		log.Printf("Shutdown deadline exceeded, in-flight updates may be redelivered")
+	}
+
+	var errs []error
+	for _, fn := range b.onShutdown {
+		if err := fn(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := b.ack(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to shutdown bot: %v", errs)
+	}
+	return nil
+}
+
+func (b *Bot) process(update tgbotapi.Update) {
+	b.handleUpdate(update)
+
+	b.mu.Lock()
+	b.offset = update.UpdateID + 1
+	b.mu.Unlock()
+}
+
+func (b *Bot) currentOffset() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.offset
+}
+
+// fetch long-polls Telegram for the updates following the last processed one.
+// The request is bound to ctx, so cancelling it aborts the long poll and no
+// getUpdates call is left running when ack sends its own.
+func (b *Bot) fetch(ctx context.Context) ([]tgbotapi.Update, error) {
+	config := tgbotapi.NewUpdate(b.currentOffset())
+	config.Timeout = pollTimeout
+
+	updates, err := b.apiWith(ctx).GetUpdates(config)
+	if ctx.Err() != nil {
+		return nil, nil
+	}
+	return updates, err
+}
+
+// apiWith returns a copy of the API client whose requests are cancelled
+// with ctx.
+func (b *Bot) apiWith(ctx context.Context) *tgbotapi.BotAPI {
+	api := *b.api
+	api.Client = contextClient{ctx: ctx, client: b.api.Client}
+	return &api
+}
+
+// contextClient sends every request with ctx, tgbotapi has no context
+// aware calls of its own.
+type contextClient struct {
+	ctx    context.Context
+	client tgbotapi.HTTPClient
+}
+
+func (c contextClient) Do(req *http.Request) (*http.Response, error) {
+	return c.client.Do(req.WithContext(c.ctx))
+}
+
+// ack confirms every processed update, Telegram forgets updates with an id
+// lower than the offset of the last getUpdates call.
+func (b *Bot) ack() error {
+	offset := b.currentOffset()
+	if offset == 0 {
+		return nil
+	}
+
+	config := tgbotapi.NewUpdate(offset)
+	config.Limit = 1
+	if _, err := b.api.Request(config); err != nil {
+		return fmt.Errorf("failed to acknowledge update offset %d: %s", offset, err)
+	}
+	log.Printf("Acknowledged updates up to offset %d", offset)
+	return nil
+}
@@ -0,0 +1,1228 @@
+package bot_test
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/access"
+	"github.com/kn9ka/fundbot-go/services/alphaVantage"
+	"github.com/kn9ka/fundbot-go/services/bot"
+	"github.com/kn9ka/fundbot-go/services/categories"
+	"github.com/kn9ka/fundbot-go/services/config"
+	"github.com/kn9ka/fundbot-go/services/contact"
+	"github.com/kn9ka/fundbot-go/services/corona"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/queue"
+	"github.com/kn9ka/fundbot-go/services/scheduler"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+	"github.com/kn9ka/fundbot-go/services/unistream"
+	"github.com/kn9ka/fundbot-go/services/users"
+	"github.com/kn9ka/fundbot-go/testing/fakes"
+	"google.golang.org/api/option"
+)
+
+const waitTimeout = 5 * time.Second
+
+var (
+	alice = tgbotapi.User{ID: 1001, FirstName: "Alice", UserName: "alice"}
+	bob   = tgbotapi.User{ID: 1002, FirstName: "Bob", UserName: "bob"}
+	// eve uses an English client
+	eve = tgbotapi.User{ID: 1004, FirstName: "Eve", UserName: "eve", LanguageCode: "en-GB"}
+)
+
+// clock is a manual time source for the bot.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+type harness struct {
+	telegram *fakes.Telegram
+	ledger   *fakes.Ledger
+	bot      *bot.Bot
+	stop     func()
+}
+
+// start runs the bot against fake services, options may change the
+// services before the bot is created.
+func start(t *testing.T, l *fakes.Ledger, options ...func(*bot.Services)) *harness {
+	t.Helper()
+
+	telegram := fakes.NewTelegram()
+	providers := []*fakes.Server{fakes.NewAlphaVantage(), fakes.NewUnistream(), fakes.NewCorona()}
+	contactServer := fakes.NewContact()
+	t.Cleanup(func() {
+		telegram.Close()
+		contactServer.Close()
+		for _, server := range providers {
+			server.Close()
+		}
+	})
+
+	api, err := tgbotapi.NewBotAPIWithAPIEndpoint(fakes.TelegramToken, telegram.Endpoint)
+	if err != nil {
+		t.Fatalf("NewBotAPIWithAPIEndpoint() error = %v", err)
+	}
+
+	pending, err := queue.New(filepath.Join(t.TempDir(), "pending.json"), l)
+	if err != nil {
+		t.Fatalf("queue.New() error = %v", err)
+	}
+
+	dictionary, err := categories.New(filepath.Join(t.TempDir(), "categories.json"))
+	if err != nil {
+		t.Fatalf("categories.New() error = %v", err)
+	}
+
+	schedules, err := scheduler.New(filepath.Join(t.TempDir(), "schedules.json"), time.UTC)
+	if err != nil {
+		t.Fatalf("scheduler.New() error = %v", err)
+	}
+
+	registry, err := users.New(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatalf("users.New() error = %v", err)
+	}
+
+	client := fakes.NewHttpClient()
+	services := bot.Services{
+		Sheets:     l,
+		Official:   alphaVantage.NewService(config.AlphaVantage{ApiKey: "demo"}, client, providers[0].ApiUrl),
+		Unistream:  unistream.NewService(client, providers[1].ApiUrl),
+		Corona:     corona.NewService(client, providers[2].ApiUrl),
+		Contact:    contact.NewService(client, contactServer.ApiUrl),
+		Queue:      pending,
+		Categories: dictionary,
+		Scheduler:  schedules,
+		Users:      registry,
+
+		UndoWindow:   time.Minute,
+		FileEndpoint: telegram.FileEndpoint,
+	}
+	for _, option := range options {
+		option(&services)
+	}
+	b := bot.New(api, services)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(done)
+	}()
+
+	h := &harness{telegram: telegram, ledger: l, bot: b}
+	var once sync.Once
+	h.stop = func() {
+		once.Do(func() {
+			cancel()
+			<-done
+			shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), waitTimeout)
+			defer cancelShutdown()
+			if err := b.Shutdown(shutdownCtx); err != nil {
+				t.Errorf("Shutdown() error = %v", err)
+			}
+		})
+	}
+	t.Cleanup(h.stop)
+
+	return h
+}
+
+// say sends text as from and returns the bot's reply.
+func (h *harness) say(t *testing.T, from tgbotapi.User, text string) string {
+	t.Helper()
+
+	n := len(h.telegram.Sent("sendMessage"))
+	h.telegram.SendMessage(from.ID, from, text)
+
+	sent, err := h.telegram.WaitSent("sendMessage", n+1, waitTimeout)
+	if err != nil {
+		t.Fatalf("no reply to %q: %v", text, err)
+	}
+	reply := sent[n]
+	if reply.ChatId() != from.ID {
+		t.Errorf("reply to %q sent to chat %d, want %d", text, reply.ChatId(), from.ID)
+	}
+	return reply.Text()
+}
+
+// press presses the button with text under the message sent by the bot and
+// returns the answer to the callback query.
+func (h *harness) press(t *testing.T, from tgbotapi.User, message fakes.Sent, text string) string {
+	t.Helper()
+
+	data, ok := message.Buttons()[text]
+	if !ok {
+		t.Fatalf("no button %q under %q, buttons = %v", text, message.Text(), message.Buttons())
+	}
+	return h.pressData(t, from, message, data)
+}
+
+func (h *harness) pressData(t *testing.T, from tgbotapi.User, message fakes.Sent, data string) string {
+	t.Helper()
+
+	n := len(h.telegram.Sent("answerCallbackQuery"))
+	h.telegram.PressButton(message.ChatId(), from, message.MessageId, data)
+
+	answers, err := h.telegram.WaitSent("answerCallbackQuery", n+1, waitTimeout)
+	if err != nil {
+		t.Fatalf("no answer to %q: %v", data, err)
+	}
+	return answers[n].Text()
+}
+
+// lastSent returns the last call to method.
+func (h *harness) lastSent(t *testing.T, method string) fakes.Sent {
+	t.Helper()
+
+	sent := h.telegram.Sent(method)
+	if len(sent) == 0 {
+		t.Fatalf("no %s calls", method)
+	}
+	return sent[len(sent)-1]
+}
+
+func TestCommands(t *testing.T) {
+	now := time.Date(2026, 9, 1, 0, 30, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		rows  [][]interface{}
+		from  tgbotapi.User
+		text  string
+		want  []string
+		avoid []string
+	}{
+		{
+			name: "start lists commands",
+			from: alice,
+			text: "/start",
+			want: []string{"/list", "/rates", "/pending"},
+		},
+		{
+			name: "list without expenses",
+			from: alice,
+			text: "/list",
+			want: []string{"Ничего не найдено"},
+		},
+		{
+			name: "list sums active expenses per user",
+			rows: [][]interface{}{
+				{1, 100.0, "taxi", "", 0, "alice", true},
+				{2, 50.5, "coffee", "", 0, "alice", true},
+				{3, 30.0, "lunch", "", 0, "bob", true},
+				{4, 999.0, "settled", "", 0, "bob", false},
+			},
+			from:  bob,
+			text:  "/list",
+			want:  []string{"<b>@alice</b>: 150,50 ₽", "<b>@bob</b>: 30,00 ₽"},
+			avoid: []string{"1 029,00"},
+		},
+		{
+			name: "list for the current month",
+			rows: [][]interface{}{
+				{1, 100.0, "taxi", "", now.Unix(), "alice", true},
+				{2, 70.0, "rent", "", now.AddDate(-1, 0, 0).Unix(), "alice", true},
+			},
+			from:  alice,
+			text:  "/list month",
+			want:  []string{"<b>За сентябрь 2026</b>", "<b>@alice</b>: 100,00 ₽"},
+			avoid: []string{"170,00"},
+		},
+		{
+			name: "list for a given month",
+			rows: [][]interface{}{
+				{1, 100.0, "taxi", "", time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC).Unix(), "alice", true},
+				{2, 70.0, "rent", "", time.Date(2026, 8, 31, 23, 0, 0, 0, time.UTC).Unix(), "bob", true},
+			},
+			from:  alice,
+			text:  "/list 2026-09",
+			want:  []string{"<b>За сентябрь 2026</b>", "<b>@alice</b>: 100,00 ₽"},
+			avoid: []string{"@bob"},
+		},
+		{
+			name: "list for a given month in english",
+			rows: [][]interface{}{
+				{1, 100.0, "taxi", "", time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC).Unix(), "alice", true},
+			},
+			from: eve,
+			text: "/list 2026-09",
+			want: []string{"<b>For September 2026</b>", "<b>@alice</b>: ₽100.00"},
+		},
+		{
+			name: "list with unknown period",
+			from: alice,
+			text: "/list someday",
+			want: []string{"Не понял период «someday»"},
+		},
+		{
+			name: "report by category",
+			rows: [][]interface{}{
+				{1, 300.0, "taxi", "", now.Unix(), "alice", true, "Транспорт"},
+				{2, 100.0, "bus", "", now.Unix(), "bob", false, "Транспорт"},
+				{3, 100.0, "gift", "", now.Unix(), "bob", true},
+				{4, 999.0, "rent", "", now.AddDate(-1, 0, 0).Unix(), "bob", true, "Жильё"},
+			},
+			from:  alice,
+			text:  "/report",
+			want:  []string{"Расходы за сентябрь 2026</b>: 500,00 ₽", "Транспорт: 400,00 ₽, 80%", "Без категории: 100,00 ₽, 20%"},
+			avoid: []string{"Жильё"},
+		},
+		{
+			name: "categories lists the dictionary",
+			from: alice,
+			text: "/categories",
+			want: []string{"<b>Транспорт</b>: ", "taxi", "/categories add"},
+		},
+		{
+			name:  "categories add without a name shows usage",
+			from:  alice,
+			text:  "/categories add",
+			want:  []string{"/categories add"},
+			avoid: []string{"<b>Транспорт</b>"},
+		},
+		{
+			name: "rates from every provider",
+			from: alice,
+			text: "/rates",
+			want: []string{
+				"<b>[USD]</b>", "<b>[GEL]</b>", "<b>[EUR]</b>",
+				"официальный курс: 92,41 ₽",
+				"Юнистрим</a>: 91,95 ₽",
+				"Золотая корона</a>: 92,83 ₽",
+				"Contact </a>: 93,15 ₽",
+			},
+		},
+		{
+			name: "doctor lists malformed rows",
+			rows: [][]interface{}{
+				{1, 100.0, "taxi", "", 0, "alice", true},
+				{2, "сто", "lunch", "", 0, "bob", true},
+				{3, "", "coffee", "", 0, "carol", true},
+			},
+			from: alice,
+			text: "/doctor",
+			want: []string{"строка 3, amount: некорректное значение «сто»", "строка 4, amount: пустое значение"},
+		},
+		{
+			name: "doctor without errors",
+			rows: [][]interface{}{{1, 100.0, "taxi", "", 0, "alice", true}},
+			from: alice,
+			text: "/doctor",
+			want: []string{"Ошибок в таблице не найдено"},
+		},
+		{
+			name: "unknown command",
+			from: alice,
+			text: "/unknown",
+			want: []string{"Неизвестная команда"},
+		},
+		{
+			name: "english client",
+			from: eve,
+			text: "/unknown",
+			want: []string{"Unknown command, see /start"},
+		},
+		{
+			name: "rates for an english client",
+			from: eve,
+			text: "/rates",
+			want: []string{"official rate: ₽92.41"},
+		},
+		{
+			name: "expense entry",
+			from: alice,
+			text: "250,5 taxi to airport",
+			want: []string{"Сохранил: 250,50 ₽ taxi to airport"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := start(t, fakes.NewLedger(tt.rows...), func(s *bot.Services) {
+				s.Now = func() time.Time { return now }
+			})
+
+			reply := h.say(t, tt.from, tt.text)
+			for _, want := range tt.want {
+				if !strings.Contains(reply, want) {
+					t.Errorf("reply to %q = %q, want it to contain %q", tt.text, reply, want)
+				}
+			}
+			for _, avoid := range tt.avoid {
+				if strings.Contains(reply, avoid) {
+					t.Errorf("reply to %q = %q, want it not to contain %q", tt.text, reply, avoid)
+				}
+			}
+		})
+	}
+}
+
+func TestExpenseIsWrittenToLedger(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+
+	h.say(t, alice, "120 groceries")
+	h.say(t, bob, "80")
+
+	expenses := h.ledger.LoadValues()
+	if len(expenses) != 2 {
+		t.Fatalf("ledger has %d expenses, want 2", len(expenses))
+	}
+	if e := expenses[0]; e.Amount.String() != "120" || e.Reason != "groceries" || e.Username != "alice" || !e.Active {
+		t.Errorf("first expense = %+v", e)
+	}
+	if e := expenses[1]; e.Amount.String() != "80" || e.Reason != "" || e.Username != "bob" {
+		t.Errorf("second expense = %+v", e)
+	}
+}
+
+func TestExpenseCategories(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+
+	reply := h.say(t, alice, "500 yandex taxi to airport")
+	if !strings.Contains(reply, "[Транспорт]") {
+		t.Errorf("reply = %q, want the detected category", reply)
+	}
+	h.say(t, alice, "200 flowers #подарки")
+	h.say(t, alice, "/categories add Подарки: цветы, flowers")
+	h.say(t, bob, "90 цветы маме")
+	h.say(t, bob, "40 такси #кафе")
+
+	var got []string
+	for _, e := range h.ledger.LoadValues() {
+		got = append(got, e.Reason+"="+e.Category)
+	}
+	want := []string{"yandex taxi to airport=Транспорт", "flowers=подарки", "цветы маме=Подарки", "такси=Кафе"}
+	if strings.Join(got, "; ") != strings.Join(want, "; ") {
+		t.Errorf("expenses = %v, want %v", got, want)
+	}
+
+	reply = h.say(t, bob, "/categories remove flowers")
+	if !strings.Contains(reply, "Удалил «flowers»") {
+		t.Errorf("reply = %q, want removal confirmation", reply)
+	}
+	reply = h.say(t, bob, "/categories")
+	if !strings.Contains(reply, "<b>Подарки</b>: цветы\n") {
+		t.Errorf("reply = %q, want the updated dictionary", reply)
+	}
+}
+
+func TestReportComparesPeriodsAndSendsChart(t *testing.T) {
+	september := time.Date(2026, 9, 10, 12, 0, 0, 0, time.UTC).Unix()
+	august := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC).Unix()
+	h := start(t, fakes.NewLedger(
+		[]interface{}{1, 300.0, "taxi", "", september, "alice", true, "Транспорт"},
+		[]interface{}{2, 150.0, "cinema", "", september, "bob", false, "Развлечения"},
+		[]interface{}{3, 200.0, "taxi", "", august, "alice", true, "Транспорт"},
+		[]interface{}{4, 100.0, "bus", "", august, "bob", true, "Транспорт"},
+	))
+
+	reply := h.say(t, alice, "/report 2026-09")
+	for _, want := range []string{
+		"<b>Расходы за сентябрь 2026</b>: 450,00 ₽ (+50% к август 2026: 300,00 ₽)",
+		"@alice: 300,00 ₽ (+50%)\n@bob: 150,00 ₽ (+50%)",
+		"Транспорт: 300,00 ₽, 67% (+0%)\nРазвлечения: 150,00 ₽, 33%\n",
+	} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply = %q, want it to contain %q", reply, want)
+		}
+	}
+
+	sent, err := h.telegram.WaitSent("sendPhoto", 1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(bytes.NewReader(sent[0].Files["photo"]))
+	if err != nil {
+		t.Fatalf("chart is not a PNG: %v", err)
+	}
+	if img.Bounds().Dx() == 0 || sent[0].ChatId() != alice.ID {
+		t.Errorf("chart of %v sent to %d", img.Bounds(), sent[0].ChatId())
+	}
+}
+
+func TestTotalsKeepCurrenciesApart(t *testing.T) {
+	september := time.Date(2026, 9, 10, 12, 0, 0, 0, time.UTC).Unix()
+	august := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC).Unix()
+	h := start(t, fakes.NewLedger(
+		[]interface{}{1, 300.0, "taxi", "", september, "alice", true, "Транспорт", "", "", "", "RUB"},
+		[]interface{}{2, 20.0, "taxi", "", september, "alice", true, "Транспорт", "", "", "", "usd"},
+		[]interface{}{3, 150.0, "cinema", "", september, "bob", true, "Развлечения"},
+		[]interface{}{4, 200.0, "taxi", "", august, "alice", true, "Транспорт"},
+	))
+
+	if reply := h.say(t, alice, "/list"); reply != "<b>@alice</b>: 500,00 ₽\n<b>@alice</b>: 20,00 $\n<b>@bob</b>: 150,00 ₽\n" {
+		t.Errorf("/list = %q, want a total per currency", reply)
+	}
+
+	reply := h.say(t, alice, "/report 2026-09")
+	for _, want := range []string{
+		"<b>Расходы за сентябрь 2026</b>: 450,00 ₽ + 20,00 $\n",
+		"@alice: 300,00 ₽ (+50%)\n@bob: 150,00 ₽\n@alice: 20,00 $\n",
+		"Транспорт: 300,00 ₽, 67% (+50%)\nРазвлечения: 150,00 ₽, 33%\nТранспорт: 20,00 $, 100%\n",
+	} {
+		if !strings.Contains(reply, want) {
+			t.Errorf("reply = %q, want it to contain %q", reply, want)
+		}
+	}
+
+	h.say(t, alice, "/list")
+	list := h.lastSent(t, "sendMessage")
+	if answer := h.press(t, alice, list, "Рассчитаться: @alice"); answer != "Рассчитались с @alice: 500,00 ₽ + 20,00 $" {
+		t.Errorf("answer to settle = %q", answer)
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	h := start(t, fakes.NewLedger(
+		[]interface{}{1, 1500.0, "rent", "", time.Now().Unix(), "alice", true},
+		[]interface{}{2, 300.0, "taxi", "", time.Now().Unix(), "bob", true},
+	))
+
+	reply := h.say(t, alice, "/schedule")
+	if !strings.HasPrefix(reply, "Расписаний пока нет") {
+		t.Errorf("reply = %q, want no schedules", reply)
+	}
+	reply = h.say(t, alice, "/schedule reminders 500 0 19 * * 5")
+	if !strings.HasPrefix(reply, "Добавил #1 напоминания о долгах от 500,00 ₽, <code>0 19 * * 5</code>") {
+		t.Errorf("reply = %q, want the added schedule", reply)
+	}
+	reply = h.say(t, alice, "/schedule reminders 300 @weekly")
+	if !strings.HasPrefix(reply, "Добавил #2 напоминания о долгах от 300,00 ₽, <code>@weekly</code>") {
+		t.Errorf("reply = %q, want the threshold before a named spec", reply)
+	}
+	h.say(t, alice, "/schedule remove 2")
+	reply = h.say(t, alice, "/schedule rates")
+	if !strings.HasPrefix(reply, "Добавил #3 курсы валют, <code>0 9 * * *</code>") {
+		t.Errorf("reply = %q, want the default cron expression", reply)
+	}
+	reply = h.say(t, alice, "/schedule rates 0 25 * * *")
+	if !strings.HasPrefix(reply, "Не получилось добавить расписание") {
+		t.Errorf("reply = %q, want an invalid spec error", reply)
+	}
+	reply = h.say(t, bob, "/schedule remove 3")
+	if reply != "Расписание #3 не найдено" {
+		t.Errorf("reply = %q, want schedules of other chats to be kept", reply)
+	}
+	reply = h.say(t, alice, "/schedule remove #3")
+	if reply != "Удалил расписание #3" {
+		t.Errorf("reply = %q, want removal confirmation", reply)
+	}
+	reply = h.say(t, alice, "/schedule")
+	if !strings.HasPrefix(reply, "#1 напоминания") || strings.Contains(reply, "#2") || strings.Contains(reply, "#3") {
+		t.Errorf("reply = %q, want only the reminders", reply)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	n := len(h.telegram.Sent("sendMessage"))
+	h.bot.RunJob(cancelled, scheduler.Schedule{Id: 1, ChatId: alice.ID, Job: scheduler.Reminders, Threshold: money.MustParse("500")})
+	if sent := h.telegram.Sent("sendMessage"); len(sent) != n {
+		t.Errorf("job with a cancelled context sent %q", sent[len(sent)-1].Text())
+	}
+
+	h.bot.RunJob(context.Background(), scheduler.Schedule{Id: 1, ChatId: alice.ID, Job: scheduler.Reminders, Threshold: money.MustParse("500")})
+	sent := h.telegram.Sent("sendMessage")
+	if got := sent[len(sent)-1]; got.ChatId() != alice.ID || got.Text() != "<b>Пора рассчитаться</b>, суммы от 500,00 ₽:\n@alice: 1 500,00 ₽\n" {
+		t.Errorf("reminder = %q sent to %d", got.Text(), got.ChatId())
+	}
+}
+
+func TestExport(t *testing.T) {
+	september := time.Date(2026, 9, 10, 12, 0, 0, 0, time.UTC).Unix()
+	august := time.Date(2026, 8, 10, 12, 0, 0, 0, time.UTC).Unix()
+	h := start(t, fakes.NewLedger(
+		[]interface{}{1, 300.0, "taxi", "", september, "alice", true, "Транспорт"},
+		[]interface{}{2, 200.0, "bus", "", august, "bob", false, "Транспорт"},
+		// written in the private chat of bob
+		[]interface{}{3, 50.0, "gift", "", september, "bob", true, "", bob.ID, bob.ID},
+	))
+
+	reply := h.say(t, alice, "/export xlsx 2026-09")
+	if reply != "Выгрузил записей за сентябрь 2026: 1" {
+		t.Errorf("reply = %q", reply)
+	}
+	h.say(t, alice, "/export")
+
+	sent, err := h.telegram.WaitSent("sendDocument", 2, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(sent[0].Files["document"], []byte("PK")) {
+		t.Errorf("xlsx export is not a zip archive")
+	}
+	want := "id,amount,reason,from,date,username,active,category,currency,participants,user_id\n" +
+		"1,300,taxi,,2026-09-10 12:00:00,alice,TRUE,Транспорт,,,1001\n" +
+		"2,200,bus,,2026-08-10 12:00:00,bob,FALSE,Транспорт,,,\n"
+	if got := string(sent[1].Files["document"]); got != want {
+		t.Errorf("csv export = %q, want %q", got, want)
+	}
+
+	h.say(t, bob, "/export")
+	sent, err = h.telegram.WaitSent("sendDocument", 3, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(sent[2].Files["document"]); !strings.Contains(got, "gift") {
+		t.Errorf("csv export of bob = %q, want the expense of that chat", got)
+	}
+
+	reply = h.say(t, alice, "/export 2020")
+	if reply != "Ничего не найдено" {
+		t.Errorf("reply = %q, want nothing found", reply)
+	}
+}
+
+func TestImport(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+
+	n := len(h.telegram.Sent("sendMessage"))
+	h.telegram.SendDocument(alice.ID, alice, "statement.csv", []byte("Дата;Сумма;Описание\n15.09.2026;1 200,50;такси домой\n16.09.2026;;кино\n"))
+	sent, err := h.telegram.WaitSent("sendMessage", n+1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	preview := sent[n].Text()
+	for _, want := range []string{
+		"<b>Импорт statement.csv</b>: записей 1 на 1 200,50 ₽\n15.09.2026 @alice 1 200,50 ₽ такси домой [Транспорт]\n",
+		"Пропущены строки с ошибками:\nстрока 3, amount: пустое значение\n",
+		"/import confirm",
+	} {
+		if !strings.Contains(preview, want) {
+			t.Errorf("preview = %q, want it to contain %q", preview, want)
+		}
+	}
+	if got := len(h.ledger.LoadValues()); got != 0 {
+		t.Fatalf("ledger has %d expenses before confirmation", got)
+	}
+
+	reply := h.say(t, bob, "/import confirm")
+	if !strings.HasPrefix(reply, "Нет загруженного файла") {
+		t.Errorf("reply = %q, want imports to be kept per chat", reply)
+	}
+	reply = h.say(t, alice, "/import confirm")
+	if reply != "Добавил записей из statement.csv: 1" {
+		t.Errorf("reply = %q, want import confirmation", reply)
+	}
+	expenses := h.ledger.LoadValues()
+	if len(expenses) != 1 || expenses[0].Id >= 0 || expenses[0].Amount.String() != "1200.5" || expenses[0].Username != "alice" || !expenses[0].Active || expenses[0].ChatId != alice.ID {
+		t.Errorf("ledger = %+v, want the imported expense", expenses)
+	}
+
+	reply = h.say(t, alice, "/import confirm")
+	if !strings.HasPrefix(reply, "Нет загруженного файла") {
+		t.Errorf("reply = %q, want the import to be done", reply)
+	}
+
+	n = len(h.telegram.Sent("sendMessage"))
+	h.telegram.SendDocument(alice.ID, alice, "notes.csv", []byte("date,reason\n2026-09-20,Dinner\n"))
+	sent, err = h.telegram.WaitSent("sendMessage", n+1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sent[n].Text(); !strings.HasPrefix(got, "В файле нет колонки с суммой") {
+		t.Errorf("preview = %q, want a missing amount error", got)
+	}
+}
+
+func TestUndoButton(t *testing.T) {
+	// same id and author as the first expense, e.g. a message in another chat
+	h := start(t, fakes.NewLedger([]interface{}{1, 100.0, "taxi", "", time.Now().Add(-time.Hour).Unix(), "alice", true}))
+
+	h.say(t, alice, "120 groceries")
+	first := h.lastSent(t, "sendMessage")
+	h.say(t, alice, "80 tea")
+	second := h.lastSent(t, "sendMessage")
+
+	if answer := h.press(t, alice, first, "Отменить"); answer != "Отменено" {
+		t.Errorf("answer = %q, want Отменено", answer)
+	}
+	edited := h.lastSent(t, "editMessageText")
+	if edited.MessageId != first.MessageId || edited.Text() != "Отменено: 120,00 ₽ groceries" || len(edited.Buttons()) != 0 {
+		t.Errorf("edited message %d to %q with %v", edited.MessageId, edited.Text(), edited.Buttons())
+	}
+
+	// the button is kept while the ledger is unavailable
+	h.ledger.SetDown(true)
+	markups := len(h.telegram.Sent("editMessageReplyMarkup"))
+	if answer := h.press(t, alice, second, "Отменить"); answer != "Не получилось отменить, попробуйте позже" {
+		t.Errorf("answer = %q, want a temporary failure", answer)
+	}
+	if got := len(h.telegram.Sent("editMessageReplyMarkup")); got != markups {
+		t.Errorf("buttons removed while the ledger is down")
+	}
+	h.ledger.SetDown(false)
+
+	if answer := h.press(t, alice, second, "Отменить"); answer != "Отменено" {
+		t.Errorf("answer = %q, want Отменено", answer)
+	}
+	expenses := h.ledger.LoadValues()
+	if len(expenses) != 1 || expenses[0].Reason != "taxi" {
+		t.Errorf("ledger = %+v, want only the expense from before", expenses)
+	}
+
+	if answer := h.press(t, alice, first, "Отменить"); answer != "Запись не найдена" {
+		t.Errorf("second answer = %q, want the expense to be gone", answer)
+	}
+}
+
+func TestUndoByAnotherUser(t *testing.T) {
+	allowlist, err := access.New(filepath.Join(t.TempDir(), "access.json"), config.Access{Admins: []int64{alice.ID}, Users: []int64{bob.ID}})
+	if err != nil {
+		t.Fatalf("access.New() error = %v", err)
+	}
+	h := start(t, fakes.NewLedger(), func(s *bot.Services) { s.Access = allowlist })
+
+	h.say(t, alice, "120 groceries")
+	groceries := h.lastSent(t, "sendMessage")
+	h.say(t, bob, "80 tea")
+	tea := h.lastSent(t, "sendMessage")
+
+	if answer := h.press(t, bob, groceries, "Отменить"); answer != "Отменить запись может только её автор или администратор" {
+		t.Errorf("answer to bob = %q, want only the author or an admin allowed", answer)
+	}
+	if answer := h.press(t, alice, tea, "Отменить"); answer != "Отменено" {
+		t.Errorf("answer to the admin = %q, want Отменено", answer)
+	}
+	if edited := h.lastSent(t, "editMessageText"); edited.Text() != "Отменено: 80,00 ₽ tea" {
+		t.Errorf("edited message = %q", edited.Text())
+	}
+	expenses := h.ledger.LoadValues()
+	if len(expenses) != 1 || expenses[0].Reason != "groceries" {
+		t.Errorf("ledger = %+v, want only the expense of alice", expenses)
+	}
+}
+
+func TestUndoButtonExpires(t *testing.T) {
+	h := start(t, fakes.NewLedger(), func(s *bot.Services) { s.UndoWindow = time.Millisecond })
+
+	h.say(t, alice, "120 groceries")
+	confirmation := h.lastSent(t, "sendMessage")
+	time.Sleep(10 * time.Millisecond)
+
+	if answer := h.press(t, alice, confirmation, "Отменить"); answer != "Время для отмены истекло" {
+		t.Errorf("answer = %q, want the button expired", answer)
+	}
+	if removed := h.lastSent(t, "editMessageReplyMarkup"); removed.MessageId != confirmation.MessageId || len(removed.Buttons()) != 0 {
+		t.Errorf("buttons of message %d = %v, want them removed", removed.MessageId, removed.Buttons())
+	}
+	if expenses := h.ledger.LoadValues(); len(expenses) != 1 {
+		t.Errorf("ledger = %+v, want the expense kept", expenses)
+	}
+}
+
+func TestForgedButtonIsRejected(t *testing.T) {
+	h := start(t, fakes.NewLedger([]interface{}{1, 100.0, "taxi", "", time.Now().Unix(), "alice", true}))
+
+	h.say(t, alice, "/list")
+	list := h.lastSent(t, "sendMessage")
+	data := list.Buttons()["Рассчитаться: @alice"]
+
+	// the button names the user by id in base 36
+	id := strconv.FormatInt(alice.ID, 36)
+	if !strings.Contains(data, id) {
+		t.Fatalf("button data %q does not name user %s", data, id)
+	}
+	forged := strings.Replace(data, id, strconv.FormatInt(bob.ID, 36), 1)
+	if answer := h.pressData(t, bob, list, forged); answer != "Кнопка устарела" {
+		t.Errorf("answer = %q, want the forged button rejected", answer)
+	}
+	if answer := h.pressData(t, bob, list, "garbage"); answer != "Кнопка устарела" {
+		t.Errorf("answer = %q, want malformed data rejected", answer)
+	}
+	if expenses := h.ledger.LoadValues(); !expenses[0].Active {
+		t.Errorf("ledger = %+v, want nothing settled", expenses)
+	}
+}
+
+func TestRatesButtons(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+
+	h.say(t, alice, "/rates")
+	rates := h.lastSent(t, "sendMessage")
+	for _, label := range []string{"✓ USD", "✓ GEL", "✓ EUR"} {
+		if _, ok := rates.Buttons()[label]; !ok {
+			t.Errorf("buttons = %v, want %q", rates.Buttons(), label)
+		}
+	}
+
+	h.press(t, alice, rates, "✓ USD")
+	edited := h.lastSent(t, "editMessageText")
+	if strings.Contains(edited.Text(), "[USD]") || !strings.Contains(edited.Text(), "[GEL]") {
+		t.Errorf("rates = %q, want USD hidden", edited.Text())
+	}
+
+	h.press(t, alice, edited, "✓ GEL")
+	edited = h.lastSent(t, "editMessageText")
+	if !strings.HasPrefix(edited.Text(), "<b>[EUR]</b>") || strings.Contains(edited.Text(), "[GEL]") {
+		t.Errorf("rates = %q, want only EUR", edited.Text())
+	}
+	if _, ok := edited.Buttons()["USD"]; !ok {
+		t.Errorf("buttons = %v, want USD unchecked", edited.Buttons())
+	}
+}
+
+func TestSettleButton(t *testing.T) {
+	h := start(t, fakes.NewLedger(
+		[]interface{}{1, 100.0, "taxi", "", time.Now().Unix(), "alice", true},
+		[]interface{}{2, 50.0, "tea", "", time.Now().Unix(), "alice", true},
+		[]interface{}{3, 30.0, "bus", "", time.Now().Unix(), "bob", true},
+	))
+
+	h.say(t, alice, "/list")
+	list := h.lastSent(t, "sendMessage")
+	if answer := h.press(t, alice, list, "Рассчитаться: @alice"); answer != "Рассчитались с @alice: 150,00 ₽" {
+		t.Errorf("answer = %q", answer)
+	}
+
+	edited := h.lastSent(t, "editMessageText")
+	if edited.Text() != "<b>@bob</b>: 30,00 ₽\n" {
+		t.Errorf("list = %q, want only bob left", edited.Text())
+	}
+	if _, ok := edited.Buttons()["Рассчитаться: @alice"]; ok || len(edited.Buttons()) != 1 {
+		t.Errorf("buttons = %v, want only bob's", edited.Buttons())
+	}
+}
+
+func TestExpenseIsQueuedWhileLedgerIsDown(t *testing.T) {
+	l := fakes.NewLedger()
+	l.SetDown(true)
+	h := start(t, l)
+
+	reply := h.say(t, alice, "300 dinner")
+	if !strings.Contains(reply, "сохранил локально") {
+		t.Errorf("reply = %q, want local save notice", reply)
+	}
+
+	reply = h.say(t, alice, "/pending")
+	if !strings.Contains(reply, "@alice: 300,00 ₽ dinner") {
+		t.Errorf("/pending reply = %q, want the queued expense", reply)
+	}
+
+	// the entry is synced on shutdown once the ledger is back
+	l.SetDown(false)
+	h.stop()
+	if expenses := l.LoadValues(); len(expenses) != 1 || expenses[0].Reason != "dinner" {
+		t.Errorf("ledger after shutdown = %+v, want the queued expense", expenses)
+	}
+}
+
+func TestShutdownAcknowledgesProcessedUpdates(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+
+	h.say(t, alice, "/start")
+	last := h.telegram.SendMessage(alice.ID, alice, "/list")
+	if _, err := h.telegram.WaitSent("sendMessage", 2, waitTimeout); err != nil {
+		t.Fatal(err)
+	}
+
+	// stop while the bot long-polls for the next update, the poll must not
+	// conflict with the acknowledgement
+	deadline := time.Now().Add(waitTimeout)
+	for h.telegram.Offset() != last+1 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	h.stop()
+
+	if got := h.telegram.Offset(); got != last+1 {
+		t.Errorf("acknowledged offset = %d, want %d", got, last+1)
+	}
+}
+
+func TestAddConversation(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+	// a category named like a message key is still shown by its name
+	h.say(t, alice, "/categories add help: справка")
+
+	if reply := h.say(t, alice, "/add"); reply != "Сколько потратили?" {
+		t.Errorf("first question = %q", reply)
+	}
+	if reply := h.say(t, alice, "abc"); !strings.HasPrefix(reply, "Не понял сумму") || !strings.HasSuffix(reply, "Сколько потратили?") {
+		t.Errorf("reply to a bad amount = %q, want the question again", reply)
+	}
+	if reply := h.say(t, alice, "1 250,5"); reply != "В какой валюте?" {
+		t.Errorf("second question = %q", reply)
+	}
+	if keyboard := h.lastSent(t, "sendMessage").Keyboard(); strings.Join(keyboard, " ") != "RUB USD GEL EUR Отмена" {
+		t.Errorf("currency keyboard = %v", keyboard)
+	}
+
+	// others in the chat are not part of the conversation
+	if reply := h.say(t, bob, "80 tea"); reply != "Сохранил: 80,00 ₽ tea" {
+		t.Errorf("reply to bob = %q, want a plain expense", reply)
+	}
+
+	h.say(t, alice, "usd")
+	if reply := h.say(t, alice, "такси в аэропорт"); reply != "Какая категория?" {
+		t.Errorf("category question = %q", reply)
+	}
+	if keyboard := strings.Join(h.lastSent(t, "sendMessage").Keyboard(), " "); !strings.HasPrefix(keyboard, "По описанию ") || !strings.Contains(keyboard, " Транспорт ") || !strings.Contains(keyboard, " help ") || !strings.HasSuffix(keyboard, " Пропустить Отмена") {
+		t.Errorf("category keyboard = %v", keyboard)
+	}
+	h.say(t, alice, "По описанию")
+	if reply := h.say(t, alice, "@bob, alice"); reply != "Сохранил: 1 250,50 $ такси в аэропорт [Транспорт] @bob @alice" {
+		t.Errorf("confirmation = %q", reply)
+	}
+	if buttons := h.lastSent(t, "sendMessage").Buttons(); len(buttons) != 1 {
+		t.Errorf("confirmation buttons = %v, want undo", buttons)
+	}
+
+	expenses := h.ledger.LoadValues()
+	if len(expenses) != 2 {
+		t.Fatalf("ledger = %+v, want 2 expenses", expenses)
+	}
+	e := expenses[1]
+	if e.Amount.String() != "1250.5" || e.Currency != "USD" || e.Category != "Транспорт" || e.Username != "alice" || strings.Join(e.Participants, " ") != "bob alice" {
+		t.Errorf("expense = %+v", e)
+	}
+
+	// the conversation is over, plain text is an expense again
+	if reply := h.say(t, alice, "50 pencils"); reply != "Сохранил: 50,00 ₽ pencils" {
+		t.Errorf("reply after the conversation = %q", reply)
+	}
+}
+
+func TestAddAsksOnlyForEnabledColumns(t *testing.T) {
+	columns, err := sheets.EnabledColumns(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := start(t, fakes.NewLedger(), func(s *bot.Services) { s.Columns = columns })
+
+	h.say(t, alice, "/add")
+	if reply := h.say(t, alice, "300"); reply != "На что?" {
+		t.Errorf("question after the amount = %q, want no currency", reply)
+	}
+	h.say(t, alice, "taxi")
+	if reply := h.say(t, alice, "Пропустить"); reply != "Сохранил: 300,00 ₽ taxi" {
+		t.Errorf("reply after the category = %q, want no participants", reply)
+	}
+}
+
+func TestAddConversationCancelAndTimeout(t *testing.T) {
+	c := &clock{now: time.Now()}
+	h := start(t, fakes.NewLedger(), func(s *bot.Services) {
+		s.ConversationTimeout = time.Minute
+		s.Now = c.Now
+	})
+
+	h.say(t, alice, "/add")
+	if reply := h.say(t, alice, "Отмена"); reply != "Отменил" {
+		t.Errorf("reply to cancel = %q", reply)
+	}
+	if reply := h.say(t, alice, "/cancel"); reply != "Нечего отменять" {
+		t.Errorf("reply to a second cancel = %q", reply)
+	}
+
+	h.say(t, alice, "/add")
+	c.advance(2 * time.Minute)
+	if reply := h.say(t, alice, "120 groceries"); reply != "Сохранил: 120,00 ₽ groceries" {
+		t.Errorf("reply after timeout = %q, want a plain expense", reply)
+	}
+	if expenses := h.ledger.LoadValues(); len(expenses) != 1 {
+		t.Errorf("ledger = %+v, want only the plain expense", expenses)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+
+	if reply := h.say(t, eve, "/add"); reply != "How much was spent?" {
+		t.Errorf("question to an english client = %q", reply)
+	}
+	if keyboard := h.lastSent(t, "sendMessage").Keyboard(); strings.Join(keyboard, " ") != "Cancel" {
+		t.Errorf("keyboard = %v", keyboard)
+	}
+	if reply := h.say(t, eve, "Cancel"); reply != "Cancelled" {
+		t.Errorf("reply to cancel = %q", reply)
+	}
+
+	if reply := h.say(t, alice, "/lang"); reply != "Язык: русский\nСменить: /lang ru или /lang en" {
+		t.Errorf("/lang = %q", reply)
+	}
+	if reply := h.say(t, alice, "/lang de"); !strings.HasPrefix(reply, "Язык: русский") {
+		t.Errorf("/lang de = %q, want the usage", reply)
+	}
+	if reply := h.say(t, alice, "/lang en"); reply != "I will answer in English" {
+		t.Errorf("/lang en = %q", reply)
+	}
+	if reply := h.say(t, alice, "50 pencils"); reply != "Saved: ₽50.00 pencils" {
+		t.Errorf("reply after /lang en = %q", reply)
+	}
+	if _, ok := h.lastSent(t, "sendMessage").Buttons()["Undo"]; !ok {
+		t.Errorf("buttons = %v, want Undo", h.lastSent(t, "sendMessage").Buttons())
+	}
+	h.say(t, alice, "1234.5 rent")
+	if reply := h.say(t, alice, "/list"); reply != "<b>@alice</b>: ₽1,284.50\n" {
+		t.Errorf("/list in English = %q", reply)
+	}
+
+	// the choice wins over the client
+	if reply := h.say(t, eve, "/lang ru"); reply != "Буду отвечать по-русски" {
+		t.Errorf("/lang ru = %q", reply)
+	}
+	if reply := h.say(t, eve, "/unknown"); !strings.HasPrefix(reply, "Неизвестная команда") {
+		t.Errorf("reply after /lang ru = %q", reply)
+	}
+	if reply := h.say(t, eve, "/lang auto"); reply != "I will answer in English" {
+		t.Errorf("/lang auto = %q, want the client language", reply)
+	}
+}
+
+func TestReceiptPhoto(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+
+	n := len(h.telegram.Sent("sendMessage"))
+	h.telegram.SendPhoto(alice.ID, alice, "", []byte("jpeg"))
+	h.telegram.SendPhoto(alice.ID, alice, "2300 groceries", []byte("jpeg"))
+	sent, err := h.telegram.WaitSent("sendMessage", n+2, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply := sent[n].Text(); !strings.HasPrefix(reply, "Добавьте к фото подпись") {
+		t.Errorf("reply to a photo without caption = %q", reply)
+	}
+	confirmation := sent[n+1].Text()
+	if !strings.HasPrefix(confirmation, "Сохранил: 2 300,00 ₽ groceries") || !strings.Contains(confirmation, "/receipt ") {
+		t.Fatalf("confirmation = %q, want the receipt command", confirmation)
+	}
+
+	expenses := h.ledger.LoadValues()
+	if len(expenses) != 1 || expenses[0].Receipt != "file-2" {
+		t.Fatalf("ledger = %+v, want the largest photo size as receipt", expenses)
+	}
+
+	command := confirmation[strings.Index(confirmation, "/receipt "):]
+	if reply := h.say(t, bob, command); !strings.HasSuffix(reply, "не найден") {
+		t.Errorf("reply to %s in another chat = %q, want the receipt not found", command, reply)
+	}
+	if reply := h.say(t, alice, command); !strings.HasPrefix(reply, "Чек к записи") {
+		t.Errorf("reply to %s = %q", command, reply)
+	}
+	photo, err := h.telegram.WaitSent("sendPhoto", 1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := photo[0].Params.Get("photo"); got != "file-2" {
+		t.Errorf("sent photo = %q, want the stored file id", got)
+	}
+
+	if reply := h.say(t, alice, "/receipt"); !strings.Contains(reply, command) {
+		t.Errorf("/receipt = %q, want the recent receipts", reply)
+	}
+	if reply := h.say(t, alice, "/receipt 999"); reply != "Чек к записи 999 не найден" {
+		t.Errorf("/receipt 999 = %q", reply)
+	}
+}
+
+func TestReceiptColumn(t *testing.T) {
+	for _, extra := range [][]string{nil, {"receipt"}} {
+		t.Run(strings.Join(append([]string{"columns"}, extra...), " "), func(t *testing.T) {
+			server := fakes.NewSheets()
+			t.Cleanup(server.Close)
+			cfg := config.Sheets{SpreadsheetId: fakes.SpreadsheetId, Worksheet: "1", ExtraColumns: extra}
+			service, err := sheets.NewServiceWithOptions(cfg, time.UTC, option.WithEndpoint(server.ApiUrl), option.WithoutAuthentication())
+			if err != nil {
+				t.Fatal(err)
+			}
+			columns, err := sheets.EnabledColumns(extra)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := start(t, fakes.NewLedger(), func(s *bot.Services) {
+				s.Sheets = service
+				s.Columns = columns
+			})
+
+			n := len(h.telegram.Sent("sendMessage"))
+			h.telegram.SendPhoto(alice.ID, alice, "2300 groceries", []byte("jpeg"))
+			sent, err := h.telegram.WaitSent("sendMessage", n+1, waitTimeout)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reply, expenses := sent[n].Text(), service.LoadValues()
+
+			if extra == nil {
+				if !strings.HasPrefix(reply, "Чеки не сохраняются") || len(expenses) != 0 {
+					t.Errorf("reply = %q, ledger = %+v, want the photo refused", reply, expenses)
+				}
+				if reply := h.say(t, alice, "/receipt"); !strings.HasPrefix(reply, "Чеки не сохраняются") {
+					t.Errorf("/receipt = %q, want receipts disabled", reply)
+				}
+				return
+			}
+			if !strings.Contains(reply, "/receipt ") || len(expenses) != 1 || expenses[0].Receipt == "" {
+				t.Errorf("reply = %q, ledger = %+v, want the expense with its receipt", reply, expenses)
+			}
+		})
+	}
+}
+
+func TestReceiptQRCode(t *testing.T) {
+	h := start(t, fakes.NewLedger())
+	photo, err := fakes.ReceiptPhoto("t=20260915T1345&s=2300.00&fn=9999078900004792&i=1&fp=2&n=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := len(h.telegram.Sent("sendMessage"))
+	h.telegram.SendPhoto(alice.ID, alice, "продукты", photo)
+	sent, err := h.telegram.WaitSent("sendMessage", n+1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proposal := sent[n]
+	if want := "Чек от 15.09.2026 13:45 на 2 300,00 ₽: продукты\nСохранить как расход?"; proposal.Text() != want {
+		t.Errorf("proposal = %q, want %q", proposal.Text(), want)
+	}
+
+	if answer := h.press(t, bob, proposal, "Сохранить"); answer != "Сохранить чек может только тот, кто его прислал" {
+		t.Errorf("answer to bob = %q", answer)
+	}
+	h.press(t, alice, proposal, "Сохранить")
+	edited := h.lastSent(t, "editMessageText")
+	if !strings.HasPrefix(edited.Text(), "Сохранил: 2 300,00 ₽ продукты") || len(edited.Buttons()) != 1 {
+		t.Errorf("edited proposal to %q with %v, want the confirmation with undo", edited.Text(), edited.Buttons())
+	}
+	// a second press that was sent before the buttons were removed
+	if answer := h.press(t, alice, proposal, "Сохранить"); answer != "Этот чек уже сохранён" {
+		t.Errorf("answer to a second press = %q", answer)
+	}
+
+	expenses := h.ledger.LoadValues()
+	if len(expenses) != 1 {
+		t.Fatalf("ledger = %+v, want the receipt", expenses)
+	}
+	e := expenses[0]
+	if e.Amount.String() != "2300" || e.Reason != "продукты" || e.Receipt != "file-1" || e.Username != "alice" ||
+		!e.Date.Equal(time.Date(2026, 9, 15, 13, 45, 0, 0, time.UTC)) {
+		t.Errorf("expense = %+v", e)
+	}
+
+	h.telegram.SendPhoto(alice.ID, alice, "", photo)
+	sent, err = h.telegram.WaitSent("sendMessage", n+2, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if answer := h.press(t, alice, sent[n+1], "Не сохранять"); answer != "Не сохранено" {
+		t.Errorf("answer to dismiss = %q", answer)
+	}
+	if expenses := h.ledger.LoadValues(); len(expenses) != 1 {
+		t.Errorf("ledger = %+v, want the dismissed receipt not saved", expenses)
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	allowlist, err := access.New(filepath.Join(t.TempDir(), "access.json"), config.Access{Admins: []int64{alice.ID}})
+	if err != nil {
+		t.Fatalf("access.New() error = %v", err)
+	}
+	h := start(t, fakes.NewLedger([]interface{}{1, 100.0, "taxi", "", 0, "alice", true}), func(s *bot.Services) { s.Access = allowlist })
+
+	if reply := h.say(t, bob, "80 tea"); reply != "Нет доступа. Передайте администратору ваш id: 1002" {
+		t.Errorf("reply to an unknown user = %q", reply)
+	}
+	if reply := h.say(t, bob, "/admin add user 1002"); reply != "Нет доступа. Передайте администратору ваш id: 1002" {
+		t.Errorf("reply to /admin of an unknown user = %q", reply)
+	}
+	if reply := h.say(t, alice, "/admin add user 1002"); reply != "Пользователь 1002 добавлен" {
+		t.Errorf("reply to /admin add = %q", reply)
+	}
+	if reply := h.say(t, bob, "80 tea"); reply != "Сохранил: 80,00 ₽ tea" {
+		t.Errorf("reply to an allowed user = %q", reply)
+	}
+	if reply := h.say(t, bob, "/admin"); reply != "Это может только администратор" {
+		t.Errorf("reply to /admin of a user = %q", reply)
+	}
+	if reply := h.say(t, alice, "/admin remove admin 1001"); !strings.Contains(reply, "задан в конфигурации") {
+		t.Errorf("reply to removing a configured admin = %q", reply)
+	}
+	if reply := h.say(t, alice, "/admin"); !strings.Contains(reply, "1001 (конфигурация)") || !strings.Contains(reply, "1002") {
+		t.Errorf("/admin = %q", reply)
+	}
+
+	// settling is up to admins
+	h.say(t, alice, "/list")
+	list := h.lastSent(t, "sendMessage")
+	if answer := h.press(t, bob, list, "Рассчитаться: @alice"); answer != "Это может только администратор" {
+		t.Errorf("answer to settle by a user = %q", answer)
+	}
+
+	// groups are left unless allowed, an admin adding the bot allows them
+	group := tgbotapi.Chat{ID: -100, Type: "group"}
+	h.telegram.Push(tgbotapi.Update{Message: &tgbotapi.Message{From: &bob, Chat: &group, Date: int(time.Now().Unix()), Text: "80 tea"}})
+	left, err := h.telegram.WaitSent("leaveChat", 1, waitTimeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chat := left[0].Params.Get("chat_id"); chat != "-100" {
+		t.Errorf("left chat %s, want -100", chat)
+	}
+
+	other := tgbotapi.Chat{ID: -200, Type: "supergroup"}
+	h.telegram.Push(tgbotapi.Update{MyChatMember: &tgbotapi.ChatMemberUpdated{
+		Chat: other, From: alice, Date: int(time.Now().Unix()),
+		NewChatMember: tgbotapi.ChatMember{User: &h.telegram.Bot, Status: "member"},
+	}})
+	n := len(h.telegram.Sent("sendMessage"))
+	h.telegram.Push(tgbotapi.Update{Message: &tgbotapi.Message{From: &bob, Chat: &other, Date: int(time.Now().Unix()), Text: "50 coffee"}})
+	if _, err := h.telegram.WaitSent("sendMessage", n+1, waitTimeout); err != nil {
+		t.Fatalf("no reply in the group added by an admin: %v", err)
+	}
+	if len(h.telegram.Sent("leaveChat")) != 1 {
+		t.Errorf("left the group added by an admin")
+	}
+	if !allowlist.Has(access.Chat, -200) {
+		t.Errorf("group added by an admin is not allowed")
+	}
+}
+
+func TestUsersAreKnownById(t *testing.T) {
+	h := start(t, fakes.NewLedger([]interface{}{1, 100.0, "taxi", "", time.Now().Unix(), "alice", true}))
+
+	// the rows alice wrote by username are hers once she is seen
+	h.say(t, alice, "50 tea")
+	for _, e := range h.ledger.LoadValues() {
+		if e.UserId != alice.ID {
+			t.Errorf("expense %d user id = %d, want %d", e.Id, e.UserId, alice.ID)
+		}
+	}
+
+	carol := tgbotapi.User{ID: 1003, FirstName: "Carol"}
+	h.say(t, carol, "30 bus")
+
+	renamed := alice
+	renamed.UserName = "alicia"
+	h.say(t, renamed, "/list")
+	list := h.lastSent(t, "sendMessage")
+	if want := "<b>@alicia</b>: 150,00 ₽\n<b>Carol</b>: 30,00 ₽\n"; list.Text() != want {
+		t.Errorf("list = %q, want %q", list.Text(), want)
+	}
+
+	if answer := h.press(t, renamed, list, "Рассчитаться: Carol"); answer != "Рассчитались с Carol: 30,00 ₽" {
+		t.Errorf("answer = %q", answer)
+	}
+	if edited := h.lastSent(t, "editMessageText"); edited.Text() != "<b>@alicia</b>: 150,00 ₽\n" {
+		t.Errorf("list = %q, want only alicia left", edited.Text())
+	}
+}
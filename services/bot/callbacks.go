@@ -0,0 +1,253 @@
+package bot
+
+import (
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/access"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+// Button actions, see callbackHandlers.
+const (
+	undoAction    = "u"
+	ratesAction   = "r"
+	settleAction  = "s"
+	receiptAction = "q"
+	dismissAction = "x"
+)
+
+// handleCallback runs the handler of a pressed button and answers the
+// query, so the client stops showing progress.
+func (b *Bot) handleCallback(query *tgbotapi.CallbackQuery) {
+	tr := b.lang(query.From)
+	text := tr.T(i18n.ExpiredButton)
+
+	data, err := b.callbacks.Decode(query.Data)
+	if err != nil {
+		log.Printf("Rejected callback data %q from %d: %v", query.Data, query.From.ID, err)
+	} else if handler, ok := callbackHandlers[data.Action]; ok && query.Message != nil {
+		text = handler(b, tr, query, data.Args)
+	}
+
+	if _, err := b.api.Request(tgbotapi.NewCallback(query.ID, text)); err != nil {
+		log.Printf("Unable to answer callback query: %v", err)
+	}
+}
+
+// button makes an inline button calling the handler of action with args.
+// It returns a row of one button, or none if the data does not fit into
+// a callback.
+func (b *Bot) button(text, action string, args ...string) []tgbotapi.InlineKeyboardButton {
+	data, err := b.callbacks.Encode(action, args...)
+	if err != nil {
+		log.Printf("Unable to create button %q: %v", text, err)
+		return nil
+	}
+	return []tgbotapi.InlineKeyboardButton{tgbotapi.NewInlineKeyboardButtonData(text, data)}
+}
+
+// keyboard skips empty rows, it is nil when no rows are left.
+func (b *Bot) keyboard(rows ...[]tgbotapi.InlineKeyboardButton) *tgbotapi.InlineKeyboardMarkup {
+	var kept [][]tgbotapi.InlineKeyboardButton
+	for _, row := range rows {
+		if len(row) > 0 {
+			kept = append(kept, row)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	markup := tgbotapi.NewInlineKeyboardMarkup(kept...)
+	return &markup
+}
+
+// edit replaces the text and buttons of a message sent by the bot.
+func (b *Bot) edit(message *tgbotapi.Message, text string, parseMode string, markup *tgbotapi.InlineKeyboardMarkup) {
+	edit := tgbotapi.NewEditMessageText(message.Chat.ID, message.MessageID, text)
+	edit.ParseMode = parseMode
+	edit.ReplyMarkup = markup
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("Unable to edit message %d: %v", message.MessageID, err)
+	}
+}
+
+// undoKeyboard has the button undoing the expense written to row, it works
+// for the author within the undo window. Numbers are in base 36 to fit into
+// the callback data.
+func (b *Bot) undoKeyboard(tr i18n.Lang, row int, expense sheets.Expense, author int64) *tgbotapi.InlineKeyboardMarkup {
+	if b.undoWindow <= 0 {
+		return nil
+	}
+	deadline := b.now().Add(b.undoWindow).Unix()
+	return b.keyboard(b.button(tr.T(i18n.UndoButton), undoAction,
+		strconv.FormatInt(int64(row), 36),
+		strconv.FormatInt(expense.Id, 36),
+		strconv.FormatInt(expense.Date.Unix(), 36),
+		strconv.FormatInt(author, 36),
+		strconv.FormatInt(deadline, 36),
+	))
+}
+
+// undo deletes the expense under its confirmation, args are the row it was
+// written to, its id and date, the id of the author and the unix time the
+// button expires at.
+func (b *Bot) undo(tr i18n.Lang, query *tgbotapi.CallbackQuery, args []string) string {
+	if len(args) != 5 {
+		return tr.T(i18n.ExpiredButton)
+	}
+	var numbers [5]int64
+	for i, arg := range args {
+		n, err := strconv.ParseInt(arg, 36, 64)
+		if err != nil {
+			return tr.T(i18n.ExpiredButton)
+		}
+		numbers[i] = n
+	}
+	row, id, date, author, deadline := int(numbers[0]), numbers[1], time.Unix(numbers[2], 0), numbers[3], numbers[4]
+
+	// admins may undo anyone's expense, like they settle anyone's debts
+	if query.From.ID != author && !b.allowed(access.Admin, query.From.ID) {
+		return tr.T(i18n.UndoNotAuthor)
+	}
+	if !b.now().Before(time.Unix(deadline, 0)) {
+		b.removeKeyboard(query.Message)
+		return tr.T(i18n.UndoExpired)
+	}
+
+	// the row is matched by the author of the expense, not whoever pressed
+	expense := sheets.Expense{Row: row, Id: id, Date: date, UserId: author}
+	if query.From.ID == author {
+		expense.Username = query.From.UserName
+	}
+	deleted, err := b.sheets.Delete(expense)
+	if err != nil {
+		log.Printf("Unable to undo expense %d: %v", id, err)
+		return tr.T(i18n.UndoFailed)
+	}
+	if !deleted {
+		b.removeKeyboard(query.Message)
+		return tr.T(i18n.ExpenseMissing)
+	}
+
+	// the confirmation was written in the language of the author, which may
+	// not be the one of an admin undoing it
+	text := query.Message.Text
+	for _, lang := range i18n.Langs {
+		text = strings.TrimPrefix(text, lang.T(i18n.Saved, ""))
+	}
+	b.edit(query.Message, tr.T(i18n.UndoneExpense, text), "", nil)
+	return tr.T(i18n.Undone)
+}
+
+// removeKeyboard removes the buttons under a message sent by the bot.
+func (b *Bot) removeKeyboard(message *tgbotapi.Message) {
+	edit := tgbotapi.NewEditMessageReplyMarkup(message.Chat.ID, message.MessageID, tgbotapi.InlineKeyboardMarkup{
+		InlineKeyboard: [][]tgbotapi.InlineKeyboardButton{},
+	})
+	if _, err := b.api.Send(edit); err != nil {
+		log.Printf("Unable to remove buttons of message %d: %v", message.MessageID, err)
+	}
+}
+
+// ratesKeyboard toggles the currencies shown by /rates, selected are the
+// shown ones, all of them when empty.
+func (b *Bot) ratesKeyboard(selected []string) *tgbotapi.InlineKeyboardMarkup {
+	shown := map[string]bool{}
+	for _, currency := range selected {
+		shown[currency] = true
+	}
+	if len(shown) == 0 {
+		for _, currency := range rateCurrencies {
+			shown[currency] = true
+		}
+	}
+
+	var row []tgbotapi.InlineKeyboardButton
+	for _, currency := range rateCurrencies {
+		var toggled []string
+		for _, other := range rateCurrencies {
+			if shown[other] != (other == currency) {
+				toggled = append(toggled, other)
+			}
+		}
+
+		label := currency
+		if shown[currency] {
+			label = "✓ " + currency
+		}
+		row = append(row, b.button(label, ratesAction, strings.Join(toggled, ","))...)
+	}
+	return b.keyboard(row)
+}
+
+// toggleRates shows the rates of the currencies in args[0].
+func (b *Bot) toggleRates(tr i18n.Lang, query *tgbotapi.CallbackQuery, args []string) string {
+	var selected []string
+	if len(args) == 1 {
+		for _, currency := range strings.Split(args[0], ",") {
+			for _, known := range rateCurrencies {
+				if currency == known {
+					selected = append(selected, currency)
+				}
+			}
+		}
+	}
+
+	b.edit(query.Message, b.ratesText(tr, selected), "HTML", b.ratesKeyboard(selected))
+	return ""
+}
+
+// settleKeyboard has a button for every user with active debts in /list.
+func (b *Bot) settleKeyboard(tr i18n.Lang) *tgbotapi.InlineKeyboardMarkup {
+	var rows [][]tgbotapi.InlineKeyboardButton
+	added := map[string]bool{}
+	for _, row := range b.sheets.LoadTotalByUsers(true) {
+		// a user with debts in several currencies gets one button
+		if arg := userArg(row.UserId, row.Name); row.Total.Sign() > 0 && !added[arg] {
+			added[arg] = true
+			rows = append(rows, b.button(tr.T(i18n.SettleButton, b.userLabel(row.UserId, row.Name)), settleAction, arg))
+		}
+	}
+	return b.keyboard(rows...)
+}
+
+// settle deactivates every active expense of the user in args[0].
+func (b *Bot) settle(tr i18n.Lang, query *tgbotapi.CallbackQuery, args []string) string {
+	if len(args) != 1 {
+		return tr.T(i18n.ExpiredButton)
+	}
+	userId, username, ok := parseUserArg(args[0])
+	if !ok {
+		return tr.T(i18n.ExpiredButton)
+	}
+	if !b.allowed(access.Admin, query.From.ID) {
+		return tr.T(i18n.AdminOnly)
+	}
+
+	var rows []int
+	var active []sheets.Expense
+	for _, e := range b.sheets.LoadValuesByUser(userId, username) {
+		if username == "" && e.Username != "" {
+			username = e.Username
+		}
+		if e.Active {
+			rows = append(rows, e.Row)
+			active = append(active, e)
+		}
+	}
+	if len(rows) == 0 {
+		return tr.T(i18n.NoActiveDebts, b.userLabel(userId, username))
+	}
+	if err := b.sheets.Deactivate(rows); err != nil {
+		log.Printf("Unable to settle debts of %s: %v", args[0], err)
+		return tr.T(i18n.SettleFailed)
+	}
+
+	b.edit(query.Message, b.listText(tr, ""), "HTML", b.settleKeyboard(tr))
+	return tr.T(i18n.Settled, b.userLabel(userId, username), amountsText(tr, sums(active)))
+}
@@ -0,0 +1,136 @@
+package bot
+
+import (
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/conversation"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+)
+
+const (
+	defaultConversationTimeout = 5 * time.Minute
+	// optionsPerRow is how many suggested answers share a keyboard row.
+	optionsPerRow = 3
+)
+
+// conversationKey keeps conversations of different users in a group apart.
+func conversationKey(message *tgbotapi.Message) conversation.Key {
+	return conversation.Key{ChatId: message.Chat.ID, UserId: message.From.ID}
+}
+
+func (b *Bot) inConversation(message *tgbotapi.Message) bool {
+	if message.From == nil {
+		return false
+	}
+	_, ok := b.conversations.Active(conversationKey(message))
+	return ok
+}
+
+// startConversation begins the flow and returns its first question.
+func (b *Bot) startConversation(tr i18n.Lang, message *tgbotapi.Message, flow string) (string, interface{}) {
+	step, err := b.conversations.Start(conversationKey(message), flow)
+	if err != nil {
+		log.Printf("Unable to start %s: %v", flow, err)
+		return tr.T(i18n.StartFailed), nil
+	}
+	return tr.T(i18n.Key(step.Prompt)), answerKeyboard(tr, step)
+}
+
+// cancelConversation ends the conversation of the author of message.
+func (b *Bot) cancelConversation(tr i18n.Lang, message *tgbotapi.Message) (string, interface{}) {
+	if !b.conversations.Cancel(conversationKey(message)) {
+		return tr.T(i18n.NothingToCancel), nil
+	}
+	return tr.T(i18n.Cancelled), tgbotapi.ReplyKeyboardRemove{RemoveKeyboard: true, Selective: true}
+}
+
+// handleAnswer passes the message to the conversation of its author and
+// asks the next question, or finishes the flow after the last one.
+func (b *Bot) handleAnswer(message *tgbotapi.Message) {
+	tr := b.lang(message.From)
+	msg := tgbotapi.NewMessage(message.Chat.ID, "")
+	msg.ReplyToMessageID = message.MessageID
+
+	answer := strings.TrimSpace(message.Text)
+	if i18n.Is(answer, i18n.CancelAnswer) {
+		msg.Text, msg.ReplyMarkup = b.cancelConversation(tr, message)
+	} else {
+		result, err := b.conversations.Answer(conversationKey(message), answer)
+		switch {
+		case err != nil && result.Next != nil:
+			msg.Text = answerErrorText(tr, err) + "\n\n" + tr.T(i18n.Key(result.Next.Prompt))
+			msg.ReplyMarkup = answerKeyboard(tr, *result.Next)
+		case err != nil:
+			// the conversation expired in the meantime
+			if message.ReplyToMessage == nil {
+				b.handleExpense(message)
+			}
+			return
+		case result.Done:
+			b.finishConversation(message, result)
+			return
+		default:
+			msg.Text = tr.T(i18n.Key(result.Next.Prompt))
+			msg.ReplyMarkup = answerKeyboard(tr, *result.Next)
+		}
+	}
+
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("Unable to send bot message in conversation: %v", err)
+	}
+}
+
+// answerErrorText explains in tr why an answer was rejected.
+func answerErrorText(tr i18n.Lang, err error) string {
+	var answerErr answerError
+	if errors.As(err, &answerErr) {
+		return tr.T(answerErr.key)
+	}
+	log.Printf("Unable to parse answer: %v", err)
+	return tr.T(i18n.BadAnswer)
+}
+
+// finishConversation acts on the answers of a completed flow.
+func (b *Bot) finishConversation(message *tgbotapi.Message, result conversation.Result) {
+	switch result.Flow {
+	case addFlowName:
+		b.finishAdd(message, result.Values)
+	default:
+		log.Printf("Unable to finish unknown flow %s", result.Flow)
+	}
+}
+
+// answerKeyboard suggests the options of step in tr, shown to the asked user
+// only since prompts reply to their message.
+func answerKeyboard(tr i18n.Lang, step conversation.Step) tgbotapi.ReplyKeyboardMarkup {
+	var options []conversation.Option
+	if step.Options != nil {
+		options = step.Options()
+	}
+
+	var rows [][]tgbotapi.KeyboardButton
+	for i := 0; i < len(options); i += optionsPerRow {
+		end := i + optionsPerRow
+		if end > len(options) {
+			end = len(options)
+		}
+		var row []tgbotapi.KeyboardButton
+		for _, option := range options[i:end] {
+			label := option.Label
+			if option.Key {
+				label = tr.T(i18n.Key(label))
+			}
+			row = append(row, tgbotapi.NewKeyboardButton(label))
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows, tgbotapi.NewKeyboardButtonRow(tgbotapi.NewKeyboardButton(tr.T(i18n.CancelAnswer))))
+
+	markup := tgbotapi.NewOneTimeReplyKeyboard(rows...)
+	markup.Selective = true
+	return markup
+}
@@ -0,0 +1,597 @@
+package bot
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"sort"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/categories"
+	"github.com/kn9ka/fundbot-go/services/chart"
+	"github.com/kn9ka/fundbot-go/services/contact"
+	"github.com/kn9ka/fundbot-go/services/corona"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/period"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+	"github.com/kn9ka/fundbot-go/services/unistream"
+	"github.com/kn9ka/fundbot-go/services/users"
+)
+
+func (b *Bot) handleUpdate(update tgbotapi.Update) {
+	if !b.authorize(update) {
+		return
+	}
+	b.observe(update)
+	if update.CallbackQuery != nil {
+		b.handleCallback(update.CallbackQuery)
+		return
+	}
+	if update.Message == nil {
+		return
+	}
+
+	if update.Message.Text != "" && !update.Message.IsCommand() && b.inConversation(update.Message) {
+		b.handleAnswer(update.Message)
+		return
+	}
+
+	// ignore all replies
+	if update.Message.ReplyToMessage != nil {
+		return
+	}
+
+	if update.Message.Document != nil {
+		b.handleDocument(update.Message)
+		return
+	}
+
+	if update.Message.Photo != nil {
+		b.handlePhoto(update.Message)
+		return
+	}
+
+	if !update.Message.IsCommand() {
+		b.handleExpense(update.Message)
+		return
+	}
+
+	b.handleCommand(update.Message)
+}
+
+func (b *Bot) handleExpense(message *tgbotapi.Message) {
+	b.saveExpense(message, b.parseExpense(message, message.Text))
+}
+
+// parseExpense reads "amount reason #category" sent in message.
+func (b *Bot) parseExpense(message *tgbotapi.Message, text string) sheets.Expense {
+	text, tags := categories.ParseTags(text)
+	parts := strings.Split(text, " ")
+
+	var amount money.Decimal
+	if len(parts) >= 1 {
+		amount, _ = money.Parse(parts[0])
+	}
+
+	var reason = ""
+	if len(parts) >= 2 {
+		reason = strings.Join(parts[1:], " ")
+	}
+
+	category := b.categories.Classify(reason)
+	if len(tags) > 0 {
+		category = b.categories.Canonical(tags[0])
+	}
+
+	return sheets.Expense{
+		Id:       int64(message.MessageID),
+		Amount:   amount,
+		Reason:   reason,
+		Date:     message.Time(),
+		Username: message.From.UserName,
+		UserId:   message.From.ID,
+		ChatId:   message.Chat.ID,
+		Active:   true,
+		Category: category,
+	}
+}
+
+// saveExpense writes the expense and confirms it with an undo button, or
+// queues it when the ledger is unavailable.
+func (b *Bot) saveExpense(message *tgbotapi.Message, expense sheets.Expense) {
+	msg := tgbotapi.NewMessage(message.Chat.ID, "")
+	msg.Text, msg.ReplyMarkup = b.writeExpense(b.lang(message.From), message.Chat.ID, expense, message.From.ID)
+
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("Unable to send bot message from basic input: %v", err)
+	}
+}
+
+// writeExpense writes the expense of author sent in chatId and returns the
+// confirmation with its undo button.
+func (b *Bot) writeExpense(tr i18n.Lang, chatId int64, expense sheets.Expense, author int64) (string, *tgbotapi.InlineKeyboardMarkup) {
+	expenses := []sheets.Expense{expense}
+
+	rows, err := b.sheets.Append(expenses)
+	if err != nil {
+		log.Printf("Unable to write expense: %v", err)
+	}
+	summary := amountText(tr, expense.Amount, expense.Currency) + " " + expense.Reason
+	if expense.Category != "" {
+		summary += fmt.Sprintf(" [%s]", expense.Category)
+	}
+	if len(expense.Participants) > 0 {
+		summary += " @" + strings.Join(expense.Participants, " @")
+	}
+
+	if err == nil {
+		text := tr.T(i18n.Saved, summary)
+		if expense.Receipt != "" {
+			text += tr.T(i18n.SavedReceipt, expense.Id)
+		}
+		var markup *tgbotapi.InlineKeyboardMarkup
+		if len(rows) == 1 {
+			markup = b.undoKeyboard(tr, rows[0], expense, author)
+		}
+		return text, markup
+	}
+	if err := b.queue.Push(chatId, expenses, fmt.Sprintf("%s: %s", users.User{Id: expense.UserId, Username: expense.Username}.Label(), summary)); err != nil {
+		log.Printf("Unable to queue expense: %v", err)
+		return tr.T(i18n.SaveError), nil
+	}
+	return tr.T(i18n.Queued, summary), nil
+}
+
+func (b *Bot) handleCommand(message *tgbotapi.Message) {
+	chatId := message.Chat.ID
+	tr := b.lang(message.From)
+	msg := tgbotapi.NewMessage(chatId, "")
+	typingMsg := tgbotapi.NewChatAction(chatId, tgbotapi.ChatTyping)
+
+	_, _ = b.api.Send(typingMsg)
+
+	// photo and document are sent after the text, e.g. the chart of /report
+	var photo tgbotapi.RequestFileData
+	var document *tgbotapi.FileBytes
+
+	switch message.Command() {
+	case "start":
+		msg.Text = tr.T(i18n.Help)
+
+	case "add":
+		msg.Text, msg.ReplyMarkup = b.startConversation(tr, message, addFlowName)
+		msg.ReplyToMessageID = message.MessageID
+
+	case "cancel":
+		msg.Text, msg.ReplyMarkup = b.cancelConversation(tr, message)
+
+	case "rates":
+		msg.ParseMode = "HTML"
+		msg.Text = b.ratesText(tr, nil)
+		msg.ReplyMarkup = b.ratesKeyboard(nil)
+
+	case "schedule":
+		msg.ParseMode = "HTML"
+		msg.Text = b.scheduleText(tr, chatId, message.CommandArguments())
+
+	case "export":
+		msg.ParseMode = "HTML"
+		msg.Text, document = b.export(tr, message, message.CommandArguments())
+
+	case "import":
+		msg.ParseMode = "HTML"
+		msg.Text = b.importText(tr, message, message.CommandArguments())
+
+	case "receipt":
+		msg.ParseMode = "HTML"
+		msg.Text, photo = b.receipt(tr, message, message.CommandArguments())
+
+	case "admin":
+		msg.ParseMode = "HTML"
+		msg.Text = b.adminText(tr, message, message.CommandArguments())
+
+	case "lang":
+		msg.Text = b.langText(message, message.CommandArguments())
+
+	case "pending":
+		msg.Text = b.pendingText(tr, chatId)
+
+	case "doctor":
+		msg.Text = b.doctorText(tr)
+
+	case "list":
+		msg.ParseMode = "HTML"
+		msg.Text = b.listText(tr, message.CommandArguments())
+		if strings.TrimSpace(message.CommandArguments()) == "" {
+			msg.ReplyMarkup = b.settleKeyboard(tr)
+		}
+
+	case "report":
+		msg.ParseMode = "HTML"
+		var chart []byte
+		msg.Text, chart = b.report(tr, message.CommandArguments())
+		if chart != nil {
+			photo = tgbotapi.FileBytes{Name: message.Command() + ".png", Bytes: chart}
+		}
+
+	case "categories":
+		msg.ParseMode = "HTML"
+		msg.Text = b.categoriesText(tr, message.CommandArguments())
+
+	default:
+		msg.ParseMode = "HTML"
+		msg.Text = tr.T(i18n.UnknownCommand)
+	}
+
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("Unable to send bot message after command: %v", err)
+	}
+
+	if photo != nil {
+		if _, err := b.api.Send(tgbotapi.NewPhoto(chatId, photo)); err != nil {
+			log.Printf("Unable to send photo after command: %v", err)
+		}
+	}
+	if document != nil {
+		if _, err := b.api.Send(tgbotapi.NewDocument(chatId, *document)); err != nil {
+			log.Printf("Unable to send document after command: %v", err)
+		}
+	}
+}
+
+// listText sums active expenses per user, within a period when arg names one.
+func (b *Bot) listText(tr i18n.Lang, arg string) string {
+	var exp []sheets.AmountByUser
+	str := ""
+
+	if strings.TrimSpace(arg) == "" {
+		exp = b.sheets.LoadTotalByUsers(true)
+	} else {
+		p, err := period.Parse(arg, b.now().In(b.location))
+		if err != nil {
+			return periodErrorText(tr, arg)
+		}
+		exp = sheets.TotalByUsers(sheets.FilterByPeriod(b.sheets.LoadValues(), p), true)
+		str = tr.T(i18n.ListTitle, periodLabel(tr, p))
+	}
+	labels := make(map[sheets.AmountByUser]string, len(exp))
+	for _, row := range exp {
+		labels[row] = html.EscapeString(b.userLabel(row.UserId, row.Name))
+	}
+	sort.Slice(exp, func(i, j int) bool {
+		if labels[exp[i]] != labels[exp[j]] {
+			return labels[exp[i]] < labels[exp[j]]
+		}
+		return exp[i].Currency < exp[j].Currency
+	})
+
+	header := str
+
+	for _, row := range exp {
+		str += fmt.Sprintf("<b>%s</b>: %s\n", labels[row], amountText(tr, row.Total, row.Currency))
+	}
+	if str == header {
+		str += tr.T(i18n.NothingFound)
+	}
+
+	return str
+}
+
+// rateCurrencies are shown by /rates.
+var rateCurrencies = []string{"USD", "GEL", "EUR"}
+
+// ratesText lists the rates of every provider for currencies, all of
+// rateCurrencies when empty.
+func (b *Bot) ratesText(tr i18n.Lang, currencies []string) string {
+	if len(currencies) == 0 {
+		currencies = rateCurrencies
+	}
+	officialRates, officialErr := b.official.GetRates()
+	unistreamRates, unistreamErr := b.unistream.GetRates()
+	coronaRates, coronaErr := b.corona.GetRates()
+	contactRates, contactErr := b.contact.GetRates()
+
+	text := ""
+
+	for _, currency := range currencies {
+		text += fmt.Sprintf("<b>[%s]</b>\n", currency)
+
+		if officialRate, ok := officialRates[currency]; ok {
+			text += fmt.Sprintf("  %s: %s\n", tr.T(i18n.OfficialRate), rateText(tr, officialRate))
+		}
+
+		if unistreamRate, ok := unistreamRates[currency]; ok {
+			text += fmt.Sprintf(
+				"  <a href='%s'>%s</a>: %s\n",
+				unistream.SiteUrl,
+				unistream.Name,
+				rateText(tr, unistreamRate),
+			)
+		}
+
+		if coronaRate, ok := coronaRates[currency]; ok {
+			text += fmt.Sprintf(
+				"  <a href='%s'>%s</a>: %s\n",
+				corona.SiteUrl,
+				corona.Name,
+				rateText(tr, coronaRate),
+			)
+		}
+
+		if contactRate, ok := contactRates[currency]; ok {
+			text += fmt.Sprintf(
+				"  <a href='%s'>%s</a>: %s\n",
+				contact.SiteUrl,
+				contact.Name,
+				rateText(tr, contactRate),
+			)
+		}
+
+		text += "\n"
+	}
+
+	text += unavailableText(tr, map[string]error{
+		tr.T(i18n.OfficialRate): officialErr,
+		unistream.Name:          unistreamErr,
+		corona.Name:             coronaErr,
+		contact.Name:            contactErr,
+	})
+	return text
+}
+
+func periodErrorText(tr i18n.Lang, arg string) string {
+	return tr.T(i18n.PeriodError, html.EscapeString(arg))
+}
+
+// report sums the expenses of a period, the current month by default, per
+// user and per category and compares them with the previous period. The
+// chart is nil when there is nothing to draw.
+func (b *Bot) report(tr i18n.Lang, arg string) (string, []byte) {
+	if strings.TrimSpace(arg) == "" {
+		arg = "month"
+	}
+	p, err := period.Parse(arg, b.now().In(b.location))
+	if err != nil {
+		return periodErrorText(tr, arg), nil
+	}
+	previousPeriod := p.Previous()
+	label, previousLabel := periodLabel(tr, p), periodLabel(tr, previousPeriod)
+
+	all := b.sheets.LoadValues()
+	expenses := sheets.FilterByPeriod(all, p)
+	previous := sheets.FilterByPeriod(all, previousPeriod)
+	if len(expenses) == 0 {
+		return tr.T(i18n.ListTitle, label) + tr.T(i18n.NothingFound), nil
+	}
+
+	// amounts are only compared within a currency
+	totals, previousTotals := sums(expenses), sums(previous)
+	text := tr.T(i18n.ReportTitle, label, amountsText(tr, totals))
+	if len(totals) == 1 && len(previousTotals) == 1 && totals[0].Currency == previousTotals[0].Currency && !previousTotals[0].Value.IsZero() {
+		text += tr.T(i18n.ReportPrevious, trend(totals[0].Value, previousTotals[0].Value), previousLabel, amountText(tr, previousTotals[0].Value, previousTotals[0].Currency))
+	}
+
+	type group struct{ name, currency string }
+	previousByUser := map[group]money.Decimal{}
+	for _, row := range sheets.TotalByUsers(previous, false) {
+		previousByUser[group{userArg(row.UserId, strings.ToLower(row.Name)), row.Currency}] = row.Total
+	}
+	byUser := sheets.TotalByUsers(expenses, false)
+	sort.Slice(byUser, func(i, j int) bool {
+		if byUser[i].Currency != byUser[j].Currency {
+			return byUser[i].Currency < byUser[j].Currency
+		}
+		return byUser[i].Total.Cmp(byUser[j].Total) > 0
+	})
+
+	text += tr.T(i18n.ReportByUser)
+	for _, row := range byUser {
+		previousTotal := previousByUser[group{userArg(row.UserId, strings.ToLower(row.Name)), row.Currency}]
+		text += fmt.Sprintf("%s: %s%s\n", html.EscapeString(b.userLabel(row.UserId, row.Name)), amountText(tr, row.Total, row.Currency), trendSuffix(row.Total, previousTotal))
+	}
+
+	previousByCategory := map[group]money.Decimal{}
+	for _, row := range sheets.TotalByCategories(previous) {
+		previousByCategory[group{row.Name, row.Currency}] = row.Total
+	}
+
+	// the chart has a single scale, it shows the first currency only
+	charted := totals[0]
+	var bars []chart.Bar
+	text += tr.T(i18n.ReportByCategory)
+	for _, row := range sheets.TotalByCategories(expenses) {
+		name := row.Name
+		if name == "" {
+			name = tr.T(i18n.NoCategory)
+		}
+		previousTotal := previousByCategory[group{row.Name, row.Currency}]
+		text += fmt.Sprintf(
+			"%s: %s, %.0f%%%s\n",
+			html.EscapeString(name), amountText(tr, row.Total, row.Currency), share(row.Total, totalIn(totals, row.Currency)), trendSuffix(row.Total, previousTotal),
+		)
+		if row.Currency == charted.Currency {
+			bars = append(bars, chart.Bar{Label: name, Amount: amountText(tr, row.Total, row.Currency), Value: row.Total.Float64(), Previous: previousTotal.Float64()})
+		}
+	}
+
+	png, err := chart.Render(chart.Chart{
+		Title:    tr.T(i18n.ChartTitle, label, tr.Locale().Amount(charted)),
+		Current:  label,
+		Previous: previousLabel,
+		Bars:     bars,
+	})
+	if err != nil {
+		log.Printf("Unable to render report chart: %v", err)
+		return text, nil
+	}
+	return text, png
+}
+
+// sums totals expenses per currency, the ledger currency first.
+func sums(expenses []sheets.Expense) []money.Amount {
+	var totals []money.Amount
+	for _, expense := range expenses {
+		currency := sheets.CurrencyOf(expense)
+		i := sort.Search(len(totals), func(i int) bool { return totals[i].Currency >= currency })
+		if i == len(totals) || totals[i].Currency != currency {
+			totals = append(totals[:i], append([]money.Amount{{Currency: currency}}, totals[i:]...)...)
+		}
+		totals[i].Value = totals[i].Value.Add(expense.Amount)
+	}
+	return totals
+}
+
+// totalIn finds the total in currency among totals, zero when missing.
+func totalIn(totals []money.Amount, currency string) money.Decimal {
+	for _, total := range totals {
+		if total.Currency == currency {
+			return total.Value
+		}
+	}
+	return money.Decimal{}
+}
+
+// share is the percentage of total value makes.
+func share(value, total money.Decimal) float64 {
+	if total.IsZero() {
+		return 0
+	}
+	return value.Float64() / total.Float64() * 100
+}
+
+// trend is the relative change from previous to current, e.g. "+12%".
+func trend(current, previous money.Decimal) string {
+	return fmt.Sprintf("%+.0f%%", current.Sub(previous).Float64()/previous.Float64()*100)
+}
+
+func trendSuffix(current, previous money.Decimal) string {
+	if previous.IsZero() {
+		return ""
+	}
+	return " (" + trend(current, previous) + ")"
+}
+
+// categoriesText lists the dictionary or changes it, args are
+// "add <category>: <keywords>" or "remove <keyword or category>".
+func (b *Bot) categoriesText(tr i18n.Lang, args string) string {
+	action, rest := args, ""
+	if i := strings.IndexAny(args, " \n"); i >= 0 {
+		action, rest = args[:i], strings.TrimSpace(args[i+1:])
+	}
+
+	switch strings.ToLower(action) {
+	case "":
+		text := ""
+		for _, category := range b.categories.Categories() {
+			text += fmt.Sprintf("<b>%s</b>: %s\n", html.EscapeString(category.Name), html.EscapeString(strings.Join(category.Keywords, ", ")))
+		}
+		if text == "" {
+			text = tr.T(i18n.NoCategories)
+		}
+		return text + "\n" + tr.T(i18n.CategoriesUsage)
+
+	case "add":
+		name, keywords := rest, ""
+		if i := strings.Index(rest, ":"); i >= 0 {
+			name, keywords = rest[:i], rest[i+1:]
+		} else if i := strings.Index(rest, " "); i >= 0 {
+			name, keywords = rest[:i], rest[i+1:]
+		}
+		words := strings.FieldsFunc(keywords, func(r rune) bool { return r == ',' || r == ' ' })
+		if strings.TrimSpace(name) == "" {
+			return tr.T(i18n.CategoriesUsage)
+		}
+
+		if err := b.categories.Add(name, words); err != nil {
+			log.Printf("Unable to add category: %v", err)
+			return tr.T(i18n.SaveError)
+		}
+		return tr.T(i18n.CategoryAdded, html.EscapeString(b.categories.Canonical(name)), html.EscapeString(strings.Join(words, ", ")))
+
+	case "remove":
+		removed, err := b.categories.Remove(rest)
+		if err != nil {
+			log.Printf("Unable to remove category: %v", err)
+			return tr.T(i18n.SaveError)
+		}
+		if !removed {
+			return tr.T(i18n.NotFound, html.EscapeString(rest))
+		}
+		return tr.T(i18n.Deleted, html.EscapeString(rest))
+	}
+
+	return tr.T(i18n.CategoriesUsage)
+}
+
+func (b *Bot) pendingText(tr i18n.Lang, chatId int64) string {
+	entries := b.queue.PendingIn(chatId)
+	if len(entries) == 0 {
+		return tr.T(i18n.AllSynced)
+	}
+
+	text := tr.T(i18n.PendingTitle, len(entries))
+	for _, entry := range entries {
+		text += tr.T(
+			i18n.PendingLine,
+			entry.Summary,
+			entry.QueuedAt.Format("02.01 15:04"),
+			entry.Attempts,
+		)
+	}
+	return text
+}
+
+// maxDoctorErrors keeps the /doctor reply within the message size limit.
+const maxDoctorErrors = 50
+
+func (b *Bot) doctorText(tr i18n.Lang) string {
+	errs := b.sheets.Diagnose()
+	if len(errs) == 0 {
+		return tr.T(i18n.DoctorOk)
+	}
+
+	text := tr.T(i18n.DoctorTitle, len(errs))
+	for i, rowErr := range errs {
+		if i == maxDoctorErrors {
+			text += tr.T(i18n.AndMore, len(errs)-maxDoctorErrors)
+			break
+		}
+		text += rowErrorText(tr, rowErr)
+	}
+	return text
+}
+
+// rowErrorText describes a malformed cell, e.g. of the ledger or of an
+// imported file.
+func rowErrorText(tr i18n.Lang, rowErr sheets.RowError) string {
+	problem := tr.T(i18n.EmptyValue)
+	if rowErr.Kind == sheets.InvalidValue {
+		problem = tr.T(i18n.InvalidValue, rowErr.Value)
+	}
+	return tr.T(i18n.DoctorLine, rowErr.Row, rowErr.Column, problem)
+}
+
+// unavailableText lists the providers that are skipped by the circuit breaker,
+// other failures are only logged.
+func unavailableText(tr i18n.Lang, errs map[string]error) string {
+	var names []string
+	for name, err := range errs {
+		if err == nil {
+			continue
+		}
+		log.Printf("Unable to fetch %s rates: %v", name, err)
+		if errors.Is(err, httpclient.ErrCircuitOpen) {
+			names = append(names, strings.TrimSpace(name))
+		}
+	}
+
+	if len(names) == 0 {
+		return ""
+	}
+	sort.Strings(names)
+	return tr.T(i18n.Unavailable, strings.Join(names, ", "))
+}
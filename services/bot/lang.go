@@ -0,0 +1,93 @@
+package bot
+
+import (
+	"log"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/period"
+)
+
+// lang is the language to answer user in: the one picked with /lang, or
+// the language of their client.
+func (b *Bot) lang(user *tgbotapi.User) i18n.Lang {
+	if user == nil {
+		return i18n.Default
+	}
+	if b.users != nil {
+		if known, ok := b.users.Get(user.ID); ok {
+			if lang, ok := i18n.Parse(known.Lang); ok {
+				return lang
+			}
+		}
+	}
+	return i18n.Detect(user.LanguageCode)
+}
+
+// langText shows the language of the author of message or sets it, "auto"
+// follows the client again.
+func (b *Bot) langText(message *tgbotapi.Message, args string) string {
+	tr := b.lang(message.From)
+	arg := strings.ToLower(strings.TrimSpace(args))
+	if arg == "" {
+		return tr.T(i18n.LangUsage, tr.T(i18n.LangName))
+	}
+
+	lang, ok := i18n.Parse(arg)
+	if !ok && arg != "auto" {
+		return tr.T(i18n.LangUsage, tr.T(i18n.LangName))
+	}
+	if b.users == nil {
+		return tr.T(i18n.SaveLater)
+	}
+	code := string(lang)
+	if !ok {
+		code = ""
+	}
+	if _, err := b.users.SetLang(message.From.ID, code); err != nil {
+		log.Printf("Unable to save the language of %d: %v", message.From.ID, err)
+		return tr.T(i18n.SaveLater)
+	}
+	return b.lang(message.From).T(i18n.LangChanged)
+}
+
+// periodLabel describes p in tr, e.g. "сентябрь 2026".
+func periodLabel(tr i18n.Lang, p period.Period) string {
+	switch p.Kind() {
+	case period.Yearly:
+		return tr.T(i18n.PeriodYear, p.Start.Year())
+	case period.Monthly:
+		return tr.T(i18n.PeriodMonth, tr.T(i18n.Months[p.Start.Month()-1]), p.Start.Year())
+	case period.Weekly:
+		return tr.T(i18n.PeriodWeek, p.Start.Format("02.01.2006"))
+	default:
+		return p.Start.Format("02.01.2006")
+	}
+}
+
+// amountText writes value in currency, the ledger one when empty, the way
+// numbers are written in tr.
+func amountText(tr i18n.Lang, value money.Decimal, currency string) string {
+	return tr.Locale().Amount(money.Amount{Value: value, Currency: currency})
+}
+
+// amountsText writes totals in several currencies, e.g. "120,00 ₽ + 10,00 $",
+// and a zero in the ledger currency when there are none.
+func amountsText(tr i18n.Lang, totals []money.Amount) string {
+	if len(totals) == 0 {
+		return amountText(tr, money.Decimal{}, "")
+	}
+	texts := make([]string, len(totals))
+	for i, total := range totals {
+		texts[i] = amountText(tr, total.Value, total.Currency)
+	}
+	return strings.Join(texts, " + ")
+}
+
+// rateText writes a rate reported by a provider the way numbers are written
+// in tr.
+func rateText(tr i18n.Lang, rate money.Rate) string {
+	return tr.Locale().Rate(rate)
+}
@@ -0,0 +1,265 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/access"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+	"github.com/kn9ka/fundbot-go/services/ledgerfile"
+	"github.com/kn9ka/fundbot-go/services/period"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+const (
+	// maxImportSize bounds the CSV files /import downloads.
+	maxImportSize = 1 << 20
+	// previewRows are shown before an import is confirmed.
+	previewRows = 10
+	// previewErrors are the skipped rows listed in the preview.
+	previewErrors = 5
+	// downloadTimeout bounds downloading an imported file.
+	downloadTimeout = 30 * time.Second
+)
+
+// pendingImport is an uploaded file waiting for /import confirm.
+type pendingImport struct {
+	Author   int64
+	FileName string
+	Expenses []sheets.Expense
+}
+
+// export returns the expenses of the chat as a file, args may name a period
+// and the format, csv or xlsx, in any order. Admins also get the expenses
+// written before chats were stored.
+func (b *Bot) export(tr i18n.Lang, message *tgbotapi.Message, args string) (string, *tgbotapi.FileBytes) {
+	format := "csv"
+	var rest []string
+	for _, field := range strings.Fields(args) {
+		switch strings.ToLower(field) {
+		case "csv", "xlsx":
+			format = strings.ToLower(field)
+		default:
+			rest = append(rest, field)
+		}
+	}
+
+	expenses := sheets.FilterByChat(b.sheets.LoadValues(), message.Chat.ID, b.allowed(access.Admin, message.From.ID))
+	name, label := "expenses", ""
+	if arg := strings.Join(rest, " "); arg != "" {
+		p, err := period.Parse(arg, b.now().In(b.location))
+		if err != nil {
+			return periodErrorText(tr, arg) + tr.T(i18n.ExportFormats), nil
+		}
+		expenses = sheets.FilterByPeriod(expenses, p)
+		name += "-" + strings.ToLower(strings.Join(rest, "-"))
+		label = tr.T(i18n.ForPeriod, periodLabel(tr, p))
+	}
+	if len(expenses) == 0 {
+		return tr.T(i18n.NothingFound), nil
+	}
+
+	var data []byte
+	var err error
+	if format == "xlsx" {
+		data, err = ledgerfile.XLSX(expenses, b.location)
+	} else {
+		data, err = ledgerfile.CSV(expenses, b.location)
+	}
+	if err != nil {
+		log.Printf("Unable to export expenses: %v", err)
+		return tr.T(i18n.ExportFailed), nil
+	}
+
+	text := tr.T(i18n.Exported, label, len(expenses))
+	return text, &tgbotapi.FileBytes{Name: name + "." + format, Bytes: data}
+}
+
+// importText confirms or cancels the import waiting in the chat.
+func (b *Bot) importText(tr i18n.Lang, message *tgbotapi.Message, args string) string {
+	chatId := message.Chat.ID
+	action := strings.ToLower(strings.TrimSpace(args))
+	if action != "confirm" && action != "cancel" {
+		return tr.T(i18n.ImportUsage)
+	}
+	if action == "confirm" && !b.allowed(access.Admin, message.From.ID) {
+		return tr.T(i18n.AdminOnly)
+	}
+
+	b.importMu.Lock()
+	draft, ok := b.imports[chatId]
+	if ok && draft.Author == message.From.ID {
+		delete(b.imports, chatId)
+	}
+	b.importMu.Unlock()
+
+	if !ok {
+		return tr.T(i18n.ImportNoFile) + tr.T(i18n.ImportUsage)
+	}
+	if draft.Author != message.From.ID {
+		return tr.T(i18n.ImportNotAuthor)
+	}
+	if action == "cancel" {
+		return tr.T(i18n.ImportCancelled, html.EscapeString(draft.FileName))
+	}
+
+	if b.sheets.Write(draft.Expenses) {
+		return tr.T(i18n.Imported, html.EscapeString(draft.FileName), len(draft.Expenses))
+	}
+	summary := tr.T(i18n.ImportSummary, draft.FileName, len(draft.Expenses))
+	if err := b.queue.Push(chatId, draft.Expenses, summary); err != nil {
+		log.Printf("Unable to queue import: %v", err)
+		return tr.T(i18n.SaveError)
+	}
+	return tr.T(i18n.Queued, html.EscapeString(summary))
+}
+
+// handleDocument previews the expenses of an uploaded CSV file, they are
+// only written after /import confirm. Other files are ignored.
+func (b *Bot) handleDocument(message *tgbotapi.Message) {
+	document := message.Document
+	if !strings.EqualFold(path.Ext(document.FileName), ".csv") && document.MimeType != "text/csv" {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(message.Chat.ID, "")
+	msg.ParseMode = "HTML"
+	msg.Text = b.previewImport(message)
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("Unable to send import preview: %v", err)
+	}
+}
+
+func (b *Bot) previewImport(message *tgbotapi.Message) string {
+	tr := b.lang(message.From)
+	if !b.allowed(access.Admin, message.From.ID) {
+		return tr.T(i18n.AdminOnly)
+	}
+	document := message.Document
+	if document.FileSize > maxImportSize {
+		return tr.T(i18n.FileTooLarge, maxImportSize>>10)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+	data, err := b.download(ctx, document.FileID, maxImportSize)
+	if err != nil {
+		log.Printf("Unable to download %s: %v", document.FileName, err)
+		return tr.T(i18n.DownloadFailed)
+	}
+
+	defaults := ledgerfile.Defaults{Id: importId(message.MessageID), Username: message.From.UserName, UserId: message.From.ID, Date: message.Time()}
+	expenses, errs, err := ledgerfile.ParseCSV(data, defaults, b.location)
+	if errors.Is(err, ledgerfile.ErrNoAmount) {
+		return tr.T(i18n.NoAmountColumn)
+	}
+	if err != nil {
+		return tr.T(i18n.ReadFailed, html.EscapeString(err.Error()))
+	}
+
+	for i := range expenses {
+		expenses[i].ChatId = message.Chat.ID
+		if expenses[i].Category == "" {
+			expenses[i].Category = b.categories.Classify(expenses[i].Reason)
+		}
+		if expenses[i].UserId == 0 && b.users != nil {
+			if user, ok := b.users.ByUsername(expenses[i].Username); ok {
+				expenses[i].UserId = user.Id
+			}
+		}
+	}
+
+	name := html.EscapeString(document.FileName)
+	text := ""
+	if len(expenses) == 0 {
+		text = tr.T(i18n.ImportEmpty, name)
+	} else {
+		text = tr.T(i18n.ImportTitle, name, len(expenses), amountsText(tr, sums(expenses)))
+		for i, e := range expenses {
+			if i == previewRows {
+				text += tr.T(i18n.AndMore, len(expenses)-previewRows)
+				break
+			}
+			text += previewLine(tr, e, b.userLabel(e.UserId, e.Username), b.location)
+		}
+	}
+
+	if len(errs) > 0 {
+		text += tr.T(i18n.SkippedRows)
+		for i, rowErr := range errs {
+			if i == previewErrors {
+				text += tr.T(i18n.AndMore, len(errs)-previewErrors)
+				break
+			}
+			text += html.EscapeString(rowErrorText(tr, rowErr))
+		}
+	}
+
+	if len(expenses) == 0 {
+		return text
+	}
+
+	b.importMu.Lock()
+	b.imports[message.Chat.ID] = pendingImport{Author: message.From.ID, FileName: document.FileName, Expenses: expenses}
+	b.importMu.Unlock()
+
+	return text + tr.T(i18n.ImportConfirm)
+}
+
+// importId is the id of the first expense imported from the file sent in
+// the message. Imported ids are negative, so they never collide with the
+// message ids of added expenses, and each file gets maxImportSize ids of its
+// own, as a file can not hold more rows than bytes.
+func importId(messageId int) int64 {
+	return -int64(messageId) * maxImportSize
+}
+
+func previewLine(tr i18n.Lang, e sheets.Expense, user string, location *time.Location) string {
+	line := fmt.Sprintf("%s %s %s", e.Date.In(location).Format("02.01.2006"), html.EscapeString(user), amountText(tr, e.Amount, e.Currency))
+	if e.Reason != "" {
+		line += " " + html.EscapeString(e.Reason)
+	}
+	if e.Category != "" {
+		line += fmt.Sprintf(" [%s]", html.EscapeString(e.Category))
+	}
+	return line + "\n"
+}
+
+// download fetches a file sent to the bot, up to limit bytes, until ctx is done.
+func (b *Bot) download(ctx context.Context, fileId string, limit int) ([]byte, error) {
+	file, err := b.apiWith(ctx).GetFile(tgbotapi.FileConfig{FileID: fileId})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(b.fileEndpoint, b.api.Token, file.FilePath), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %s", err)
+	}
+	resp, err := b.api.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %s", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download file: status %s", resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %s", err)
+	}
+	if len(data) > limit {
+		return nil, fmt.Errorf("file is larger than %d bytes", limit)
+	}
+	return data, nil
+}
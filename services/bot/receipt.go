@@ -0,0 +1,239 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/access"
+	"github.com/kn9ka/fundbot-go/services/categories"
+	"github.com/kn9ka/fundbot-go/services/fiscal"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+const (
+	// recentReceipts is how many expenses with a receipt /receipt lists.
+	recentReceipts = 5
+	// maxPhotoSize bounds the photos downloaded to look for a QR code,
+	// larger sizes of the photo are skipped.
+	maxPhotoSize = 2 << 20
+	// scanTimeout bounds looking for a QR code, updates wait for it.
+	scanTimeout = 10 * time.Second
+)
+
+// handlePhoto saves a photo with a caption like "2300 groceries" as an
+// expense, keeping the photo as its receipt. Without an amount in the
+// caption it looks for the QR code of a fiscal receipt and proposes the
+// expense it describes. Captioned photos are refused while the receipt
+// column is disabled, the receipt would be lost.
+func (b *Bot) handlePhoto(message *tgbotapi.Message) {
+	caption := strings.TrimSpace(message.Caption)
+	// sizes go from the smallest to the largest
+	photo := message.Photo[len(message.Photo)-1]
+	scanned := photo
+	for i := len(message.Photo) - 1; i > 0 && scanned.FileSize > maxPhotoSize; i-- {
+		scanned = message.Photo[i-1]
+	}
+
+	tr := b.lang(message.From)
+	msg := tgbotapi.NewMessage(message.Chat.ID, tr.T(i18n.PhotoUsage))
+	msg.ReplyToMessageID = message.MessageID
+
+	expense := b.parseExpense(message, caption)
+	if expense.Amount.Sign() > 0 {
+		if b.hasColumn("receipt") {
+			expense.Receipt = photo.FileID
+			b.saveExpense(message, expense)
+			return
+		}
+		msg.Text = tr.T(i18n.ReceiptsDisabled)
+	} else if r, ok := b.scanReceipt(scanned); ok {
+		msg.Text = tr.T(i18n.ReceiptProposal, r.Time.Format("02.01.2006 15:04"), amountText(tr, r.Amount(), ""))
+		if caption != "" {
+			msg.Text += ": " + caption
+		}
+		msg.Text += tr.T(i18n.SaveQuestion)
+		author := strconv.FormatInt(message.From.ID, 36)
+		msg.ReplyMarkup = b.keyboard(append(
+			b.button(tr.T(i18n.SaveButton), receiptAction, strconv.FormatInt(r.Kopecks(), 36), strconv.FormatInt(r.Time.Unix(), 36), author),
+			b.button(tr.T(i18n.DismissButton), dismissAction, author)...,
+		))
+	}
+	if _, err := b.api.Send(msg); err != nil {
+		log.Printf("Unable to send bot message after photo: %v", err)
+	}
+}
+
+// scanReceipt looks for a fiscal QR code on the photo. It gives up after
+// scanTimeout, decoding is left to finish in the background.
+func (b *Bot) scanReceipt(photo tgbotapi.PhotoSize) (fiscal.Receipt, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), scanTimeout)
+	defer cancel()
+
+	data, err := b.download(ctx, photo.FileID, maxPhotoSize)
+	if err != nil {
+		log.Printf("Unable to download photo: %v", err)
+		return fiscal.Receipt{}, false
+	}
+
+	type scan struct {
+		receipt fiscal.Receipt
+		err     error
+	}
+	done := make(chan scan, 1)
+	go func() {
+		r, err := fiscal.Scan(data, b.location)
+		done <- scan{r, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		log.Printf("Unable to scan photo: %v", ctx.Err())
+		return fiscal.Receipt{}, false
+	case result := <-done:
+		if result.err != nil {
+			if !errors.Is(result.err, fiscal.ErrNoCode) && !errors.Is(result.err, fiscal.ErrNotFiscal) {
+				log.Printf("Unable to scan photo: %v", result.err)
+			}
+			return fiscal.Receipt{}, false
+		}
+		return result.receipt, true
+	}
+}
+
+// confirmReceipt saves the expense proposed for a scanned receipt, args are
+// its amount in kopecks, negative for refunds, its unix time and the id of
+// the user who sent it. The photo is the message the proposal replied to.
+// The buttons are removed first and a receipt already written or queued is
+// not saved again, the button may have been pressed twice.
+func (b *Bot) confirmReceipt(tr i18n.Lang, query *tgbotapi.CallbackQuery, args []string) string {
+	if len(args) != 3 {
+		return tr.T(i18n.ExpiredButton)
+	}
+	var numbers [3]int64
+	for i, arg := range args {
+		n, err := strconv.ParseInt(arg, 36, 64)
+		if err != nil {
+			return tr.T(i18n.ExpiredButton)
+		}
+		numbers[i] = n
+	}
+	kopecks, date, author := numbers[0], time.Unix(numbers[1], 0).In(b.location), numbers[2]
+	if query.From.ID != author {
+		return tr.T(i18n.ReceiptNotAuthor)
+	}
+
+	expense := sheets.Expense{
+		Id:       int64(query.Message.MessageID),
+		Amount:   money.New(kopecks, -2),
+		Date:     date,
+		Username: query.From.UserName,
+		UserId:   query.From.ID,
+		ChatId:   query.Message.Chat.ID,
+		Active:   true,
+	}
+	if photo := query.Message.ReplyToMessage; photo != nil {
+		expense.Id = int64(photo.MessageID)
+		if len(photo.Photo) > 0 && b.hasColumn("receipt") {
+			expense.Receipt = photo.Photo[len(photo.Photo)-1].FileID
+		}
+		reason, tags := categories.ParseTags(photo.Caption)
+		expense.Reason = strings.TrimSpace(reason)
+		expense.Category = b.categories.Classify(expense.Reason)
+		if len(tags) > 0 {
+			expense.Category = b.categories.Canonical(tags[0])
+		}
+	}
+
+	b.removeKeyboard(query.Message)
+	if b.saved(query.Message.Chat.ID, expense) {
+		return tr.T(i18n.ReceiptSaved)
+	}
+	text, markup := b.writeExpense(tr, query.Message.Chat.ID, expense, author)
+	b.edit(query.Message, text, "", markup)
+	return ""
+}
+
+// saved reports whether the expense was written to the ledger or is queued
+// in the chat.
+func (b *Bot) saved(chatId int64, expense sheets.Expense) bool {
+	for _, e := range b.sheets.LoadValues() {
+		if e.Same(expense) {
+			return true
+		}
+	}
+	for _, entry := range b.queue.PendingIn(chatId) {
+		for _, e := range entry.Expenses {
+			if e.Same(expense) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// dismiss removes the buttons of a proposal, args[0] is the id of the only
+// user allowed to.
+func (b *Bot) dismiss(tr i18n.Lang, query *tgbotapi.CallbackQuery, args []string) string {
+	if len(args) != 1 {
+		return tr.T(i18n.ExpiredButton)
+	}
+	if author, err := strconv.ParseInt(args[0], 36, 64); err != nil || query.From.ID != author {
+		return tr.T(i18n.DismissNotAuthor)
+	}
+	b.removeKeyboard(query.Message)
+	return tr.T(i18n.NotSaved)
+}
+
+// receipt finds the receipt of the expense of the chat with the id in arg,
+// the latest one when ids repeat. Without arg it lists the recent expenses
+// having one. Like /export, admins also see expenses without a chat.
+func (b *Bot) receipt(tr i18n.Lang, message *tgbotapi.Message, arg string) (string, tgbotapi.RequestFileData) {
+	if !b.hasColumn("receipt") {
+		return tr.T(i18n.ReceiptsDisabled), nil
+	}
+
+	var withReceipt []sheets.Expense
+	for _, e := range sheets.FilterByChat(b.sheets.LoadValues(), message.Chat.ID, b.allowed(access.Admin, message.From.ID)) {
+		if e.Receipt != "" {
+			withReceipt = append(withReceipt, e)
+		}
+	}
+
+	arg = strings.TrimPrefix(strings.TrimSpace(arg), "#")
+	if arg == "" {
+		if len(withReceipt) == 0 {
+			return tr.T(i18n.ReceiptUsage), nil
+		}
+		if len(withReceipt) > recentReceipts {
+			withReceipt = withReceipt[len(withReceipt)-recentReceipts:]
+		}
+		str := tr.T(i18n.RecentReceipts)
+		for i := len(withReceipt) - 1; i >= 0; i-- {
+			e := withReceipt[i]
+			str += fmt.Sprintf("/receipt %d — %s %s %s\n", e.Id, html.EscapeString(b.userLabel(e.UserId, e.Username)), amountText(tr, e.Amount, e.Currency), html.EscapeString(e.Reason))
+		}
+		return str, nil
+	}
+
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return tr.T(i18n.ReceiptUsage), nil
+	}
+	for i := len(withReceipt) - 1; i >= 0; i-- {
+		e := withReceipt[i]
+		if e.Id == id {
+			text := tr.T(i18n.ReceiptOf, e.Id, html.EscapeString(b.userLabel(e.UserId, e.Username)), amountText(tr, e.Amount, e.Currency), html.EscapeString(e.Reason))
+			return text, tgbotapi.FileID(e.Receipt)
+		}
+	}
+	return tr.T(i18n.ReceiptMissing, id), nil
+}
@@ -0,0 +1,181 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/i18n"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/scheduler"
+)
+
+// DefaultReminderThreshold is used when /schedule reminders has no threshold.
+const DefaultReminderThreshold = 1000
+
+var jobNames = map[scheduler.Job]i18n.Key{
+	scheduler.Summary:   i18n.JobSummary,
+	scheduler.Rates:     i18n.JobRates,
+	scheduler.Reminders: i18n.JobReminders,
+}
+
+// RunJob posts a scheduled job to its chat in the language of the user who
+// added it, it is the handler of scheduler.Run. Nothing is posted once ctx
+// is cancelled.
+func (b *Bot) RunJob(ctx context.Context, schedule scheduler.Schedule) {
+	if ctx.Err() != nil {
+		return
+	}
+	tr, ok := i18n.Parse(schedule.Lang)
+	if !ok {
+		tr = i18n.Default
+	}
+	var text string
+
+	switch schedule.Job {
+	case scheduler.Summary:
+		text = tr.T(i18n.SummaryTitle) + b.listText(tr, "")
+	case scheduler.Rates:
+		text = b.ratesText(tr, nil)
+	case scheduler.Reminders:
+		text = b.remindersText(tr, schedule.Threshold)
+	default:
+		log.Printf("Unknown job %q of schedule %d", schedule.Job, schedule.Id)
+	}
+	if text == "" || ctx.Err() != nil {
+		return
+	}
+
+	msg := tgbotapi.NewMessage(schedule.ChatId, text)
+	msg.ParseMode = "HTML"
+	if _, err := b.apiWith(ctx).Send(msg); err != nil {
+		log.Printf("Unable to send scheduled %s to chat %d: %v", schedule.Job, schedule.ChatId, err)
+	}
+}
+
+// remindersText mentions users whose active balance reached threshold, it
+// is empty when there are none. The threshold is in the ledger currency,
+// balances in other currencies are not compared with it.
+func (b *Bot) remindersText(tr i18n.Lang, threshold money.Decimal) string {
+	var text string
+	for _, row := range b.sheets.LoadTotalByUsers(true) {
+		if row.Currency == "" && row.Total.Cmp(threshold) >= 0 {
+			text += fmt.Sprintf("%s: %s\n", html.EscapeString(b.userLabel(row.UserId, row.Name)), amountText(tr, row.Total, ""))
+		}
+	}
+	if text == "" {
+		return ""
+	}
+	return tr.T(i18n.RemindersTitle, amountText(tr, threshold, "")) + text
+}
+
+// scheduleText lists the schedules of the chat or changes them.
+func (b *Bot) scheduleText(tr i18n.Lang, chatId int64, args string) string {
+	if b.scheduler == nil {
+		return tr.T(i18n.SchedulesOff)
+	}
+
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return b.schedulesText(tr, chatId)
+	}
+
+	if fields[0] == "remove" {
+		id, err := strconv.ParseInt(strings.TrimPrefix(strings.Join(fields[1:], ""), "#"), 10, 64)
+		if err != nil {
+			return tr.T(i18n.ScheduleUsage)
+		}
+		removed, err := b.scheduler.Remove(chatId, id)
+		if err != nil {
+			log.Printf("Unable to remove schedule: %v", err)
+			return tr.T(i18n.SaveError)
+		}
+		if !removed {
+			return tr.T(i18n.ScheduleMissing, id)
+		}
+		return tr.T(i18n.ScheduleRemoved, id)
+	}
+
+	job := scheduler.Job(fields[0])
+	spec, ok := scheduler.Jobs[job]
+	if !ok {
+		return tr.T(i18n.ScheduleUsage)
+	}
+
+	rest := fields[1:]
+	var threshold money.Decimal
+	if job == scheduler.Reminders {
+		threshold = money.New(DefaultReminderThreshold, 0)
+		// a threshold is followed by nothing or by a spec, otherwise the
+		// number is the first field of the spec
+		if len(rest) > 0 {
+			if n, err := money.Parse(rest[0]); err == nil {
+				if _, err := scheduler.ParseSpec(strings.Join(rest[1:], " ")); len(rest) == 1 || err == nil {
+					threshold, rest = n, rest[1:]
+				}
+			}
+		}
+	}
+	if len(rest) > 0 {
+		spec = strings.Join(rest, " ")
+	}
+
+	schedule, err := b.scheduler.Add(scheduler.Schedule{ChatId: chatId, Job: job, Spec: spec, Threshold: threshold, Lang: string(tr)})
+	if err != nil {
+		return tr.T(i18n.ScheduleAddFailed, html.EscapeString(err.Error()), tr.T(i18n.ScheduleUsage))
+	}
+	return tr.T(i18n.ScheduleAdded, b.scheduleLine(tr, schedule))
+}
+
+func (b *Bot) schedulesText(tr i18n.Lang, chatId int64) string {
+	schedules := b.scheduler.List(chatId)
+	if len(schedules) == 0 {
+		return tr.T(i18n.NoSchedules) + tr.T(i18n.ScheduleUsage)
+	}
+
+	text := ""
+	for _, schedule := range schedules {
+		text += b.scheduleLine(tr, schedule)
+	}
+	return text + "\n" + tr.T(i18n.ScheduleUsage)
+}
+
+func (b *Bot) scheduleLine(tr i18n.Lang, schedule scheduler.Schedule) string {
+	name := tr.T(jobNames[schedule.Job])
+	if schedule.Job == scheduler.Reminders {
+		name += tr.T(i18n.ReminderThreshold, amountText(tr, schedule.Threshold, ""))
+	}
+
+	next := tr.T(i18n.Never)
+	if t := b.scheduler.Next(schedule); !t.IsZero() {
+		next = t.In(b.location).Format("02.01 15:04")
+	}
+	return tr.T(i18n.ScheduleLine, schedule.Id, name, html.EscapeString(schedule.Spec), next)
+}
+
+// RunScheduler starts posting scheduled jobs until ctx is cancelled,
+// Shutdown waits for the job in progress.
+func (b *Bot) RunScheduler(ctx context.Context) {
+	if b.scheduler == nil {
+		return
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		b.scheduler.Run(ctx, b.RunJob)
+	}()
+
+	b.OnShutdown(func(ctx context.Context) error {
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("scheduled job still running: %w", ctx.Err())
+		}
+	})
+}
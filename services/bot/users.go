@@ -0,0 +1,87 @@
+package bot
+
+import (
+	"log"
+	"strconv"
+	"strings"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+	"github.com/kn9ka/fundbot-go/services/users"
+)
+
+// observe records the author of an update in the user registry. Rows a new
+// user wrote before ids were stored are assigned their id.
+func (b *Bot) observe(update tgbotapi.Update) {
+	var from *tgbotapi.User
+	switch {
+	case update.CallbackQuery != nil:
+		from = update.CallbackQuery.From
+	case update.Message != nil:
+		from = update.Message.From
+	}
+	if b.users == nil || from == nil || from.IsBot {
+		return
+	}
+
+	added, err := b.users.Observe(from.ID, from.UserName, from.FirstName, from.LastName)
+	if err != nil {
+		log.Printf("Unable to save user %d: %v", from.ID, err)
+		return
+	}
+	// a username taken over from another user does not bring their rows
+	username := strings.ToLower(from.UserName)
+	if added && username != "" && b.users.FirstSeen()[username] == from.ID {
+		b.assignUserIds(map[string]int64{username: from.ID})
+	}
+}
+
+// MigrateUsers assigns the rows written before ids were stored to the first
+// user seen with their username.
+func (b *Bot) MigrateUsers() {
+	if b.users == nil {
+		return
+	}
+	if ids := b.users.FirstSeen(); len(ids) > 0 {
+		b.assignUserIds(ids)
+	}
+}
+
+func (b *Bot) assignUserIds(ids map[string]int64) {
+	updated, err := b.sheets.AssignUserIds(ids)
+	if err != nil {
+		log.Printf("Unable to assign user ids: %v", err)
+		return
+	}
+	if updated > 0 {
+		log.Printf("Assigned user ids to %d rows", updated)
+	}
+}
+
+// userLabel is how the author of rows is shown: the current @username from
+// the registry, the one in the rows for users the bot has not seen.
+func (b *Bot) userLabel(userId int64, username string) string {
+	if b.users != nil && userId != 0 {
+		if user, ok := b.users.Get(userId); ok {
+			return user.Label()
+		}
+	}
+	return users.User{Id: userId, Username: username}.Label()
+}
+
+// userArg encodes the author of rows in callback data: the id in base 36 or
+// the username for users without one.
+func userArg(userId int64, username string) string {
+	if userId != 0 {
+		return "#" + strconv.FormatInt(userId, 36)
+	}
+	return username
+}
+
+// parseUserArg is the reverse of userArg.
+func parseUserArg(arg string) (int64, string, bool) {
+	if !strings.HasPrefix(arg, "#") {
+		return 0, arg, arg != ""
+	}
+	id, err := strconv.ParseInt(arg[1:], 36, 64)
+	return id, "", err == nil && id != 0
+}
@@ -0,0 +1,83 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MaxLength is the limit Telegram puts on callback data.
+	MaxLength = 64
+	// signatureLength is the number of base64 characters of the signature kept.
+	signatureLength = 8
+	separator       = ":"
+)
+
+var (
+	ErrMalformed = errors.New("malformed callback data")
+	ErrSignature = errors.New("invalid callback signature")
+)
+
+// Data is the action of a button with its arguments.
+type Data struct {
+	Action string
+	Args   []string
+}
+
+// Codec packs buttons into callback data of the form "action:arg:...:sig".
+// The signature keeps clients, which may send any data they like, from
+// pressing buttons the bot never showed.
+type Codec struct {
+	key []byte
+}
+
+// NewCodec creates a codec signing with a key derived from secret, e.g. the
+// bot token.
+func NewCodec(secret string) *Codec {
+	key := sha256.Sum256([]byte("callback" + separator + secret))
+	return &Codec{key: key[:]}
+}
+
+func (c *Codec) Encode(action string, args ...string) (string, error) {
+	if action == "" {
+		return "", fmt.Errorf("empty callback action")
+	}
+	parts := append([]string{action}, args...)
+	for _, part := range parts {
+		if strings.Contains(part, separator) {
+			return "", fmt.Errorf("callback argument %q contains %q", part, separator)
+		}
+	}
+
+	payload := strings.Join(parts, separator)
+	data := payload + separator + c.sign(payload)
+	if len(data) > MaxLength {
+		return "", fmt.Errorf("callback data of %s is %d bytes long, the limit is %d", action, len(data), MaxLength)
+	}
+	return data, nil
+}
+
+func (c *Codec) Decode(data string) (Data, error) {
+	i := strings.LastIndex(data, separator)
+	if i <= 0 {
+		return Data{}, ErrMalformed
+	}
+
+	payload, signature := data[:i], data[i+1:]
+	if !hmac.Equal([]byte(signature), []byte(c.sign(payload))) {
+		return Data{}, ErrSignature
+	}
+
+	parts := strings.Split(payload, separator)
+	return Data{Action: parts[0], Args: parts[1:]}, nil
+}
+
+func (c *Codec) sign(payload string) string {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))[:signatureLength]
+}
@@ -0,0 +1,70 @@
+package callback_test
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/callback"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	codec := callback.NewCodec("123456:token")
+
+	data, err := codec.Encode("undo", "42", "alice")
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if !strings.HasPrefix(data, "undo:42:alice:") || len(data) > callback.MaxLength {
+		t.Errorf("Encode() = %q", data)
+	}
+
+	got, err := codec.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if want := (callback.Data{Action: "undo", Args: []string{"42", "alice"}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("Decode() = %+v, want %+v", got, want)
+	}
+
+	if got, err := codec.Decode(mustEncode(t, codec, "rates", "")); err != nil || !reflect.DeepEqual(got.Args, []string{""}) {
+		t.Errorf("Decode() of an empty argument = %+v, %v", got, err)
+	}
+}
+
+func TestDecodeRejectsForgedData(t *testing.T) {
+	codec := callback.NewCodec("123456:token")
+	data := mustEncode(t, codec, "settle", "alice")
+
+	forged := strings.Replace(data, "alice", "bob", 1)
+	if _, err := codec.Decode(forged); !errors.Is(err, callback.ErrSignature) {
+		t.Errorf("Decode(%q) error = %v, want ErrSignature", forged, err)
+	}
+	if _, err := callback.NewCodec("other").Decode(data); !errors.Is(err, callback.ErrSignature) {
+		t.Errorf("Decode() with another secret error = %v, want ErrSignature", err)
+	}
+	for _, data := range []string{"", "settle", ":abc"} {
+		if _, err := codec.Decode(data); !errors.Is(err, callback.ErrMalformed) {
+			t.Errorf("Decode(%q) error = %v, want ErrMalformed", data, err)
+		}
+	}
+}
+
+func TestEncodeRejectsInvalidData(t *testing.T) {
+	codec := callback.NewCodec("123456:token")
+	for _, args := range [][]string{{""}, {"settle", "a:b"}, {"settle", strings.Repeat("x", callback.MaxLength)}} {
+		if data, err := codec.Encode(args[0], args[1:]...); err == nil {
+			t.Errorf("Encode(%q) = %q, want error", args, data)
+		}
+	}
+}
+
+func mustEncode(t *testing.T, codec *callback.Codec, action string, args ...string) string {
+	t.Helper()
+	data, err := codec.Encode(action, args...)
+	if err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	return data
+}
@@ -0,0 +1,215 @@
+package categories
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kn9ka/fundbot-go/services/store"
+)
+
+// Defaults are used until the dictionary is changed with /categories.
+var Defaults = map[string][]string{
+	"Транспорт":   {"такси", "taxi", "yandex", "яндекс", "uber", "bolt", "метро", "автобус", "бензин"},
+	"Продукты":    {"продукты", "магазин", "супермаркет", "carrefour", "spar", "nikora"},
+	"Кафе":        {"кафе", "кофе", "coffee", "ресторан", "обед", "lunch", "ужин", "бар"},
+	"Жильё":       {"аренда", "rent", "квартира", "коммуналка", "электричество"},
+	"Развлечения": {"кино", "концерт", "музей", "театр"},
+}
+
+type Category struct {
+	Name     string   `json:"name"`
+	Keywords []string `json:"keywords"`
+}
+
+type state struct {
+	Categories []Category `json:"categories"`
+}
+
+// Dictionary maps keywords found in expense reasons to categories and keeps
+// the mapping on disk.
+type Dictionary struct {
+	mu    sync.Mutex
+	file  *store.File
+	state state
+}
+
+func New(path string) (*Dictionary, error) {
+	d := &Dictionary{file: store.NewFile(path)}
+
+	var saved *state
+	if err := d.file.Load(&saved); err != nil {
+		return nil, err
+	}
+	if saved != nil {
+		d.state = *saved
+	} else {
+		for name, keywords := range Defaults {
+			d.state.Categories = append(d.state.Categories, Category{Name: name, Keywords: append([]string(nil), keywords...)})
+		}
+	}
+	d.sort()
+	return d, nil
+}
+
+// Categories returns a copy of the dictionary sorted by name.
+func (d *Dictionary) Categories() []Category {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.state.copy().Categories
+}
+
+// Classify returns the category of the longest keyword some word of reason
+// starts with, so "такси" also matches "таксисту". It returns "" when
+// nothing matches.
+func (d *Dictionary) Classify(reason string) string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	words := strings.FieldsFunc(strings.ToLower(reason), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	match, length := "", 0
+	for _, category := range d.state.Categories {
+		for _, keyword := range category.Keywords {
+			if utf8.RuneCountInString(keyword) <= length {
+				continue
+			}
+			for _, word := range words {
+				if strings.HasPrefix(word, keyword) {
+					match, length = category.Name, utf8.RuneCountInString(keyword)
+					break
+				}
+			}
+		}
+	}
+	return match
+}
+
+// Canonical returns the known spelling of a category name, e.g. of a #tag,
+// where underscores stand for spaces. Unknown names are returned as is.
+func (d *Dictionary) Canonical(name string) string {
+	name = strings.TrimSpace(strings.ReplaceAll(name, "_", " "))
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if i := d.find(name); i >= 0 {
+		return d.state.Categories[i].Name
+	}
+	return name
+}
+
+// Add creates the category if needed and moves keywords to it.
+func (d *Dictionary) Add(name string, keywords []string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("empty category name")
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	previous := d.state.copy()
+	for _, keyword := range keywords {
+		d.removeKeyword(normalize(keyword))
+	}
+
+	i := d.find(name)
+	if i < 0 {
+		d.state.Categories = append(d.state.Categories, Category{Name: name})
+		i = len(d.state.Categories) - 1
+	}
+	for _, keyword := range keywords {
+		if keyword = normalize(keyword); keyword != "" {
+			d.state.Categories[i].Keywords = append(d.state.Categories[i].Keywords, keyword)
+		}
+	}
+
+	d.sort()
+	if err := d.file.Save(d.state); err != nil {
+		d.state = previous
+		return err
+	}
+	return nil
+}
+
+// Remove deletes a whole category or a single keyword and reports whether
+// anything matched.
+func (d *Dictionary) Remove(name string) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if i := d.find(strings.TrimSpace(name)); i >= 0 {
+		d.state.Categories = append(d.state.Categories[:i], d.state.Categories[i+1:]...)
+	} else if !d.removeKeyword(normalize(name)) {
+		return false, nil
+	}
+	return true, d.file.Save(d.state)
+}
+
+// copy returns the state sharing no slices with s, so that sorting and
+// removing keywords leave it untouched.
+func (s state) copy() state {
+	result := state{Categories: make([]Category, len(s.Categories))}
+	for i, category := range s.Categories {
+		result.Categories[i] = Category{Name: category.Name, Keywords: append([]string(nil), category.Keywords...)}
+	}
+	return result
+}
+
+func (d *Dictionary) find(name string) int {
+	for i, category := range d.state.Categories {
+		if strings.EqualFold(category.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Dictionary) removeKeyword(keyword string) bool {
+	removed := false
+	for i, category := range d.state.Categories {
+		var kept []string
+		for _, existing := range category.Keywords {
+			if existing == keyword {
+				removed = true
+				continue
+			}
+			kept = append(kept, existing)
+		}
+		d.state.Categories[i].Keywords = kept
+	}
+	return removed
+}
+
+func (d *Dictionary) sort() {
+	sort.Slice(d.state.Categories, func(i, j int) bool {
+		return d.state.Categories[i].Name < d.state.Categories[j].Name
+	})
+	for _, category := range d.state.Categories {
+		sort.Strings(category.Keywords)
+	}
+}
+
+func normalize(keyword string) string {
+	return strings.ToLower(strings.Trim(keyword, " ,.;"))
+}
+
+// ParseTags removes #tags from text and returns them without the '#'.
+func ParseTags(text string) (string, []string) {
+	var words, tags []string
+	for _, word := range strings.Fields(text) {
+		if len(word) > 1 && strings.HasPrefix(word, "#") {
+			tags = append(tags, strings.TrimPrefix(word, "#"))
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " "), tags
+}
@@ -0,0 +1,116 @@
+package categories_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/categories"
+)
+
+func TestClassify(t *testing.T) {
+	d, err := categories.New(filepath.Join(t.TempDir(), "categories.json"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	tests := map[string]string{
+		"Yandex Taxi":         "Транспорт",
+		"таксисту на чай":     "Транспорт",
+		"обед в кафе":         "Кафе",
+		"продукты, Carrefour": "Продукты",
+		"подарок":             "",
+		"":                    "",
+	}
+	for reason, want := range tests {
+		if got := d.Classify(reason); got != want {
+			t.Errorf("Classify(%q) = %q, want %q", reason, got, want)
+		}
+	}
+}
+
+func TestClassifyPrefersKeywordWithMoreLetters(t *testing.T) {
+	d, err := categories.New(filepath.Join(t.TempDir(), "categories.json"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	// "мтс" takes more bytes than "mtsbk" but has fewer letters
+	if err := d.Add("Связь", []string{"мтс"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := d.Add("Банк", []string{"mtsbk"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if got := d.Classify("мтс mtsbk"); got != "Банк" {
+		t.Errorf("Classify() = %q, want the category of the longer keyword", got)
+	}
+}
+
+func TestChangesArePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "categories.json")
+	d, err := categories.New(path)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := d.Add("Подарки", []string{"Цветы", "taxi"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if removed, err := d.Remove("развлечения"); err != nil || !removed {
+		t.Fatalf("Remove(развлечения) = %v, %v", removed, err)
+	}
+	if removed, err := d.Remove("unknown"); err != nil || removed {
+		t.Fatalf("Remove(unknown) = %v, %v", removed, err)
+	}
+
+	reloaded, err := categories.New(path)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if !reflect.DeepEqual(reloaded.Categories(), d.Categories()) {
+		t.Errorf("reloaded = %+v, want %+v", reloaded.Categories(), d.Categories())
+	}
+	// keywords move between categories
+	if got := reloaded.Classify("taxi"); got != "Подарки" {
+		t.Errorf("Classify(taxi) = %q, want Подарки", got)
+	}
+	if got := reloaded.Canonical("подарки"); got != "Подарки" {
+		t.Errorf("Canonical(подарки) = %q, want Подарки", got)
+	}
+	if got := reloaded.Classify("кино"); got != "" {
+		t.Errorf("Classify(кино) = %q, want none after removal", got)
+	}
+}
+
+func TestAddKeepsDictionaryWhenSaveFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "categories.json")
+	d, err := categories.New(path)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	before := d.Categories()
+
+	// a directory in place of the file makes every save fail
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := d.Add("Подарки", []string{"цветы", "taxi"}); err == nil {
+		t.Fatal("Add() error = nil, want the failed save")
+	}
+	if got := d.Categories(); !reflect.DeepEqual(got, before) {
+		t.Errorf("Categories() = %+v, want %+v", got, before)
+	}
+	if got := d.Classify("taxi"); got != "Транспорт" {
+		t.Errorf("Classify(taxi) = %q, want Транспорт", got)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	text, tags := categories.ParseTags("250 #кафе coffee  with #Bob #")
+	if text != "250 coffee with #" || !reflect.DeepEqual(tags, []string{"кафе", "Bob"}) {
+		t.Errorf("ParseTags() = %q, %v", text, tags)
+	}
+}
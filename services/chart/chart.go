@@ -0,0 +1,190 @@
+package chart
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"sync"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	width      = 800
+	padding    = 24
+	rowHeight  = 44
+	barHeight  = 20
+	prevHeight = 8
+	maxLabel   = 220
+)
+
+var (
+	background = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+	textColor  = color.RGBA{R: 0x33, G: 0x33, B: 0x33, A: 0xff}
+	prevColor  = color.RGBA{R: 0xc8, G: 0xc8, B: 0xc8, A: 0xff}
+	palette    = []color.RGBA{
+		{R: 0x4e, G: 0x79, B: 0xa7, A: 0xff},
+		{R: 0xf2, G: 0x8e, B: 0x2b, A: 0xff},
+		{R: 0xe1, G: 0x57, B: 0x59, A: 0xff},
+		{R: 0x76, G: 0xb7, B: 0xb2, A: 0xff},
+		{R: 0x59, G: 0xa1, B: 0x4f, A: 0xff},
+		{R: 0xed, G: 0xc9, B: 0x48, A: 0xff},
+		{R: 0xb0, G: 0x7a, B: 0xa1, A: 0xff},
+		{R: 0x9c, G: 0x75, B: 0x5f, A: 0xff},
+	}
+)
+
+// Bar is a labelled value, Previous is drawn below it for comparison.
+// Amount is the value as printed after the bar.
+type Bar struct {
+	Label    string
+	Amount   string
+	Value    float64
+	Previous float64
+}
+
+// Chart is a horizontal bar chart. Current and Previous name the periods in
+// the legend, the legend is left out when Previous is empty.
+type Chart struct {
+	Title    string
+	Current  string
+	Previous string
+	Bars     []Bar
+}
+
+var (
+	fontOnce sync.Once
+	goFont   *opentype.Font
+	fontErr  error
+)
+
+// newFace creates a face of the Go font, which covers Latin and Cyrillic.
+// Faces are not safe for concurrent use, so every render makes its own.
+func newFace(size float64) (font.Face, error) {
+	fontOnce.Do(func() {
+		goFont, fontErr = opentype.Parse(goregular.TTF)
+	})
+	if fontErr != nil {
+		return nil, fmt.Errorf("failed to parse font: %s", fontErr)
+	}
+
+	face, err := opentype.NewFace(goFont, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font face: %s", err)
+	}
+	return face, nil
+}
+
+// Render draws the chart as a PNG image.
+func Render(c Chart) ([]byte, error) {
+	titleFace, err := newFace(20)
+	if err != nil {
+		return nil, err
+	}
+	textFace, err := newFace(14)
+	if err != nil {
+		return nil, err
+	}
+
+	top := padding + 32
+	height := top + len(c.Bars)*rowHeight + padding
+	if c.Previous != "" {
+		height += 28
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+
+	drawText(img, titleFace, textColor, padding, padding+18, c.Title)
+
+	labelWidth := 0
+	maxValue := 0.0
+	for _, bar := range c.Bars {
+		if w := font.MeasureString(textFace, bar.Label).Ceil(); w > labelWidth {
+			labelWidth = w
+		}
+		if bar.Value > maxValue {
+			maxValue = bar.Value
+		}
+		if bar.Previous > maxValue {
+			maxValue = bar.Previous
+		}
+	}
+	if labelWidth > maxLabel {
+		labelWidth = maxLabel
+	}
+
+	barLeft := padding + labelWidth + 12
+	// leave room for the amount printed after the longest bar
+	barSpace := width - barLeft - padding - 90
+
+	for i, bar := range c.Bars {
+		y := top + i*rowHeight
+		drawText(img, textFace, textColor, padding, y+15, truncate(textFace, bar.Label, labelWidth))
+
+		barColor := palette[i%len(palette)]
+		length := scale(bar.Value, maxValue, barSpace)
+		fill(img, barLeft, y, length, barHeight, barColor)
+		drawText(img, textFace, textColor, barLeft+length+6, y+15, bar.Amount)
+
+		if c.Previous != "" {
+			fill(img, barLeft, y+barHeight+3, scale(bar.Previous, maxValue, barSpace), prevHeight, prevColor)
+		}
+	}
+
+	if c.Previous != "" {
+		y := top + len(c.Bars)*rowHeight + 8
+		fill(img, padding, y, 14, 14, palette[0])
+		drawText(img, textFace, textColor, padding+20, y+12, c.Current)
+		x := padding + 20 + font.MeasureString(textFace, c.Current).Ceil() + 24
+		fill(img, x, y+3, 14, prevHeight, prevColor)
+		drawText(img, textFace, textColor, x+20, y+12, c.Previous)
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode chart: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func scale(value, max float64, space int) int {
+	if max <= 0 || value <= 0 {
+		return 0
+	}
+	length := int(value / max * float64(space))
+	if length < 1 {
+		length = 1
+	}
+	return length
+}
+
+func fill(img *image.RGBA, x, y, w, h int, c color.Color) {
+	draw.Draw(img, image.Rect(x, y, x+w, y+h), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// drawText draws s with its baseline at y.
+func drawText(img *image.RGBA, face font.Face, c color.Color, x, y int, s string) {
+	d := font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face, Dot: fixed.P(x, y)}
+	d.DrawString(s)
+}
+
+// truncate shortens s with an ellipsis to fit into width pixels.
+func truncate(face font.Face, s string, width int) string {
+	if font.MeasureString(face, s).Ceil() <= width {
+		return s
+	}
+	runes := []rune(s)
+	for len(runes) > 0 {
+		runes = runes[:len(runes)-1]
+		if candidate := string(runes) + "…"; font.MeasureString(face, candidate).Ceil() <= width {
+			return candidate
+		}
+	}
+	return ""
+}
@@ -0,0 +1,39 @@
+package chart_test
+
+import (
+	"bytes"
+	"image/png"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/chart"
+)
+
+func TestRender(t *testing.T) {
+	data, err := chart.Render(chart.Chart{
+		Title:    "Расходы за сентябрь 2026: 450.00",
+		Current:  "сентябрь 2026",
+		Previous: "август 2026",
+		Bars: []chart.Bar{
+			{Label: "Транспорт", Amount: "300,00 ₽", Value: 300, Previous: 200},
+			{Label: "Очень длинное название категории, которое не помещается", Amount: "150,00 ₽", Value: 150},
+			{Label: "Без категории", Amount: "0,01 ₽", Value: 0.01, Previous: 400},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Render() error = %v", err)
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Render() is not a PNG: %v", err)
+	}
+	if bounds := img.Bounds(); bounds.Dx() != 800 || bounds.Dy() < 3*44 {
+		t.Errorf("chart size = %v", bounds)
+	}
+
+	// the first bar is drawn in the first palette color
+	r, g, b, _ := img.At(400, 24+32+10).RGBA()
+	if r>>8 != 0x4e || g>>8 != 0x79 || b>>8 != 0xa7 {
+		t.Errorf("color inside the first bar = %x %x %x", r>>8, g>>8, b>>8)
+	}
+}
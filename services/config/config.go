@@ -0,0 +1,322 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	DefaultEnvPath             = ".env"
+	DefaultBotApiEndpoint      = "https://api.telegram.org/bot%s/%s"
+	DefaultBotFileEndpoint     = "https://api.telegram.org/file/bot%s/%s"
+	DefaultServiceAccountPath  = "./serviceAccount.json"
+	DefaultShutdownTimeout     = 15 * time.Second
+	DefaultUndoWindow          = 10 * time.Minute
+	DefaultConversationTimeout = 5 * time.Minute
+	DefaultDataDir             = "./data"
+	DefaultTimezone            = "UTC"
+	DefaultWorksheet           = "1"
+	DefaultHttpTimeout         = 15 * time.Second
+	DefaultHttpMaxRetries      = 2
+	DefaultBreakerThreshold    = 5
+	DefaultBreakerCooldown     = time.Minute
+)
+
+type Config struct {
+	BotToken string `yaml:"botToken"`
+	// BotApiEndpoint is the Bot API URL format with placeholders for the
+	// token and the method, e.g. to use a local Bot API server.
+	BotApiEndpoint string `yaml:"botApiEndpoint"`
+	// BotFileEndpoint is the URL format files sent to the bot are downloaded
+	// from, with placeholders for the token and the file path.
+	BotFileEndpoint string `yaml:"botFileEndpoint"`
+	// ShutdownTimeout bounds how long in-flight updates and ledger writes
+	// may take to finish after SIGINT/SIGTERM.
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout"`
+	// UndoWindow is how long the undo button under a saved expense works.
+	UndoWindow time.Duration `yaml:"undoWindow"`
+	// ConversationTimeout is how long multi-step commands such as /add wait
+	// for the next answer.
+	ConversationTimeout time.Duration `yaml:"conversationTimeout"`
+	// DataDir keeps the bot's local state, e.g. ledger entries waiting to be synced.
+	DataDir string `yaml:"dataDir"`
+	// Timezone is the IANA name of the zone expense dates are shown and
+	// grouped in, e.g. Europe/Moscow.
+	Timezone     string       `yaml:"timezone"`
+	Http         Http         `yaml:"http"`
+	Sheets       Sheets       `yaml:"sheets"`
+	AlphaVantage AlphaVantage `yaml:"alphaVantage"`
+	Access       Access       `yaml:"access"`
+}
+
+// Http configures the client shared by the exchange rate providers.
+type Http struct {
+	Timeout    time.Duration `yaml:"timeout"`
+	MaxRetries int           `yaml:"maxRetries"`
+	// BreakerThreshold consecutive failures of a host stop requests to it
+	// for BreakerCooldown.
+	BreakerThreshold int           `yaml:"breakerThreshold"`
+	BreakerCooldown  time.Duration `yaml:"breakerCooldown"`
+}
+
+type Sheets struct {
+	SpreadsheetId      string `yaml:"spreadsheetId"`
+	ServiceAccountPath string `yaml:"serviceAccountPath"`
+	// Worksheet is the name of the sheet tab holding the ledger.
+	Worksheet string `yaml:"worksheet"`
+	// ExtraColumns enables optional ledger columns: currency, participants,
+	// receipt.
+	ExtraColumns []string `yaml:"extraColumns"`
+}
+
+// Access restricts the bot to the listed chats and users. It is open to
+// everyone while all lists are empty.
+type Access struct {
+	// Chats are the groups the bot works in, it leaves any other group.
+	Chats []int64 `yaml:"chats"`
+	// Users may use the bot in private chats.
+	Users []int64 `yaml:"users"`
+	// Admins may use the bot anywhere, run destructive commands and manage
+	// the lists with /admin.
+	Admins []int64 `yaml:"admins"`
+}
+
+// Enabled reports whether access is restricted.
+func (a Access) Enabled() bool {
+	return len(a.Chats) > 0 || len(a.Users) > 0 || len(a.Admins) > 0
+}
+
+type AlphaVantage struct {
+	ApiKey string `yaml:"apiKey"`
+}
+
+// Load builds the configuration from defaults, the optional YAML file at
+// filePath, the optional dotenv file at envPath and the process environment,
+// later sources overriding earlier ones, and validates the result.
+func Load(envPath string, filePath string) (*Config, error) {
+	cfg := &Config{
+		BotApiEndpoint:      DefaultBotApiEndpoint,
+		BotFileEndpoint:     DefaultBotFileEndpoint,
+		ShutdownTimeout:     DefaultShutdownTimeout,
+		UndoWindow:          DefaultUndoWindow,
+		ConversationTimeout: DefaultConversationTimeout,
+		DataDir:             DefaultDataDir,
+		Timezone:            DefaultTimezone,
+		Http: Http{
+			Timeout:          DefaultHttpTimeout,
+			MaxRetries:       DefaultHttpMaxRetries,
+			BreakerThreshold: DefaultBreakerThreshold,
+			BreakerCooldown:  DefaultBreakerCooldown,
+		},
+		Sheets: Sheets{
+			ServiceAccountPath: DefaultServiceAccountPath,
+			Worksheet:          DefaultWorksheet,
+		},
+	}
+
+	if filePath != "" {
+		if err := cfg.loadFile(filePath); err != nil {
+			return nil, err
+		}
+		log.Printf("%v config file loaded", filePath)
+	}
+
+	// variables already set in the environment take precedence over .env
+	if envPath != "" {
+		if err := godotenv.Load(envPath); err == nil {
+			log.Printf("%v config initialize!", envPath)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to load %s: %s", envPath, err)
+		}
+	}
+
+	if err := cfg.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %s", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %s", path, err)
+	}
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+	values := map[string]*string{
+		"BOT_TOKEN":              &c.BotToken,
+		"BOT_API_ENDPOINT":       &c.BotApiEndpoint,
+		"BOT_FILE_ENDPOINT":      &c.BotFileEndpoint,
+		"DATA_DIR":               &c.DataDir,
+		"TIMEZONE":               &c.Timezone,
+		"GOOGLE_SHEET_ID":        &c.Sheets.SpreadsheetId,
+		"GOOGLE_SERVICE_ACCOUNT": &c.Sheets.ServiceAccountPath,
+		"GOOGLE_SHEET_NAME":      &c.Sheets.Worksheet,
+		"ALPHA_VANTAGE_API_KEY":  &c.AlphaVantage.ApiKey,
+	}
+	for name, field := range values {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = value
+		}
+	}
+
+	lists := map[string]*[]string{
+		"GOOGLE_SHEET_EXTRA_COLUMNS": &c.Sheets.ExtraColumns,
+	}
+	for name, field := range lists {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*field = append(*field, item)
+				}
+			}
+		}
+	}
+
+	ids := map[string]*[]int64{
+		"ALLOWED_CHATS": &c.Access.Chats,
+		"ALLOWED_USERS": &c.Access.Users,
+		"ADMINS":        &c.Access.Admins,
+	}
+	for name, field := range ids {
+		if value, ok := os.LookupEnv(name); ok {
+			*field = nil
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item == "" {
+					continue
+				}
+				id, err := strconv.ParseInt(item, 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid %s id %q: %s", name, item, err)
+				}
+				*field = append(*field, id)
+			}
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"SHUTDOWN_TIMEOUT":      &c.ShutdownTimeout,
+		"UNDO_WINDOW":           &c.UndoWindow,
+		"CONVERSATION_TIMEOUT":  &c.ConversationTimeout,
+		"HTTP_TIMEOUT":          &c.Http.Timeout,
+		"HTTP_BREAKER_COOLDOWN": &c.Http.BreakerCooldown,
+	}
+	for name, field := range durations {
+		if value, ok := os.LookupEnv(name); ok {
+			d, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %s", name, value, err)
+			}
+			*field = d
+		}
+	}
+
+	ints := map[string]*int{
+		"HTTP_MAX_RETRIES":       &c.Http.MaxRetries,
+		"HTTP_BREAKER_THRESHOLD": &c.Http.BreakerThreshold,
+	}
+	for name, field := range ints {
+		if value, ok := os.LookupEnv(name); ok {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s %q: %s", name, value, err)
+			}
+			*field = n
+		}
+	}
+
+	return nil
+}
+
+// Location loads the configured timezone.
+func (c *Config) Location() (*time.Location, error) {
+	return time.LoadLocation(c.Timezone)
+}
+
+// Validate reports every missing or invalid setting at once.
+func (c *Config) Validate() error {
+	var problems []string
+
+	if c.BotToken == "" {
+		problems = append(problems, "BOT_TOKEN is required")
+	}
+	if strings.Count(c.BotApiEndpoint, "%s") != 2 {
+		problems = append(problems, "BOT_API_ENDPOINT must contain two %s placeholders, for the token and the method")
+	}
+	if strings.Count(c.BotFileEndpoint, "%s") != 2 {
+		problems = append(problems, "BOT_FILE_ENDPOINT must contain two %s placeholders, for the token and the file path")
+	}
+	if c.DataDir == "" {
+		problems = append(problems, "DATA_DIR is required")
+	}
+	if _, err := c.Location(); err != nil {
+		problems = append(problems, fmt.Sprintf("TIMEZONE is invalid: %s", err))
+	}
+	if c.Sheets.SpreadsheetId == "" {
+		problems = append(problems, "GOOGLE_SHEET_ID is required")
+	}
+	if c.Sheets.Worksheet == "" {
+		problems = append(problems, "GOOGLE_SHEET_NAME is required")
+	}
+	if c.Sheets.ServiceAccountPath == "" {
+		problems = append(problems, "GOOGLE_SERVICE_ACCOUNT is required")
+	} else if _, err := os.Stat(c.Sheets.ServiceAccountPath); err != nil {
+		problems = append(problems, fmt.Sprintf("service account file is not readable: %s", err))
+	}
+	if c.AlphaVantage.ApiKey == "" {
+		problems = append(problems, "ALPHA_VANTAGE_API_KEY is required")
+	}
+	if c.ShutdownTimeout <= 0 {
+		problems = append(problems, "SHUTDOWN_TIMEOUT must be positive")
+	}
+	if c.UndoWindow <= 0 {
+		problems = append(problems, "UNDO_WINDOW must be positive")
+	}
+	if c.Access.Enabled() && len(c.Access.Admins) == 0 {
+		problems = append(problems, "ADMINS is required when ALLOWED_CHATS or ALLOWED_USERS are set")
+	}
+	if c.ConversationTimeout <= 0 {
+		problems = append(problems, "CONVERSATION_TIMEOUT must be positive")
+	}
+	if c.Http.Timeout <= 0 {
+		problems = append(problems, "HTTP_TIMEOUT must be positive")
+	}
+	if c.Http.MaxRetries < 0 {
+		problems = append(problems, "HTTP_MAX_RETRIES must not be negative")
+	}
+	if c.Http.BreakerThreshold <= 0 {
+		problems = append(problems, "HTTP_BREAKER_THRESHOLD must be positive")
+	}
+	if c.Http.BreakerCooldown <= 0 {
+		problems = append(problems, "HTTP_BREAKER_COOLDOWN must be positive")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  - %s", strings.Join(problems, "\n  - "))
+	}
+	return nil
+}
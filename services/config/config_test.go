@@ -0,0 +1,154 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/config"
+)
+
+var variables = []string{
+	"BOT_TOKEN", "BOT_API_ENDPOINT", "BOT_FILE_ENDPOINT", "DATA_DIR", "TIMEZONE",
+	"GOOGLE_SHEET_ID", "GOOGLE_SERVICE_ACCOUNT", "GOOGLE_SHEET_NAME", "GOOGLE_SHEET_EXTRA_COLUMNS",
+	"ALPHA_VANTAGE_API_KEY", "ALLOWED_CHATS", "ALLOWED_USERS", "ADMINS",
+	"SHUTDOWN_TIMEOUT", "UNDO_WINDOW", "CONVERSATION_TIMEOUT",
+	"HTTP_TIMEOUT", "HTTP_MAX_RETRIES", "HTTP_BREAKER_THRESHOLD", "HTTP_BREAKER_COOLDOWN",
+}
+
+// clearEnv unsets every variable Load reads, they are restored after the test.
+func clearEnv(t *testing.T) {
+	t.Helper()
+	for _, name := range variables {
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+}
+
+func write(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	clearEnv(t)
+	account := write(t, "serviceAccount.json", "{}")
+
+	file := write(t, "config.yaml", `
+botToken: from-file
+timezone: Europe/Moscow
+undoWindow: 1m
+sheets:
+  spreadsheetId: sheet-from-file
+  serviceAccountPath: `+account+`
+  worksheet: Ledger
+  extraColumns: [currency]
+alphaVantage:
+  apiKey: key-from-file
+`)
+	env := write(t, ".env", "BOT_TOKEN=from-dotenv\nGOOGLE_SHEET_ID=sheet-from-dotenv\nUNDO_WINDOW=2m\n")
+	t.Setenv("BOT_TOKEN", "from-env")
+	t.Setenv("GOOGLE_SHEET_EXTRA_COLUMNS", "currency, receipt,")
+	t.Setenv("ADMINS", "1, 2")
+
+	cfg, err := config.Load(env, file)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if cfg.BotToken != "from-env" {
+		t.Errorf("BotToken = %q, the environment should win over .env and the file", cfg.BotToken)
+	}
+	if cfg.Sheets.SpreadsheetId != "sheet-from-dotenv" || cfg.UndoWindow != 2*time.Minute {
+		t.Errorf("SpreadsheetId = %q, UndoWindow = %v, .env should win over the file", cfg.Sheets.SpreadsheetId, cfg.UndoWindow)
+	}
+	if cfg.Timezone != "Europe/Moscow" || cfg.Sheets.Worksheet != "Ledger" || cfg.AlphaVantage.ApiKey != "key-from-file" {
+		t.Errorf("config = %+v, want the file values that are not overridden", cfg)
+	}
+	if cfg.ShutdownTimeout != config.DefaultShutdownTimeout || cfg.Http.MaxRetries != config.DefaultHttpMaxRetries {
+		t.Errorf("config = %+v, want defaults for unset values", cfg)
+	}
+	if want := []string{"currency", "receipt"}; !reflect.DeepEqual(cfg.Sheets.ExtraColumns, want) {
+		t.Errorf("ExtraColumns = %v, want %v", cfg.Sheets.ExtraColumns, want)
+	}
+	if want := []int64{1, 2}; !reflect.DeepEqual(cfg.Access.Admins, want) {
+		t.Errorf("Admins = %v, want %v", cfg.Access.Admins, want)
+	}
+}
+
+func TestLoadMissingFiles(t *testing.T) {
+	clearEnv(t)
+	dir := t.TempDir()
+
+	// a missing .env is fine, a missing config file that was asked for is not
+	if _, err := config.Load(filepath.Join(dir, ".env"), filepath.Join(dir, "config.yaml")); err == nil || !strings.Contains(err.Error(), "failed to read config file") {
+		t.Errorf("Load() error = %v, want the missing config file", err)
+	}
+}
+
+func TestLoadRejectsUnknownFields(t *testing.T) {
+	clearEnv(t)
+	file := write(t, "config.yaml", "botTokn: typo\n")
+
+	if _, err := config.Load("", file); err == nil || !strings.Contains(err.Error(), "botTokn") {
+		t.Errorf("Load() error = %v, want the unknown field", err)
+	}
+}
+
+func TestLoadInvalidEnv(t *testing.T) {
+	tests := map[string]string{
+		"UNDO_WINDOW":      "ten minutes",
+		"HTTP_MAX_RETRIES": "two",
+		"ADMINS":           "1,alice",
+	}
+	for name, value := range tests {
+		t.Run(name, func(t *testing.T) {
+			clearEnv(t)
+			t.Setenv(name, value)
+
+			if _, err := config.Load("", ""); err == nil || !strings.Contains(err.Error(), name) {
+				t.Errorf("Load() error = %v, want invalid %s", err, name)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	clearEnv(t)
+	t.Setenv("TIMEZONE", "Mars/Olympus")
+	t.Setenv("BOT_API_ENDPOINT", "https://example.com/bot")
+	t.Setenv("UNDO_WINDOW", "0s")
+	t.Setenv("HTTP_MAX_RETRIES", "-1")
+	t.Setenv("ALLOWED_CHATS", "-100")
+	t.Setenv("GOOGLE_SERVICE_ACCOUNT", filepath.Join(t.TempDir(), "missing.json"))
+
+	_, err := config.Load("", "")
+	if err == nil {
+		t.Fatal("Load() error = nil, want validation errors")
+	}
+	for _, problem := range []string{
+		"BOT_TOKEN is required",
+		"BOT_API_ENDPOINT must contain two %s placeholders",
+		"TIMEZONE is invalid",
+		"GOOGLE_SHEET_ID is required",
+		"service account file is not readable",
+		"ALPHA_VANTAGE_API_KEY is required",
+		"UNDO_WINDOW must be positive",
+		"HTTP_MAX_RETRIES must not be negative",
+		"ADMINS is required",
+	} {
+		if !strings.Contains(err.Error(), problem) {
+			t.Errorf("Load() error = %v, want %q", err, problem)
+		}
+	}
+	if strings.Contains(err.Error(), "SHUTDOWN_TIMEOUT") {
+		t.Errorf("Load() error = %v, the default shutdown timeout is valid", err)
+	}
+}
@@ -1,13 +1,14 @@
 package contact
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/services/money"
 	"io"
 	"log"
-	"net/http"
-	"strings"
+	"sync"
 )
 
 const (
@@ -25,164 +26,48 @@ type FeesResponseBody struct {
 type AuthTokenResponseBody struct {
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int64  `json:"expiresIn"`
 }
 type CreateFormResponseBody struct {
 	Id string `json:"id"`
 }
 
-type FetchClient struct {
-	Client  *http.Client
-	Token   string
-	Cookies struct {
-		Refresh string
-		Access  string
-	}
-}
-
-var instance *FetchClient
-
-func GetRates() map[string]string {
-	result := map[string]string{}
-
-	if rubUsd, err := getRate(USD); err == nil {
-		result[USD] = rubUsd
-	}
-	if rubGel, err := getRate(GEL); err == nil {
-		result[GEL] = rubGel
-	}
+type Service struct {
+	fetch *FetchClient
 
-	return result
+	// mu serializes rate requests, they all go through the same transfer form
+	mu     sync.Mutex
+	formId string
 }
 
-func getFetchClient() *FetchClient {
-	if instance == nil {
-		instance = &FetchClient{
-			Client: &http.Client{},
-		}
+// NewService creates a provider calling apiUrl, which is ApiUrl in production.
+func NewService(client *httpclient.Client, apiUrl string) *Service {
+	return &Service{
+		fetch: NewFetchClient(client, apiUrl),
 	}
-	if instance.Token == "" {
-		instance.RefreshAccessToken()
-	}
-	return instance
 }
 
-func (fc *FetchClient) RefreshAccessToken() {
-	data := struct {
-		TokenType string `json:"tokenType"`
-		GrantType string `json:"grantType"`
-		Ticket    string `json:"ticket"`
-	}{
-		TokenType: "SplitTokenV2",
-		GrantType: "anonymous",
-		Ticket:    "D5267BED-18CC-4661-B03A-65934CAE1CA4",
-	}
-	payload, err := json.Marshal(data)
-	if err != nil {
-		fmt.Printf("failed to marshal JSON: %s\n", err)
-	}
-
-	req, err := http.NewRequest("POST", ApiUrl+"/auth/token", bytes.NewBuffer(payload))
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-
-	if err != nil {
-		fmt.Printf("failed to send request: %s", err)
-	}
-
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Printf("Unable to close request body: %v", err)
-		}
-	}(resp.Body)
-
-	cookies := resp.Header.Values("Set-Cookie")
-	for _, cookieString := range cookies {
-		cookieParts := strings.SplitN(cookieString, "=", 2)
-		if len(cookieParts) != 2 {
-			fmt.Printf("wrong format for cookie: %s", cookieString)
-		}
-
-		cookieName := strings.TrimSpace(cookieParts[0])
-		cookieValue := strings.TrimSpace(cookieParts[1])
-		cookieParams := strings.SplitN(cookieValue, ";", 2)
-
-		if cookieName == "tokenTailRefresh2" {
-			fc.Cookies.Refresh = strings.TrimSpace(cookieParams[0])
-		}
-		if cookieName == "tokenTailAccess2" {
-			fc.Cookies.Access = strings.TrimSpace(cookieParams[0])
-		}
-	}
-
-	var jsonResp AuthTokenResponseBody
-
-	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
-		log.Printf("failed to decode response: %v", err)
-	}
-
-	token := jsonResp.AccessToken
-
-	if err != nil {
-		log.Printf("failed to decode cookies: %v", err)
-	}
+// GetRates returns the rates it managed to fetch along with the errors of the failed ones.
+func (s *Service) GetRates() (map[string]money.Rate, error) {
+	result := map[string]money.Rate{}
+	var errs []error
 
-	fc.Token = token
-}
-
-func (fc *FetchClient) SetHeaders(req *http.Request) {
-	req.Header.Set("content-type", "application/json")
-	if fc.Token != "" {
-		req.Header.Set("Authorization", "SplitTokenV2 "+fc.Token)
-	}
-	if fc.Cookies.Refresh != "" {
-		req.AddCookie(&http.Cookie{Name: "tokenTailRefresh2", Value: fc.Cookies.Refresh})
-	}
-	if fc.Cookies.Access != "" {
-		req.AddCookie(&http.Cookie{Name: "tokenTailAccess2", Value: fc.Cookies.Access})
-	}
-}
-
-func (fc *FetchClient) DoRequest(method, url string, body io.Reader) (*http.Response, error) {
-	req, err := http.NewRequest(method, url, body)
-	if err != nil {
-		return nil, err
-	}
-
-	fc.SetHeaders(req)
-
-	resp, err := fc.Client.Do(req)
-	if err != nil {
-		return nil, err
+	if rubUsd, err := s.getRate(USD); err == nil {
+		result[USD] = rubUsd
+	} else {
+		errs = append(errs, err)
 	}
-
-	cookies := resp.Header.Values("Set-Cookie")
-	for _, cookieString := range cookies {
-		cookieParts := strings.SplitN(cookieString, "=", 2)
-		if len(cookieParts) != 2 {
-			return nil, fmt.Errorf("wrong format for cookie: %s", cookieString)
-		}
-
-		cookieName := strings.TrimSpace(cookieParts[0])
-		cookieValue := strings.TrimSpace(cookieParts[1])
-		cookieParams := strings.SplitN(cookieValue, ";", 2)
-
-		if cookieName == "tokenTailRefresh2" {
-			fc.Cookies.Refresh = strings.TrimSpace(cookieParams[0])
-		}
-		if cookieName == "tokenTailAccess2" {
-			fc.Cookies.Access = strings.TrimSpace(cookieParams[0])
-		}
+	if rubGel, err := s.getRate(GEL); err == nil {
+		result[GEL] = rubGel
+	} else {
+		errs = append(errs, err)
 	}
 
-	return resp, nil
+	return result, errors.Join(errs...)
 }
 
-func createExchangeForm() (string, error) {
-	url := fmt.Sprintf("%s/trns/bank", ApiUrl)
-	client := getFetchClient()
+func (s *Service) createExchangeForm() (string, error) {
+	url := fmt.Sprintf("%s/trns/bank", s.fetch.apiUrl)
 
 	data := struct {
 		BankCode string `json:"bankCode"`
@@ -196,24 +81,27 @@ func createExchangeForm() (string, error) {
 		return "", fmt.Errorf("failed to marshal JSON: %s", err)
 	}
 
-	resp, err := client.DoRequest("POST", url, bytes.NewBuffer(payload))
+	resp, err := s.fetch.DoRequest("POST", url, payload, false)
 	if err != nil {
 		log.Printf("failed to send request: %v", err)
-		return "", fmt.Errorf("failed to send request: %s", err)
+		return "", fmt.Errorf("failed to send request: %w", err)
 	}
+	defer closeBody(resp.Body)
 
 	var jsonResp CreateFormResponseBody
 	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
 		log.Printf("failed to decode response: %v", err)
 		return "", err
 	}
+	if jsonResp.Id == "" {
+		return "", errors.New("failed to create form: empty form id")
+	}
 
 	return jsonResp.Id, nil
 }
 
-func updateForm(formId string, outCurrency string) (bool, error) {
-	url := fmt.Sprintf("%s/trns/%s/fields", ApiUrl, formId)
-	client := getFetchClient()
+func (s *Service) updateForm(formId string, outCurrency string) error {
+	url := fmt.Sprintf("%s/trns/%s/fields", s.fetch.apiUrl, formId)
 
 	data := struct {
 		Amount   string `json:"trnAmount"`
@@ -226,49 +114,87 @@ func updateForm(formId string, outCurrency string) (bool, error) {
 	// Преобразуем данные в формат JSON
 	payload, err := json.Marshal(data)
 	if err != nil {
-		return false, fmt.Errorf("failed to marshal JSON: %s", err)
+		return fmt.Errorf("failed to marshal JSON: %s", err)
 	}
 
-	resp, err := client.DoRequest("PUT", url, bytes.NewBuffer(payload))
+	resp, err := s.fetch.DoRequest("PUT", url, payload, false)
 	if err != nil {
 		log.Printf("failed to send request: %v", err)
-		return false, fmt.Errorf("failed to send request: %s", err)
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	closeBody(resp.Body)
+	return nil
+}
+
+// prepareForm points the transfer form at outCurrency. The form is created
+// once and reused, a new one is only requested when the old one is rejected.
+func (s *Service) prepareForm(outCurrency string) (string, error) {
+	if s.formId != "" {
+		err := s.updateForm(s.formId, outCurrency)
+		if err == nil {
+			return s.formId, nil
+		}
+
+		var statusErr *httpclient.StatusError
+		if !errors.As(err, &statusErr) || statusErr.Temporary() {
+			return "", fmt.Errorf("error while updating form %w", err)
+		}
+		log.Printf("contact form %s rejected, creating a new one: %v", s.formId, err)
+		s.formId = ""
 	}
 
-	return resp.StatusCode == 200, nil
+	formId, err := s.createExchangeForm()
+	if err != nil {
+		return "", fmt.Errorf("error while creating form %w", err)
+	}
+	if err := s.updateForm(formId, outCurrency); err != nil {
+		return "", fmt.Errorf("error while updating form %w", err)
+	}
+
+	s.formId = formId
+	return formId, nil
 }
 
-func getRate(outCurrency string) (string, error) {
-	client := getFetchClient()
-	client.RefreshAccessToken()
+// getRate returns the price of outCurrency in rubles.
+func (s *Service) getRate(outCurrency string) (money.Rate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	formId, err := createExchangeForm()
-	_, err = updateForm(formId, outCurrency)
+	formId, err := s.prepareForm(outCurrency)
 	if err != nil {
-		return "", fmt.Errorf("error while updating form %v", err)
+		return money.Rate{}, err
 	}
 
-	url := fmt.Sprintf("%s/trns/%s/fees", ApiUrl, formId)
+	url := fmt.Sprintf("%s/trns/%s/fees", s.fetch.apiUrl, formId)
 
-	resp, err := client.DoRequest("POST", url, nil)
+	// asking for the fees changes nothing, it is safe to send again
+	resp, err := s.fetch.DoRequest("POST", url, nil, true)
 	if err != nil {
 		log.Printf("failed to send request: %v", err)
-		return "", fmt.Errorf("failed to send request: %s", err)
+		return money.Rate{}, fmt.Errorf("failed to send request: %w", err)
 	}
 
-	defer func(Body io.ReadCloser) {
-		err := Body.Close()
-		if err != nil {
-			log.Printf("Unable to close request body: %v", err)
-		}
-	}(resp.Body)
+	defer closeBody(resp.Body)
 
 	var jsonResp FeesResponseBody
 	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
 		log.Printf("failed to decode response: %v", err)
-		return "", err
+		return money.Rate{}, err
 	}
 
-	return jsonResp.Rate, nil
+	if jsonResp.Rate == "" {
+		return money.Rate{}, fmt.Errorf("no rate for %s", outCurrency)
+	}
 
+	value, err := money.Parse(jsonResp.Rate)
+	if err != nil {
+		return money.Rate{}, fmt.Errorf("failed to parse rate for %s: %s", outCurrency, err)
+	}
+	return money.Rate{From: outCurrency, To: money.Base, Value: value}, nil
+}
+
+func closeBody(body io.ReadCloser) {
+	if err := body.Close(); err != nil {
+		log.Printf("Unable to close request body: %v", err)
+	}
 }
@@ -0,0 +1,134 @@
+package contact_test
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/contact"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/testing/fakes"
+)
+
+func TestGetRatesRecorded(t *testing.T) {
+	server := fakes.NewContact()
+	defer server.Close()
+
+	rates, err := contact.NewService(fakes.NewHttpClient(), server.ApiUrl).GetRates()
+	if err != nil {
+		t.Fatalf("GetRates() error = %v", err)
+	}
+
+	want := map[string]string{"USD": "93.15", "GEL": "36.02"}
+	for currency, rate := range want {
+		if got := rates[currency]; got.Value.String() != rate || got.From != currency || got.To != "RUB" {
+			t.Errorf("rates[%s] = %s, want %s in RUB", currency, got, rate)
+		}
+	}
+
+	if got := server.TokenRequests(); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+	if got := server.Forms(); got != 1 {
+		t.Errorf("forms created = %d, want 1", got)
+	}
+}
+
+func TestGetRatesReusesToken(t *testing.T) {
+	server := fakes.NewContact()
+	defer server.Close()
+
+	service := contact.NewService(fakes.NewHttpClient(), server.ApiUrl)
+	for i := 0; i < 3; i++ {
+		if _, err := service.GetRates(); err != nil {
+			t.Fatalf("GetRates() error = %v", err)
+		}
+	}
+
+	if got := server.TokenRequests(); got != 1 {
+		t.Errorf("token requests = %d, want 1", got)
+	}
+	if got := server.Forms(); got != 1 {
+		t.Errorf("forms created = %d, want 1", got)
+	}
+}
+
+func TestGetRatesRefreshesRejectedToken(t *testing.T) {
+	server := fakes.NewContact()
+	defer server.Close()
+
+	service := contact.NewService(fakes.NewHttpClient(), server.ApiUrl)
+	if _, err := service.GetRates(); err != nil {
+		t.Fatalf("GetRates() error = %v", err)
+	}
+
+	server.ExpireTokens()
+
+	rates, err := service.GetRates()
+	if err != nil {
+		t.Fatalf("GetRates() after expiry error = %v", err)
+	}
+	if rates["USD"].Value.String() != "93.15" {
+		t.Errorf("rates[USD] = %s, want 93.15", rates["USD"])
+	}
+	if got := server.TokenRequests(); got != 2 {
+		t.Errorf("token requests = %d, want 2", got)
+	}
+}
+
+func TestGetRatesConcurrently(t *testing.T) {
+	server := fakes.NewContact()
+	defer server.Close()
+
+	service := contact.NewService(fakes.NewHttpClient(), server.ApiUrl)
+	if _, err := service.GetRates(); err != nil {
+		t.Fatalf("GetRates() error = %v", err)
+	}
+	server.ExpireTokens()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := service.GetRates(); err != nil {
+				t.Errorf("GetRates() error = %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestGetRatesFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		scenario   fakes.Scenario
+		statusCode int
+	}{
+		{name: "empty rate", scenario: fakes.Empty},
+		{name: "malformed body", scenario: fakes.Malformed},
+		{name: "server error", scenario: fakes.ServerError, statusCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakes.NewContact()
+			defer server.Close()
+			server.SetScenario(tt.scenario)
+
+			rates, err := contact.NewService(fakes.NewHttpClient(), server.ApiUrl).GetRates()
+			if err == nil {
+				t.Fatalf("GetRates() error = nil, rates = %v", rates)
+			}
+			if len(rates) != 0 {
+				t.Errorf("GetRates() rates = %v, want none", rates)
+			}
+
+			var statusErr *httpclient.StatusError
+			if tt.statusCode != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.statusCode) {
+				t.Errorf("GetRates() error = %v, want status %d", err, tt.statusCode)
+			}
+		})
+	}
+}
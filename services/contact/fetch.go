@@ -0,0 +1,271 @@
+package contact
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+)
+
+const (
+	refreshCookie = "tokenTailRefresh2"
+	accessCookie  = "tokenTailAccess2"
+	// defaultTokenTTL is assumed when neither the response nor the access
+	// cookie tells how long the token lives.
+	defaultTokenTTL = 10 * time.Minute
+	// expiryMargin refreshes the token a bit before it actually expires.
+	expiryMargin    = 30 * time.Second
+	anonymousTicket = "D5267BED-18CC-4661-B03A-65934CAE1CA4"
+)
+
+// FetchClient sends authorized requests to the contact API. It refreshes the
+// access token only when it is about to expire or the API rejects it, and is
+// safe for concurrent use.
+type FetchClient struct {
+	Client *httpclient.Client
+	apiUrl string
+
+	mu           sync.Mutex
+	token        string
+	refreshToken string
+	expiresAt    time.Time
+	cookies      struct {
+		Refresh string
+		Access  string
+	}
+}
+
+func NewFetchClient(client *httpclient.Client, apiUrl string) *FetchClient {
+	return &FetchClient{Client: client, apiUrl: apiUrl}
+}
+
+// RefreshAccessToken obtains a new access token, using the refresh token and
+// cookie when there are any and falling back to a new anonymous session.
+func (fc *FetchClient) RefreshAccessToken() error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	return fc.refresh()
+}
+
+func (fc *FetchClient) refresh() error {
+	if fc.refreshToken != "" {
+		err := fc.requestToken(struct {
+			TokenType    string `json:"tokenType"`
+			GrantType    string `json:"grantType"`
+			RefreshToken string `json:"refreshToken"`
+		}{
+			TokenType:    "SplitTokenV2",
+			GrantType:    "refresh_token",
+			RefreshToken: fc.refreshToken,
+		})
+		if err == nil {
+			return nil
+		}
+		log.Printf("failed to refresh contact token, starting new session: %v", err)
+	}
+
+	fc.token = ""
+	fc.refreshToken = ""
+	fc.cookies.Refresh = ""
+	fc.cookies.Access = ""
+
+	return fc.requestToken(struct {
+		TokenType string `json:"tokenType"`
+		GrantType string `json:"grantType"`
+		Ticket    string `json:"ticket"`
+	}{
+		TokenType: "SplitTokenV2",
+		GrantType: "anonymous",
+		Ticket:    anonymousTicket,
+	})
+}
+
+func (fc *FetchClient) requestToken(data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %s", err)
+	}
+
+	req, err := http.NewRequest("POST", fc.apiUrl+"/auth/token", bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	fc.setCookies(req)
+
+	resp, err := fc.Client.Do(req)
+	if err != nil {
+		log.Printf("failed to send request: %v", err)
+		return fmt.Errorf("failed to refresh access token: %w", err)
+	}
+	defer closeBody(resp.Body)
+
+	cookieTTL := fc.storeCookies(resp)
+
+	var jsonResp AuthTokenResponseBody
+	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
+		log.Printf("failed to decode response: %v", err)
+		return fmt.Errorf("failed to decode access token: %s", err)
+	}
+	if jsonResp.AccessToken == "" {
+		return errors.New("failed to refresh access token: empty token in response")
+	}
+
+	ttl := defaultTokenTTL
+	if jsonResp.ExpiresIn > 0 {
+		ttl = time.Duration(jsonResp.ExpiresIn) * time.Second
+	} else if cookieTTL > 0 {
+		ttl = cookieTTL
+	}
+
+	fc.token = jsonResp.AccessToken
+	if jsonResp.RefreshToken != "" {
+		fc.refreshToken = jsonResp.RefreshToken
+	}
+	fc.expiresAt = time.Now().Add(ttl)
+	return nil
+}
+
+func (fc *FetchClient) ensureToken() error {
+	if fc.token != "" && time.Now().Before(fc.expiresAt.Add(-expiryMargin)) {
+		return nil
+	}
+	return fc.refresh()
+}
+
+// setHeaders authorizes req with the current token and returns it.
+func (fc *FetchClient) setHeaders(req *http.Request) string {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	req.Header.Set("content-type", "application/json")
+	if fc.token != "" {
+		req.Header.Set("Authorization", "SplitTokenV2 "+fc.token)
+	}
+	fc.setCookies(req)
+	return fc.token
+}
+
+// setCookies adds the token cookies to req, fc.mu must be held.
+func (fc *FetchClient) setCookies(req *http.Request) {
+	if fc.cookies.Refresh != "" {
+		req.AddCookie(&http.Cookie{Name: refreshCookie, Value: fc.cookies.Refresh})
+	}
+	if fc.cookies.Access != "" {
+		req.AddCookie(&http.Cookie{Name: accessCookie, Value: fc.cookies.Access})
+	}
+}
+
+// storeCookies keeps the token cookies of resp and returns how long the
+// access cookie is valid for, if the server said so. fc.mu must be held.
+func (fc *FetchClient) storeCookies(resp *http.Response) time.Duration {
+	var ttl time.Duration
+
+	for _, cookieString := range resp.Header.Values("Set-Cookie") {
+		cookieParts := strings.SplitN(cookieString, "=", 2)
+		if len(cookieParts) != 2 {
+			log.Printf("wrong format for cookie: %s", cookieString)
+			continue
+		}
+
+		cookieName := strings.TrimSpace(cookieParts[0])
+		cookieValue := strings.TrimSpace(cookieParts[1])
+		cookieParams := strings.SplitN(cookieValue, ";", 2)
+
+		if cookieName == refreshCookie {
+			fc.cookies.Refresh = strings.TrimSpace(cookieParams[0])
+		}
+		if cookieName == accessCookie {
+			fc.cookies.Access = strings.TrimSpace(cookieParams[0])
+		}
+	}
+
+	for _, cookie := range resp.Cookies() {
+		if cookie.Name != accessCookie {
+			continue
+		}
+		if cookie.MaxAge > 0 {
+			ttl = time.Duration(cookie.MaxAge) * time.Second
+		} else if !cookie.Expires.IsZero() {
+			ttl = time.Until(cookie.Expires)
+		}
+	}
+
+	return ttl
+}
+
+// DoRequest sends an authorized request. If the API answers 401 the token is
+// refreshed and the request is sent once more. The lock is only held while
+// the token is checked or refreshed, not for the request itself. Requests
+// that only read are retried on failures whatever their method.
+func (fc *FetchClient) DoRequest(method, url string, payload []byte, readOnly bool) (*http.Response, error) {
+	fc.mu.Lock()
+	err := fc.ensureToken()
+	fc.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	resp, token, err := fc.send(method, url, payload, readOnly)
+
+	var statusErr *httpclient.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusUnauthorized {
+		if err := fc.refreshRejected(token); err != nil {
+			return nil, err
+		}
+		resp, _, err = fc.send(method, url, payload, readOnly)
+	}
+
+	return resp, err
+}
+
+// refreshRejected refreshes the token the API rejected, unless a concurrent
+// request already replaced it.
+func (fc *FetchClient) refreshRejected(token string) error {
+	fc.mu.Lock()
+	defer fc.mu.Unlock()
+
+	if fc.token != token {
+		return nil
+	}
+	log.Printf("contact token rejected, refreshing")
+	return fc.refresh()
+}
+
+// send makes a single request with the current token and returns the token
+// it was sent with.
+func (fc *FetchClient) send(method, url string, payload []byte, readOnly bool) (*http.Response, string, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := fc.setHeaders(req)
+	if readOnly {
+		httpclient.MarkIdempotent(req)
+	}
+
+	resp, err := fc.Client.Do(req)
+	if err != nil {
+		return nil, token, err
+	}
+
+	fc.mu.Lock()
+	fc.storeCookies(resp)
+	fc.mu.Unlock()
+	return resp, token, nil
+}
@@ -0,0 +1,170 @@
+package conversation
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Step asks for one value of a flow.
+type Step struct {
+	Name   string
+	Prompt string
+	// Options are suggested answers shown as buttons, may be nil.
+	Options func() []Option
+	// Parse validates and normalizes the answer. Its error is shown to the
+	// user and the step is asked again.
+	Parse func(answer string) (string, error)
+}
+
+// Option is a suggested answer. Key marks labels that are message keys the
+// caller translates, other labels such as names given by users are shown
+// as they are.
+type Option struct {
+	Label string
+	Key   bool
+}
+
+// Flow is a multi-step command, its steps are asked one after another.
+type Flow struct {
+	Name  string
+	Steps []Step
+}
+
+// Key identifies a conversation, a user may run one flow per chat.
+type Key struct {
+	ChatId int64
+	UserId int64
+}
+
+type state struct {
+	flow    *Flow
+	step    int
+	values  map[string]string
+	updated time.Time
+}
+
+// Result is the outcome of an answer. Next is the step to ask next, when
+// Done the flow is over and Values hold every answer by step name.
+type Result struct {
+	Flow   string
+	Next   *Step
+	Done   bool
+	Values map[string]string
+}
+
+// Machine keeps the state of running flows in memory. Conversations left
+// without an answer for the timeout are forgotten.
+type Machine struct {
+	mu      sync.Mutex
+	flows   map[string]*Flow
+	states  map[Key]*state
+	timeout time.Duration
+	now     func() time.Time
+}
+
+// New creates a machine running flows, the timeout is counted by now,
+// time.Now when nil.
+func New(timeout time.Duration, now func() time.Time, flows ...Flow) *Machine {
+	if now == nil {
+		now = time.Now
+	}
+	m := &Machine{flows: map[string]*Flow{}, states: map[Key]*state{}, timeout: timeout, now: now}
+	for i := range flows {
+		m.flows[flows[i].Name] = &flows[i]
+	}
+	return m
+}
+
+// Start begins the flow, replacing the conversation the user had in the
+// chat, and returns its first step.
+func (m *Machine) Start(key Key, flow string) (Step, error) {
+	f, ok := m.flows[flow]
+	if !ok || len(f.Steps) == 0 {
+		return Step{}, fmt.Errorf("unknown flow %q", flow)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.expire(now)
+	m.states[key] = &state{flow: f, values: map[string]string{}, updated: now}
+	return f.Steps[0], nil
+}
+
+// Active returns the name of the flow the user is in.
+func (m *Machine) Active(key Key) (string, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.current(key, m.now())
+	if s == nil {
+		return "", false
+	}
+	return s.flow.Name, true
+}
+
+// Answer passes the answer to the current step. A rejected answer returns
+// the error of Parse and keeps the step, so it can be asked again.
+func (m *Machine) Answer(key Key, answer string) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	s := m.current(key, now)
+	if s == nil {
+		return Result{}, fmt.Errorf("no conversation")
+	}
+	s.updated = now
+
+	step := s.flow.Steps[s.step]
+	value := answer
+	if step.Parse != nil {
+		var err error
+		if value, err = step.Parse(answer); err != nil {
+			return Result{Flow: s.flow.Name, Next: &step}, err
+		}
+	}
+	s.values[step.Name] = value
+	s.step++
+
+	if s.step == len(s.flow.Steps) {
+		delete(m.states, key)
+		return Result{Flow: s.flow.Name, Done: true, Values: s.values}, nil
+	}
+	next := s.flow.Steps[s.step]
+	return Result{Flow: s.flow.Name, Next: &next}, nil
+}
+
+// Cancel ends the conversation and reports whether there was one.
+func (m *Machine) Cancel(key Key) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := m.current(key, m.now())
+	delete(m.states, key)
+	return s != nil
+}
+
+// current returns the unexpired state of key, m.mu must be held.
+func (m *Machine) current(key Key, now time.Time) *state {
+	s, ok := m.states[key]
+	if !ok {
+		return nil
+	}
+	if now.Sub(s.updated) >= m.timeout {
+		delete(m.states, key)
+		return nil
+	}
+	return s
+}
+
+// expire forgets abandoned conversations, m.mu must be held.
+func (m *Machine) expire(now time.Time) {
+	for key, s := range m.states {
+		if now.Sub(s.updated) >= m.timeout {
+			delete(m.states, key)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package conversation_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/conversation"
+)
+
+var flow = conversation.Flow{
+	Name: "greet",
+	Steps: []conversation.Step{
+		{Name: "name", Prompt: "Name?"},
+		{Name: "age", Prompt: "Age?", Parse: func(answer string) (string, error) {
+			if answer == "" {
+				return "", errors.New("empty age")
+			}
+			return answer + "y", nil
+		}},
+	},
+}
+
+func TestFlow(t *testing.T) {
+	m := conversation.New(time.Minute, nil, flow)
+	alice := conversation.Key{ChatId: 1, UserId: 10}
+	bob := conversation.Key{ChatId: 1, UserId: 20}
+
+	if _, err := m.Start(alice, "unknown"); err == nil {
+		t.Errorf("Start() of an unknown flow, want error")
+	}
+	step, err := m.Start(alice, "greet")
+	if err != nil || step.Name != "name" {
+		t.Fatalf("Start() = %+v, %v", step, err)
+	}
+	if _, ok := m.Active(bob); ok {
+		t.Errorf("Active() of another user = true")
+	}
+	if name, ok := m.Active(alice); !ok || name != "greet" {
+		t.Errorf("Active() = %q, %v", name, ok)
+	}
+
+	result, err := m.Answer(alice, "Alice")
+	if err != nil || result.Done || result.Next == nil || result.Next.Name != "age" {
+		t.Fatalf("Answer() = %+v, %v, want the age step", result, err)
+	}
+	result, err = m.Answer(alice, "")
+	if err == nil || result.Next == nil || result.Next.Name != "age" {
+		t.Fatalf("Answer() of an invalid age = %+v, %v, want the age step again", result, err)
+	}
+	result, err = m.Answer(alice, "30")
+	if err != nil || !result.Done || result.Flow != "greet" {
+		t.Fatalf("Answer() = %+v, %v, want done", result, err)
+	}
+	if want := map[string]string{"name": "Alice", "age": "30y"}; !reflect.DeepEqual(result.Values, want) {
+		t.Errorf("Values = %v, want %v", result.Values, want)
+	}
+	if _, ok := m.Active(alice); ok {
+		t.Errorf("Active() after the last step = true")
+	}
+	if _, err := m.Answer(alice, "again"); err == nil {
+		t.Errorf("Answer() without a conversation, want error")
+	}
+}
+
+func TestCancelAndTimeout(t *testing.T) {
+	now := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	m := conversation.New(time.Minute, func() time.Time { return now }, flow)
+	key := conversation.Key{ChatId: 1, UserId: 10}
+
+	if _, err := m.Start(key, "greet"); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Cancel(key) || m.Cancel(key) {
+		t.Errorf("Cancel() should report the conversation once")
+	}
+
+	if _, err := m.Start(key, "greet"); err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	if _, ok := m.Active(key); !ok {
+		t.Errorf("Active() before the timeout = false")
+	}
+	now = now.Add(time.Minute)
+	if _, ok := m.Active(key); ok {
+		t.Errorf("Active() after the timeout = true")
+	}
+	if m.Cancel(key) {
+		t.Errorf("Cancel() of an expired conversation = true")
+	}
+}
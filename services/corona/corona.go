@@ -2,7 +2,10 @@ package corona
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/services/money"
 	"io"
 	"log"
 	"net/http"
@@ -37,27 +40,44 @@ type ResponseBody struct {
 		Name string `json:"name"`
 	} `json:"receivingCurrency"`
 	ReceivingAmount      int                    `json:"receivingAmount"`
-	ExchangeRate         float64                `json:"exchangeRate"`
+	ExchangeRate         money.Decimal          `json:"exchangeRate"`
 	ExchangeRateType     string                 `json:"exchangeRateType"`
 	ExchangeRateDiscount int                    `json:"exchangeRateDiscount"`
 	Profit               int                    `json:"profit"`
 	Properties           map[string]interface{} `json:"properties"`
 }
 
-func GetRates() map[string]string {
-	result := map[string]string{}
+type Service struct {
+	client *httpclient.Client
+	apiUrl string
+}
+
+// NewService creates a provider calling apiUrl, which is ApiUrl in production.
+func NewService(client *httpclient.Client, apiUrl string) *Service {
+	return &Service{client: client, apiUrl: apiUrl}
+}
 
-	if rubUsd, err := getRate(RUB, USD); err == nil {
-		result["USD"] = rubUsd
+// GetRates returns the rates it managed to fetch along with the errors of the failed ones.
+func (s *Service) GetRates() (map[string]money.Rate, error) {
+	result := map[string]money.Rate{}
+	var errs []error
+
+	if rubUsd, err := s.getRate(RUB, USD); err == nil {
+		result["USD"] = money.Rate{From: "USD", To: money.Base, Value: rubUsd}
+	} else {
+		errs = append(errs, err)
 	}
-	if rubGel, err := getRate(RUB, GEL); err == nil {
-		result["GEL"] = rubGel
+	if rubGel, err := s.getRate(RUB, GEL); err == nil {
+		result["GEL"] = money.Rate{From: "GEL", To: money.Base, Value: rubGel}
+	} else {
+		errs = append(errs, err)
 	}
 
-	return result
+	return result, errors.Join(errs...)
 }
 
-func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
+// getRate returns the price of outCurrencyCode paid in inCurrencyCode.
+func (s *Service) getRate(inCurrencyCode string, outCurrencyCode string) (money.Decimal, error) {
 	params := url.Values{}
 	params.Add("sendingCurrencyId", inCurrencyCode)
 	params.Add("receivingCurrencyId", outCurrencyCode)
@@ -68,11 +88,11 @@ func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
 	params.Add("receivingMethod", "cash")
 	params.Add("sendingCountryId", "RUS")
 
-	req, err := http.NewRequest("GET", ApiUrl, nil)
+	req, err := http.NewRequest("GET", s.apiUrl, nil)
 
 	if err != nil {
 		log.Printf("failed to create request %v", err)
-		return "", fmt.Errorf("failed to create request: %s", err)
+		return money.Decimal{}, fmt.Errorf("failed to create request: %s", err)
 	}
 
 	req.URL.RawQuery = params.Encode()
@@ -86,12 +106,11 @@ func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
 	req.Header.Add("accept-language", "en")
 	req.Header.Add("ssr-fetch-site", "same-origin")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 
 	if err != nil {
 		log.Printf("failed to send request: %v", err)
-		return "", fmt.Errorf("failed to send request: %s", err)
+		return money.Decimal{}, fmt.Errorf("failed to send request: %w", err)
 	}
 
 	defer func(Body io.ReadCloser) {
@@ -103,15 +122,20 @@ func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("failed to fetch exchange rate %v", resp.Status)
-		return "", fmt.Errorf("failed to fetch exchange rate: %s", resp.Status)
+		return money.Decimal{}, fmt.Errorf("failed to fetch exchange rate: %s", resp.Status)
 	}
 
 	var jsonResp []ResponseBody
 
 	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
 		log.Printf("failed to decode response: %v", err)
-		return "", err
+		return money.Decimal{}, err
+	}
+
+	if len(jsonResp) == 0 {
+		log.Printf("no tariffs in response")
+		return money.Decimal{}, fmt.Errorf("no tariffs for %s => %s", inCurrencyCode, outCurrencyCode)
 	}
 
-	return fmt.Sprintf("%.5f", jsonResp[0].ExchangeRate), nil
+	return jsonResp[0].ExchangeRate, nil
 }
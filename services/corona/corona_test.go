@@ -0,0 +1,73 @@
+package corona_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/corona"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/testing/fakes"
+)
+
+func TestGetRatesRecorded(t *testing.T) {
+	server := fakes.NewCorona()
+	defer server.Close()
+
+	rates, err := corona.NewService(fakes.NewHttpClient(), server.ApiUrl).GetRates()
+	if err != nil {
+		t.Fatalf("GetRates() error = %v", err)
+	}
+
+	want := map[string]string{"USD": "92.83", "GEL": "35.91"}
+	if len(rates) != len(want) {
+		t.Errorf("GetRates() = %v, want %v", rates, want)
+	}
+	for currency, rate := range want {
+		if got := rates[currency]; got.Value.String() != rate || got.From != currency || got.To != "RUB" {
+			t.Errorf("rates[%s] = %s, want %s in RUB", currency, got, rate)
+		}
+	}
+
+	for _, req := range server.Requests() {
+		if got := req.Query.Get("sendingCurrencyId"); got != corona.RUB {
+			t.Errorf("sendingCurrencyId = %q, want %q", got, corona.RUB)
+		}
+		if got := req.Header.Get("accept"); got != "application/vnd.cft-data.v2.99+json" {
+			t.Errorf("accept = %q", got)
+		}
+	}
+}
+
+func TestGetRatesFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		scenario   fakes.Scenario
+		statusCode int
+	}{
+		{name: "empty tariffs", scenario: fakes.Empty},
+		{name: "malformed body", scenario: fakes.Malformed},
+		{name: "server error", scenario: fakes.ServerError, statusCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakes.NewCorona()
+			defer server.Close()
+			server.SetScenario(tt.scenario)
+
+			rates, err := corona.NewService(fakes.NewHttpClient(), server.ApiUrl).GetRates()
+			if err == nil {
+				t.Fatalf("GetRates() error = nil, rates = %v", rates)
+			}
+			if len(rates) != 0 {
+				t.Errorf("GetRates() rates = %v, want none", rates)
+			}
+
+			var statusErr *httpclient.StatusError
+			if tt.statusCode != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.statusCode) {
+				t.Errorf("GetRates() error = %v, want status %d", err, tt.statusCode)
+			}
+		})
+	}
+}
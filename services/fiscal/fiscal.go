@@ -0,0 +1,128 @@
+package fiscal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+var (
+	ErrNoCode    = errors.New("no QR code found")
+	ErrNotFiscal = errors.New("QR code is not a fiscal receipt")
+)
+
+// timeLayouts are the forms of the t parameter, seconds are optional.
+var timeLayouts = []string{"20060102T150405", "20060102T1504"}
+
+// Receipt is the data of the QR code printed on Russian fiscal receipts,
+// e.g. "t=20260915T1345&s=1234.50&fn=9999078900004792&i=12345&fp=3522207165&n=1".
+type Receipt struct {
+	Time time.Time
+	// Total is the sum of the receipt in rubles.
+	Total money.Decimal
+	// FN, FD and FP are the fiscal drive number, document number and
+	// fiscal sign identifying the receipt.
+	FN string
+	FD string
+	FP string
+	// Kind is the operation type, see Income.
+	Kind int
+}
+
+// Operation types of the n parameter. The customer pays on Income and
+// OutcomeReturn, and receives money on IncomeReturn and Outcome.
+const (
+	Income = iota + 1
+	IncomeReturn
+	Outcome
+	OutcomeReturn
+)
+
+// Refund reports whether the customer received the total rather than
+// paid it.
+func (r Receipt) Refund() bool {
+	return r.Kind == IncomeReturn || r.Kind == Outcome
+}
+
+// Amount is the total the customer spent, negative for refunds.
+func (r Receipt) Amount() money.Decimal {
+	if r.Refund() {
+		return r.Total.Neg()
+	}
+	return r.Total
+}
+
+// Kopecks returns the amount in kopecks.
+func (r Receipt) Kopecks() int64 {
+	return r.Amount().Minor(2)
+}
+
+// Parse reads the text of a fiscal QR code, the receipt time has no zone
+// and is taken in location.
+func Parse(text string, location *time.Location) (Receipt, error) {
+	values, err := url.ParseQuery(strings.TrimSpace(text))
+	if err != nil || values.Get("t") == "" || values.Get("s") == "" || values.Get("fn") == "" {
+		return Receipt{}, ErrNotFiscal
+	}
+
+	var r Receipt
+	for _, layout := range timeLayouts {
+		if r.Time, err = time.ParseInLocation(layout, values.Get("t"), location); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return Receipt{}, fmt.Errorf("%w: invalid time %q", ErrNotFiscal, values.Get("t"))
+	}
+
+	r.Total, err = money.Parse(values.Get("s"))
+	if err != nil || r.Total.Sign() <= 0 {
+		return Receipt{}, fmt.Errorf("%w: invalid total %q", ErrNotFiscal, values.Get("s"))
+	}
+
+	r.FN, r.FD, r.FP = values.Get("fn"), values.Get("i"), values.Get("fp")
+	if n := values.Get("n"); n != "" {
+		if r.Kind, err = strconv.Atoi(n); err != nil || r.Kind < Income || r.Kind > OutcomeReturn {
+			return Receipt{}, fmt.Errorf("%w: invalid operation type %q", ErrNotFiscal, n)
+		}
+	}
+	return r, nil
+}
+
+// Decode finds a QR code in img and returns its text.
+func Decode(img image.Image) (string, error) {
+	bitmap, err := gozxing.NewBinaryBitmapFromImage(img)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %s", err)
+	}
+	hints := map[gozxing.DecodeHintType]interface{}{gozxing.DecodeHintType_TRY_HARDER: true}
+	result, err := qrcode.NewQRCodeReader().Decode(bitmap, hints)
+	if err != nil {
+		return "", ErrNoCode
+	}
+	return result.GetText(), nil
+}
+
+// Scan decodes the fiscal QR code on a JPEG or PNG photo of a receipt.
+func Scan(data []byte, location *time.Location) (Receipt, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Receipt{}, fmt.Errorf("failed to decode image: %s", err)
+	}
+	text, err := Decode(img)
+	if err != nil {
+		return Receipt{}, err
+	}
+	return Parse(text, location)
+}
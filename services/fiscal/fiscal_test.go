@@ -0,0 +1,79 @@
+package fiscal_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/fiscal"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/testing/fakes"
+)
+
+func TestParse(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+
+	r, err := fiscal.Parse("t=20260915T1345&s=1234.50&fn=9999078900004792&i=12345&fp=3522207165&n=1", moscow)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	want := fiscal.Receipt{Time: time.Date(2026, 9, 15, 13, 45, 0, 0, moscow), Total: money.MustParse("1234.5"), FN: "9999078900004792", FD: "12345", FP: "3522207165", Kind: 1}
+	if r != want {
+		t.Errorf("Parse() = %+v, want %+v", r, want)
+	}
+	if r.Kopecks() != 123450 {
+		t.Errorf("Kopecks() = %d", r.Kopecks())
+	}
+
+	r, err = fiscal.Parse("t=20260915T134512&s=99&fn=1", time.UTC)
+	if err != nil || !r.Time.Equal(time.Date(2026, 9, 15, 13, 45, 12, 0, time.UTC)) {
+		t.Errorf("Parse() with seconds = %+v, %v", r, err)
+	}
+
+	// the customer receives money on a return of income and on outcome
+	for _, n := range []string{"2", "3"} {
+		r, err = fiscal.Parse("t=20260915T1345&s=99.90&fn=1&n="+n, time.UTC)
+		if err != nil || !r.Refund() || r.Amount().String() != "-99.9" || r.Kopecks() != -9990 {
+			t.Errorf("Parse() of a refund with n=%s = %+v, %v, want a negative amount", n, r, err)
+		}
+	}
+	// and pays on a return of outcome
+	r, err = fiscal.Parse("t=20260915T1345&s=99.90&fn=1&n=4", time.UTC)
+	if err != nil || r.Refund() || r.Amount().String() != "99.9" {
+		t.Errorf("Parse() with n=4 = %+v, %v, want a positive amount", r, err)
+	}
+
+	for _, text := range []string{"", "https://example.com", "t=20260915T1345&s=12", "t=yesterday&s=12&fn=1", "t=20260915T1345&s=-5&fn=1", "t=20260915T1345&s=5&fn=1&n=7"} {
+		if _, err := fiscal.Parse(text, time.UTC); !errors.Is(err, fiscal.ErrNotFiscal) {
+			t.Errorf("Parse(%q) error = %v, want ErrNotFiscal", text, err)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	photo, err := fakes.ReceiptPhoto("t=20260915T1345&s=2300.00&fn=9999078900004792&i=1&fp=2&n=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := fiscal.Scan(photo, time.UTC)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if r.Total.Cmp(money.MustParse("2300")) != 0 || !r.Time.Equal(time.Date(2026, 9, 15, 13, 45, 0, 0, time.UTC)) {
+		t.Errorf("Scan() = %+v", r)
+	}
+
+	plain, err := fakes.ReceiptPhoto("hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fiscal.Scan(plain, time.UTC); !errors.Is(err, fiscal.ErrNotFiscal) {
+		t.Errorf("Scan() of another QR code error = %v, want ErrNotFiscal", err)
+	}
+	if _, err := fiscal.Scan([]byte("not an image"), time.UTC); err == nil {
+		t.Errorf("Scan() of garbage, want error")
+	}
+}
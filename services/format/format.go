@@ -0,0 +1,129 @@
+package format
+
+import (
+	"strings"
+
+	"github.com/kn9ka/fundbot-go/services/money"
+)
+
+// Locale is how numbers are written in a language.
+type Locale struct {
+	Decimal string
+	Group   string
+	// SymbolFirst puts the currency symbol before the number, "₽12.00"
+	// rather than "12,00 ₽".
+	SymbolFirst bool
+}
+
+var (
+	russian = Locale{Decimal: ",", Group: " "}
+	english = Locale{Decimal: ".", Group: ",", SymbolFirst: true}
+)
+
+// For returns the locale of a language code such as "en" or "en-US",
+// Russian for the rest.
+func For(lang string) Locale {
+	lang = strings.ToLower(lang)
+	if lang == "en" || strings.HasPrefix(lang, "en-") || strings.HasPrefix(lang, "en_") {
+		return english
+	}
+	return russian
+}
+
+var symbols = map[string]string{
+	"RUB": "₽",
+	"USD": "$",
+	"EUR": "€",
+	"GEL": "₾",
+	"GBP": "£",
+	"JPY": "¥",
+	"TRY": "₺",
+	"KZT": "₸",
+	"AMD": "֏",
+}
+
+// Symbol returns the sign of currency, or its code when it has none.
+func Symbol(currency string) string {
+	currency = strings.ToUpper(currency)
+	if currency == "" {
+		currency = money.Base
+	}
+	if symbol, ok := symbols[currency]; ok {
+		return symbol
+	}
+	return currency
+}
+
+// precisions lists currencies whose minor unit is not a hundredth.
+var precisions = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+	"IDR": 0,
+	"KWD": 3,
+	"BHD": 3,
+	"OMR": 3,
+}
+
+// Precision is the number of decimals amounts in currency are shown with.
+func Precision(currency string) int {
+	if precision, ok := precisions[strings.ToUpper(currency)]; ok {
+		return precision
+	}
+	return 2
+}
+
+// Number writes value rounded to precision decimals with grouped
+// thousands.
+func (l Locale) Number(value money.Decimal, precision int) string {
+	digits := value.Fixed(precision)
+	negative := strings.HasPrefix(digits, "-")
+	digits = strings.TrimPrefix(digits, "-")
+	whole, fraction := digits, ""
+	if i := strings.IndexByte(digits, '.'); i >= 0 {
+		whole, fraction = digits[:i], digits[i+1:]
+	}
+
+	var b strings.Builder
+	if negative {
+		b.WriteByte('-')
+	}
+	for i, digit := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(l.Group)
+		}
+		b.WriteRune(digit)
+	}
+	if fraction != "" {
+		b.WriteString(l.Decimal)
+		b.WriteString(fraction)
+	}
+	return b.String()
+}
+
+// Amount writes a, e.g. "12 345,67 ₽" or "₽12,345.67".
+func (l Locale) Amount(a money.Amount) string {
+	return l.withSymbol(l.Number(a.Value, Precision(a.Code())), a.Code())
+}
+
+// Rate writes the price of one r.From in r.To. Rates keep two decimals
+// whatever the currency, yen included.
+func (l Locale) Rate(r money.Rate) string {
+	return l.withSymbol(l.Number(r.Value, 2), r.To)
+}
+
+func (l Locale) withSymbol(number string, currency string) string {
+	symbol := Symbol(currency)
+	if !l.SymbolFirst {
+		return number + " " + symbol
+	}
+	sign := ""
+	if strings.HasPrefix(number, "-") {
+		sign, number = "-", number[1:]
+	}
+	if len(symbol) > 1 && symbol == strings.ToUpper(currency) {
+		// codes need a space to stay readable, "USD 12.00"
+		symbol += " "
+	}
+	return sign + symbol + number
+}
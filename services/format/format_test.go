@@ -0,0 +1,43 @@
+package format_test
+
+import (
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/format"
+	"github.com/kn9ka/fundbot-go/services/money"
+)
+
+func TestAmount(t *testing.T) {
+	for _, tc := range []struct {
+		lang     string
+		value    string
+		currency string
+		want     string
+	}{
+		{"ru", "12345.67", "RUB", "12 345,67 ₽"},
+		{"en", "12345.67", "RUB", "₽12,345.67"},
+		{"ru", "120", "", "120,00 ₽"},
+		{"en-US", "1250.5", "usd", "$1,250.50"},
+		{"ru", "1234567.891", "EUR", "1 234 567,89 €"},
+		{"en", "1500", "JPY", "¥1,500"},
+		{"ru", "1.2345", "KWD", "1,235 KWD"},
+		{"en", "1.2345", "KWD", "KWD 1.235"},
+		{"en", "-42.5", "GEL", "-₾42.50"},
+		{"ru", "-0.001", "", "0,00 ₽"},
+		{"", "999.999", "", "1 000,00 ₽"},
+	} {
+		a := money.Amount{Value: money.MustParse(tc.value), Currency: tc.currency}
+		if got := format.For(tc.lang).Amount(a); got != tc.want {
+			t.Errorf("Amount(%s, %v, %q) = %q, want %q", tc.lang, tc.value, tc.currency, got, tc.want)
+		}
+	}
+}
+
+func TestRate(t *testing.T) {
+	if got := format.For("ru").Rate(money.Rate{From: "USD", To: money.Base, Value: money.MustParse("92.4135")}); got != "92,41 ₽" {
+		t.Errorf("Rate() = %q", got)
+	}
+	if got := format.For("en").Rate(money.Rate{From: "RUB", To: "USD", Value: money.MustParse("0.0108")}); got != "$0.01" {
+		t.Errorf("Rate() = %q", got)
+	}
+}
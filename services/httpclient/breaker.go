@@ -0,0 +1,68 @@
+package httpclient
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker counts consecutive failures of a single host. Once the threshold
+// is reached it rejects requests for the cooldown period and then lets a
+// single probe through: its success closes the breaker, a failure reopens it.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a request may be sent, otherwise it returns the time
+// the breaker stays open until.
+func (b *breaker) allow(now time.Time) (bool, time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true, time.Time{}
+	}
+	if now.Before(b.openUntil) || b.probing {
+		return false, b.openUntil
+	}
+
+	b.probing = true
+	return true, time.Time{}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *breaker) failure(now time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	if b.failures >= b.threshold {
+		b.openUntil = now.Add(b.cooldown)
+	}
+}
+
+// release ends a probe that neither proved the host healthy nor failed, e.g.
+// one rejected with a 4xx status.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
@@ -0,0 +1,60 @@
+package httpclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrCircuitOpen is wrapped by CircuitOpenError, use errors.Is to detect a
+// provider that is known to be down.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+type CircuitOpenError struct {
+	Host  string
+	Until time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("%s: %s until %s", e.Host, ErrCircuitOpen, e.Until.Format(time.RFC3339))
+}
+
+func (e *CircuitOpenError) Unwrap() error {
+	return ErrCircuitOpen
+}
+
+// StatusError is returned for responses with a 4xx or 5xx status code,
+// after retries were exhausted for the retryable ones.
+type StatusError struct {
+	Host       string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s responded with %s", e.Host, e.Status)
+}
+
+// Temporary reports whether the request may succeed if sent later.
+func (e *StatusError) Temporary() bool {
+	return retryableStatus(e.StatusCode)
+}
+
+// RequestError is returned when no response was received at all.
+type RequestError struct {
+	Host string
+	Err  error
+}
+
+func (e *RequestError) Error() string {
+	return fmt.Sprintf("request to %s failed: %s", e.Host, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
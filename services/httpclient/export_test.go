@@ -0,0 +1,10 @@
+package httpclient
+
+import "time"
+
+// SetClock replaces the time source of the breakers and the delay retries
+// back off from, so tests neither sleep nor wait for cooldowns.
+func (c *Client) SetClock(now func() time.Time, baseDelay time.Duration) {
+	c.now = now
+	c.baseDelay = baseDelay
+}
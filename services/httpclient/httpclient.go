@@ -0,0 +1,230 @@
+package httpclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/config"
+)
+
+const (
+	baseRetryDelay = 500 * time.Millisecond
+	// maxRetryDelay caps the wait between attempts, a longer Retry-After
+	// fails the request right away instead of blocking the handler.
+	maxRetryDelay = 30 * time.Second
+)
+
+// idempotencyHeaders mark a request that is safe to send twice whatever its
+// method, the same convention net/http follows.
+var idempotencyHeaders = []string{"Idempotency-Key", "X-Idempotency-Key"}
+
+// Client is the HTTP client shared by every outbound integration. It applies
+// a timeout to each attempt, retries 429 responses and 5xx responses of
+// idempotent requests and keeps a circuit breaker per host.
+type Client struct {
+	http       *http.Client
+	maxRetries int
+	threshold  int
+	cooldown   time.Duration
+	baseDelay  time.Duration
+	now        func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+func New(cfg config.Http) *Client {
+	return &Client{
+		http:       &http.Client{Timeout: cfg.Timeout},
+		maxRetries: cfg.MaxRetries,
+		threshold:  cfg.BreakerThreshold,
+		cooldown:   cfg.BreakerCooldown,
+		baseDelay:  baseRetryDelay,
+		now:        time.Now,
+		breakers:   map[string]*breaker{},
+	}
+}
+
+// Do sends req, retrying it if needed. A 429 means the server did not act on
+// the request, so it is retried whatever the method. Other failures are only
+// retried for idempotent methods, other requests opt in with MarkIdempotent
+// or an Idempotency-Key header. The request body must
+// be rewindable, which is the case for bodies created from bytes or strings.
+// Unlike http.Client, any 4xx or 5xx response is returned as *StatusError
+// with its body already closed.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	host := req.URL.Host
+	b := c.breaker(host)
+	maxRetries := c.maxRetries
+	if !idempotent(req) {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		if ok, until := b.allow(c.now()); !ok {
+			return nil, &CircuitOpenError{Host: host, Until: until}
+		}
+
+		resp, err := c.http.Do(req)
+		if err != nil {
+			b.failure(c.now())
+			err = &RequestError{Host: host, Err: err}
+			if req.Context().Err() != nil || attempt >= maxRetries {
+				return nil, err
+			}
+			log.Printf("%v, retrying", err)
+			if err := c.wait(req.Context(), c.backoff(attempt)); err != nil {
+				return nil, err
+			}
+		} else if resp.StatusCode < http.StatusBadRequest {
+			b.success()
+			return resp, nil
+		} else {
+			statusErr := &StatusError{Host: host, StatusCode: resp.StatusCode, Status: resp.Status}
+			retries := maxRetries
+			if resp.StatusCode == http.StatusTooManyRequests {
+				retries = c.maxRetries
+			}
+			delay, retry := c.retryDelay(resp, attempt, retries)
+			drain(resp.Body)
+
+			// the host is up when it rejects the request itself, but that
+			// says nothing about whether it is healthy again
+			if retryableStatus(resp.StatusCode) {
+				b.failure(c.now())
+			} else {
+				b.release()
+			}
+			if !retry {
+				return nil, statusErr
+			}
+			log.Printf("%v, retrying in %v", statusErr, delay)
+			if err := c.wait(req.Context(), delay); err != nil {
+				return nil, err
+			}
+		}
+
+		if req, err = rewind(req); err != nil {
+			return nil, &RequestError{Host: host, Err: err}
+		}
+	}
+}
+
+func (c *Client) breaker(host string) *breaker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	b, ok := c.breakers[host]
+	if !ok {
+		b = newBreaker(c.threshold, c.cooldown)
+		c.breakers[host] = b
+	}
+	return b
+}
+
+func (c *Client) retryDelay(resp *http.Response, attempt int, maxRetries int) (time.Duration, bool) {
+	if !retryableStatus(resp.StatusCode) || attempt >= maxRetries {
+		return 0, false
+	}
+
+	delay := c.backoff(attempt)
+	if after, ok := parseRetryAfter(resp.Header.Get("Retry-After"), c.now()); ok {
+		delay = after
+	}
+	if delay > maxRetryDelay {
+		return 0, false
+	}
+	return delay, true
+}
+
+func (c *Client) wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) backoff(attempt int) time.Duration {
+	delay := c.baseDelay << attempt
+	if delay > maxRetryDelay || delay <= 0 {
+		return maxRetryDelay
+	}
+	return delay
+}
+
+// MarkIdempotent lets Do retry req whatever its method, for requests that
+// only read such as quotes asked for with a POST. It sets an
+// Idempotency-Key header, which every attempt is sent with.
+func MarkIdempotent(req *http.Request) {
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		// the key only has to be present for Do, servers ignoring it are fine
+		log.Printf("Unable to generate an idempotency key: %v", err)
+	}
+	req.Header.Set(idempotencyHeaders[0], hex.EncodeToString(key))
+}
+
+// idempotent reports whether req may be sent again after a failure that may
+// have happened after the server acted on it.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	for _, name := range idempotencyHeaders {
+		if _, ok := req.Header[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRetryAfter supports both the delay-seconds and the HTTP-date forms.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := date.Sub(now); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func rewind(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next := req.Clone(req.Context())
+	next.Body = body
+	return next, nil
+}
+
+func drain(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, 64<<10))
+	if err := body.Close(); err != nil {
+		log.Printf("Unable to close response body: %v", err)
+	}
+}
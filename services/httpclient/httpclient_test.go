@@ -0,0 +1,229 @@
+package httpclient_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/config"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+)
+
+// server answers requests with the scripted statuses in order, repeating the
+// last one, and counts them.
+type server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	statuses []int
+	header   http.Header
+	requests int
+}
+
+func newServer(t *testing.T, header http.Header, statuses ...int) *server {
+	s := &server{statuses: statuses, header: header}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		status := s.statuses[len(s.statuses)-1]
+		if s.requests < len(s.statuses) {
+			status = s.statuses[s.requests]
+		}
+		s.requests++
+		s.mu.Unlock()
+
+		for name, values := range s.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *server) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+// clock is a manual time source for the breakers.
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func newClient(c *clock, maxRetries, threshold int) *httpclient.Client {
+	client := httpclient.New(config.Http{
+		Timeout:          time.Second,
+		MaxRetries:       maxRetries,
+		BreakerThreshold: threshold,
+		BreakerCooldown:  time.Minute,
+	})
+	client.SetClock(c.Now, time.Millisecond)
+	return client
+}
+
+func request(t *testing.T, method, url string, header http.Header) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, url, strings.NewReader("a=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	return req
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		header       http.Header
+		response     http.Header
+		statuses     []int
+		wantRequests int
+		wantStatus   int
+	}{
+		{name: "get succeeds after 5xx", method: http.MethodGet, statuses: []int{503, 502, 200}, wantRequests: 3},
+		{name: "get gives up after max retries", method: http.MethodGet, statuses: []int{500}, wantRequests: 3, wantStatus: 500},
+		{name: "429 is retried", method: http.MethodGet, statuses: []int{429, 200}, wantRequests: 2},
+		{name: "4xx is not retried", method: http.MethodGet, statuses: []int{404}, wantRequests: 1, wantStatus: 404},
+		{name: "post is not retried", method: http.MethodPost, statuses: []int{503, 200}, wantRequests: 1, wantStatus: 503},
+		{
+			name: "post getting 429 with retry after is retried", method: http.MethodPost,
+			response: http.Header{"Retry-After": {"0"}},
+			statuses: []int{429, 200}, wantRequests: 2,
+		},
+		{
+			name: "post with an idempotency key is retried", method: http.MethodPost,
+			header:   http.Header{"Idempotency-Key": {"42"}},
+			statuses: []int{503, 200}, wantRequests: 2,
+		},
+		{
+			name: "retry after is honoured", method: http.MethodGet,
+			response: http.Header{"Retry-After": {"0"}},
+			statuses: []int{429, 200}, wantRequests: 2,
+		},
+		{
+			name: "long retry after fails right away", method: http.MethodGet,
+			response: http.Header{"Retry-After": {"3600"}},
+			statuses: []int{503, 200}, wantRequests: 1, wantStatus: 503,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(t, tt.response, tt.statuses...)
+			client := newClient(&clock{now: time.Now()}, 2, 10)
+
+			resp, err := client.Do(request(t, tt.method, s.URL, tt.header))
+			if tt.wantStatus == 0 {
+				if err != nil {
+					t.Fatalf("Do() error = %v", err)
+				}
+				resp.Body.Close()
+			} else {
+				var statusErr *httpclient.StatusError
+				if !errors.As(err, &statusErr) || statusErr.StatusCode != tt.wantStatus {
+					t.Fatalf("Do() error = %v, want status %d", err, tt.wantStatus)
+				}
+			}
+			if got := s.count(); got != tt.wantRequests {
+				t.Errorf("requests = %d, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func TestMarkIdempotent(t *testing.T) {
+	s := newServer(t, nil, 503, 200)
+	client := newClient(&clock{now: time.Now()}, 2, 10)
+
+	req := request(t, http.MethodPost, s.URL, nil)
+	httpclient.MarkIdempotent(req)
+	if req.Header.Get("Idempotency-Key") == "" {
+		t.Fatalf("headers = %v, want an idempotency key", req.Header)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+	resp.Body.Close()
+	if got := s.count(); got != 2 {
+		t.Errorf("requests = %d, want the post retried", got)
+	}
+}
+
+func TestRequestErrorIsRetriedForIdempotentRequests(t *testing.T) {
+	s := newServer(t, nil, 200)
+	url := s.URL
+	s.Close()
+	client := newClient(&clock{now: time.Now()}, 1, 10)
+
+	var requestErr *httpclient.RequestError
+	if _, err := client.Do(request(t, http.MethodGet, url, nil)); !errors.As(err, &requestErr) {
+		t.Errorf("Do() error = %v, want *RequestError", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	s := newServer(t, nil, 500, 404, 500, 500, 200)
+	c := &clock{now: time.Now()}
+	client := newClient(c, 0, 2)
+
+	do := func() error {
+		resp, err := client.Do(request(t, http.MethodGet, s.URL, nil))
+		if err == nil {
+			resp.Body.Close()
+		}
+		return err
+	}
+
+	_ = do()
+	// a 4xx neither counts as a failure nor resets the count
+	if err := do(); errors.Is(err, httpclient.ErrCircuitOpen) {
+		t.Fatalf("Do() error = %v before the threshold", err)
+	}
+	_ = do()
+
+	if err := do(); !errors.Is(err, httpclient.ErrCircuitOpen) {
+		t.Fatalf("Do() error = %v, want an open circuit after 2 failures", err)
+	}
+	if got := s.count(); got != 3 {
+		t.Errorf("requests = %d, want none while the circuit is open", got)
+	}
+
+	// after the cooldown a failed probe opens the circuit again
+	c.advance(time.Minute)
+	if err := do(); err == nil || errors.Is(err, httpclient.ErrCircuitOpen) {
+		t.Errorf("probe error = %v, want the 500 of the server", err)
+	}
+	if err := do(); !errors.Is(err, httpclient.ErrCircuitOpen) {
+		t.Errorf("Do() error = %v, want the circuit open again", err)
+	}
+
+	// a successful probe closes it
+	c.advance(time.Minute)
+	if err := do(); err != nil {
+		t.Errorf("probe error = %v", err)
+	}
+	if err := do(); err != nil {
+		t.Errorf("Do() error = %v, want the circuit closed", err)
+	}
+}
@@ -0,0 +1,190 @@
+package i18n
+
+var en = map[Key]string{
+	CmdStart:      "Available commands",
+	CmdList:       "Debts, /list month for a period",
+	CmdAdd:        "Add an expense step by step",
+	CmdCancel:     "Stop the current command",
+	CmdRates:      "Exchange rates",
+	CmdPending:    "Expenses waiting to be synced",
+	CmdReport:     "Expense report with a chart for a month or period",
+	CmdCategories: "Categories and keywords",
+	CmdSchedule:   "Regular summaries, rates and reminders",
+	CmdExport:     "Export expenses as CSV or XLSX",
+	CmdImport:     "Import expenses from a CSV file",
+	CmdReceipt:    "Receipt photo of an expense",
+	CmdDoctor:     "Errors in the table",
+	CmdAdmin:      "Access lists, for admins",
+	CmdLang:       "Bot language",
+
+	Help: "/list - for list active debts, /list month or /list 2026-09 for a period\n" +
+		"/add - for adding an expense step by step, /cancel to stop\n" +
+		"/rates - for exchange RUB => USD/EUR/GEL rates\n" +
+		"/report - for expenses by person and category with a chart, /report 2026-09 for a period\n" +
+		"/categories - for categories and their keywords, add #category to an expense to set it\n" +
+		"/schedule - for regular debt summaries, rates and reminders in this chat\n" +
+		"/export - for expenses as a file, /export month xlsx for a period and format\n" +
+		"/import - for adding expenses from a CSV file\n" +
+		"/receipt - for the receipt photo of an expense, send a photo with a caption like \"2300 groceries\" to save one\n" +
+		"/pending - for expenses waiting to be synced\n" +
+		"/doctor - for malformed rows in the table\n" +
+		"/admin - for managing allowed chats, users and admins\n" +
+		"/lang - for the bot language, /lang ru for Russian",
+	UnknownCommand: "Unknown command, see /start",
+	NothingFound:   "Nothing found",
+	SaveError:      "Could not save, an error occurred",
+	SaveLater:      "Could not save, try again later",
+	PeriodError:    "Unknown period “%s”, examples: today, week, month, year, 2026, 2026-09 or 2026-09-15",
+	ForPeriod:      " for %s",
+	AndMore:        "…and %d more\n",
+	LangUsage:      "Language: %s\nChange it: /lang ru or /lang en",
+	LangChanged:    "I will answer in English",
+	LangName:       "English",
+
+	PeriodWeek:  "the week of %s",
+	PeriodMonth: "%s %d",
+	PeriodYear:  "%d",
+	January:     "January",
+	February:    "February",
+	March:       "March",
+	April:       "April",
+	May:         "May",
+	June:        "June",
+	July:        "July",
+	August:      "August",
+	September:   "September",
+	October:     "October",
+	November:    "November",
+	December:    "December",
+
+	Saved:          "Saved: %s",
+	SavedReceipt:   "\nReceipt: /receipt %d",
+	Queued:         "The table is unavailable, saved locally to sync later: %s",
+	ExpiredButton:  "The button has expired",
+	UndoButton:     "Undo",
+	UndoNotAuthor:  "Only the author or an admin can undo an expense",
+	UndoExpired:    "Too late to undo",
+	UndoFailed:     "Could not undo, try again later",
+	ExpenseMissing: "Expense not found",
+	Undone:         "Undone",
+	UndoneExpense:  "Undone: %s",
+
+	ListTitle:        "<b>For %s</b>\n",
+	SettleButton:     "Settle: %s",
+	NoActiveDebts:    "%s has no active debts",
+	SettleFailed:     "Could not settle, try again later",
+	Settled:          "Settled with %s: %s",
+	ReportTitle:      "<b>Expenses for %s</b>: %s",
+	ReportPrevious:   " (%s vs %s: %s)",
+	ReportByUser:     "\n\n<b>By person</b>\n",
+	ReportByCategory: "\n<b>By category</b>\n",
+	NoCategory:       "Uncategorized",
+	ChartTitle:       "Expenses for %s: %s",
+	OfficialRate:     "official rate",
+	Unavailable:      "<i>Temporarily unavailable: %s</i>\n",
+
+	CategoriesUsage: "Add: /categories add Transport: taxi, uber\nRemove a keyword or category: /categories remove uber",
+	NoCategories:    "No categories yet\n",
+	CategoryAdded:   "Category “%s”: %s",
+	NotFound:        "“%s” not found",
+	Deleted:         "Removed “%s”",
+	AllSynced:       "All expenses are synced",
+	PendingTitle:    "Waiting to be synced: %d\n",
+	PendingLine:     "%s (%s, attempts: %d)\n",
+	DoctorOk:        "No errors found in the table",
+	DoctorTitle:     "Invalid cells: %d, their rows are ignored\n",
+	DoctorLine:      "row %d, %s: %s\n",
+	EmptyValue:      "empty value",
+	InvalidValue:    "invalid value “%v”",
+
+	StartFailed:        "Could not start, try again later",
+	NothingToCancel:    "Nothing to cancel",
+	Cancelled:          "Cancelled",
+	CancelAnswer:       "Cancel",
+	SkipAnswer:         "Skip",
+	AutoCategoryAnswer: "From the reason",
+	EveryoneAnswer:     "Everyone",
+	AskAmount:          "How much was spent?",
+	AskCurrency:        "In which currency?",
+	AskReason:          "What for?",
+	AskCategory:        "Which category?",
+	AskParticipants:    "Who took part? List them separated by spaces, e.g. @alice @bob",
+	BadAmount:          "That is not an amount, send a number such as 250 or 99.90",
+	BadCurrency:        "Send a three letter currency code such as RUB or USD",
+	BadParticipants:    "List usernames separated by spaces, e.g. @alice @bob",
+	BadAnswer:          "I did not get that, please try again",
+
+	ScheduleUsage: "Add: /schedule summary|rates [cron], /schedule reminders [threshold] [cron]\n" +
+		"For example: /schedule rates 0 9 * * 1-5\n" +
+		"Remove: /schedule remove &lt;number&gt;",
+	JobSummary:        "debt summary",
+	JobRates:          "exchange rates",
+	JobReminders:      "debt reminders",
+	SummaryTitle:      "<b>Debt summary</b>\n",
+	RemindersTitle:    "<b>Time to settle up</b>, balances from %s:\n",
+	SchedulesOff:      "Schedules are unavailable",
+	ScheduleMissing:   "Schedule #%d not found",
+	ScheduleRemoved:   "Removed schedule #%d",
+	ScheduleAddFailed: "Could not add the schedule: %s\n\n%s",
+	ScheduleAdded:     "Added %s",
+	NoSchedules:       "No schedules yet\n\n",
+	ReminderThreshold: " from %s",
+	Never:             "never",
+	ScheduleLine:      "#%d %s, <code>%s</code>, next run %s\n",
+
+	PhotoUsage:       "Add a caption with the amount to the photo, e.g. “2300 groceries”, or send a photo of the QR code on a receipt",
+	ReceiptUsage:     "Send /receipt with the expense number, e.g. /receipt 123",
+	ReceiptProposal:  "Receipt of %s for %s",
+	SaveQuestion:     "\nSave it as an expense?",
+	SaveButton:       "Save",
+	DismissButton:    "Don't save",
+	ReceiptNotAuthor: "Only the sender can save the receipt",
+	DismissNotAuthor: "Only the author can dismiss it",
+	NotSaved:         "Not saved",
+	RecentReceipts:   "<b>Recent receipts</b>\n",
+	ReceiptOf:        "Receipt of expense %d: %s %s %s",
+	ReceiptMissing:   "No receipt for expense %d",
+	ReceiptSaved:     "This receipt is already saved",
+	ReceiptsDisabled: "Receipts are not kept: the sheet has no receipt column, enable it in GOOGLE_SHEET_EXTRA_COLUMNS",
+
+	ExportFormats: ", formats: csv or xlsx",
+	ExportFailed:  "Could not export the expenses",
+	Exported:      "Exported expenses%s: %d",
+	ImportUsage: "Send a CSV file with amount, reason and date columns, such as a bank statement or a Splitwise export.\n" +
+		"You will see what was read before it is added",
+	ImportNoFile:    "No file uploaded\n\n",
+	ImportNotAuthor: "Only the uploader can confirm the import",
+	ImportCancelled: "Cancelled the import of %s",
+	Imported:        "Added expenses from %s: %d",
+	ImportSummary:   "import of %s, expenses: %d",
+	FileTooLarge:    "The file is too large, the limit is %d KB",
+	DownloadFailed:  "Could not download the file",
+	NoAmountColumn:  "The file has no amount column, name it amount or “Сумма”",
+	ReadFailed:      "Could not read the file: %s",
+	ImportEmpty:     "%s has no expenses to import\n",
+	ImportTitle:     "<b>Import of %s</b>: %d expenses for %s\n",
+	SkippedRows:     "\nSkipped rows with errors:\n",
+	ImportConfirm:   "\nAdd them to the table: /import confirm, cancel: /import cancel",
+
+	AdminUsage: "/admin — access lists\n" +
+		"/admin add chat [id] — allow a group, the current one without id\n" +
+		"/admin add user &lt;id&gt; — allow a user\n" +
+		"/admin add admin &lt;id&gt; — make an admin\n" +
+		"/admin remove chat|user|admin &lt;id&gt; — remove from the list",
+	AdminOnly:        "Only admins can do that",
+	NoAccess:         "No access",
+	NoAccessId:       "No access. Pass your id to an admin: %d",
+	AccessOpen:       "The bot is open to everyone, set ADMINS in the config to restrict it",
+	MemberExists:     "%s %d is already listed",
+	MemberAdded:      "%s %d added",
+	MemberConfigured: "%s %d is set in the config and can only be removed there",
+	MemberMissing:    "%s %d is not listed",
+	MemberRemoved:    "%s %d removed",
+	RoleChat:         "Chat",
+	RoleUser:         "User",
+	RoleAdmin:        "Admin",
+	AdminsTitle:      "Admins",
+	UsersTitle:       "Users",
+	ChatsTitle:       "Chats",
+	ConfiguredMark:   " (config)",
+}
@@ -0,0 +1,98 @@
+package i18n
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/kn9ka/fundbot-go/services/format"
+)
+
+// Lang is a language the bot speaks, named by its ISO 639-1 code.
+type Lang string
+
+const (
+	Ru Lang = "ru"
+	En Lang = "en"
+)
+
+// Default is used when nothing is known about the user.
+const Default = Ru
+
+// Langs are the languages having a catalog.
+var Langs = []Lang{Ru, En}
+
+var catalogs = map[Lang]map[Key]string{
+	Ru: ru,
+	En: en,
+}
+
+// Locale is how numbers are written in the language.
+func (l Lang) Locale() format.Locale {
+	return format.For(string(l))
+}
+
+// Parse reads a language code such as "en" or "en-US", it reports false
+// for languages without a catalog.
+func Parse(code string) (Lang, bool) {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if i := strings.IndexAny(code, "-_"); i >= 0 {
+		code = code[:i]
+	}
+	lang := Lang(code)
+	_, ok := catalogs[lang]
+	return lang, ok
+}
+
+// russianSpeaking are languages whose speakers get Russian rather than
+// English when their own is missing.
+var russianSpeaking = map[string]bool{"uk": true, "be": true, "kk": true}
+
+// Detect picks the language for the code a Telegram client reports, empty
+// when the user hid it.
+func Detect(code string) Lang {
+	if lang, ok := Parse(code); ok {
+		return lang
+	}
+	code = strings.ToLower(strings.TrimSpace(code))
+	if code == "" || russianSpeaking[strings.SplitN(code, "-", 2)[0]] {
+		return Default
+	}
+	return En
+}
+
+// T renders the message with args as fmt.Sprintf does. Messages missing in
+// the language fall back to Default, unknown keys are returned as they are,
+// so text that is not a key, such as a category name, passes through.
+func (l Lang) T(key Key, args ...interface{}) string {
+	format, ok := catalogs[l][key]
+	if !ok {
+		format, ok = catalogs[Default][key]
+	}
+	if !ok {
+		format = string(key)
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// Catalog returns a copy of the messages of lang.
+func Catalog(lang Lang) map[Key]string {
+	messages := make(map[Key]string, len(catalogs[lang]))
+	for key, message := range catalogs[lang] {
+		messages[key] = message
+	}
+	return messages
+}
+
+// Is reports whether text is the message of key in any language, e.g. an
+// answer picked from a keyboard sent to another user.
+func Is(text string, key Key) bool {
+	for _, lang := range Langs {
+		if strings.EqualFold(text, lang.T(key)) {
+			return true
+		}
+	}
+	return false
+}
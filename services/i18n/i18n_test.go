@@ -0,0 +1,69 @@
+package i18n_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/i18n"
+)
+
+func TestDetect(t *testing.T) {
+	for code, want := range map[string]i18n.Lang{
+		"":      i18n.Ru,
+		"ru":    i18n.Ru,
+		"en":    i18n.En,
+		"en-US": i18n.En,
+		"uk":    i18n.Ru,
+		"de":    i18n.En,
+	} {
+		if got := i18n.Detect(code); got != want {
+			t.Errorf("Detect(%q) = %q, want %q", code, got, want)
+		}
+	}
+	if _, ok := i18n.Parse("de"); ok {
+		t.Errorf("Parse(de) reported a catalog")
+	}
+}
+
+func TestT(t *testing.T) {
+	if got := i18n.En.T(i18n.Saved, "100 taxi"); got != "Saved: 100 taxi" {
+		t.Errorf("T() = %q", got)
+	}
+	if got := i18n.Lang("de").T(i18n.NothingFound); got != "Ничего не найдено" {
+		t.Errorf("T() of a language without a catalog = %q, want the default", got)
+	}
+	if got := i18n.En.T("Транспорт"); got != "Транспорт" {
+		t.Errorf("T() of text that is not a key = %q, want it unchanged", got)
+	}
+	if !i18n.Is("skip", i18n.SkipAnswer) || !i18n.Is("Пропустить", i18n.SkipAnswer) || i18n.Is("Все", i18n.SkipAnswer) {
+		t.Errorf("Is() should match the answer in any language")
+	}
+}
+
+var verb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+// TestCatalogs checks that every message is translated with the same
+// arguments.
+func TestCatalogs(t *testing.T) {
+	ru := i18n.Catalog(i18n.Ru)
+	for _, lang := range i18n.Langs {
+		catalog := i18n.Catalog(lang)
+		if len(catalog) != len(ru) {
+			t.Errorf("%s has %d messages, ru has %d", lang, len(catalog), len(ru))
+		}
+		for key, message := range catalog {
+			want := verb.FindAllString(ru[key], -1)
+			got := verb.FindAllString(message, -1)
+			if len(got) != len(want) {
+				t.Errorf("%s %s has verbs %v, ru has %v", lang, key, got, want)
+				continue
+			}
+			for i := range got {
+				if got[i] != want[i] {
+					t.Errorf("%s %s has verbs %v, ru has %v", lang, key, got, want)
+					break
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package i18n
+
+// Key names a message of the catalogs.
+type Key string
+
+// Command menu.
+const (
+	CmdStart      Key = "cmd.start"
+	CmdList       Key = "cmd.list"
+	CmdAdd        Key = "cmd.add"
+	CmdCancel     Key = "cmd.cancel"
+	CmdRates      Key = "cmd.rates"
+	CmdPending    Key = "cmd.pending"
+	CmdReport     Key = "cmd.report"
+	CmdCategories Key = "cmd.categories"
+	CmdSchedule   Key = "cmd.schedule"
+	CmdExport     Key = "cmd.export"
+	CmdImport     Key = "cmd.import"
+	CmdReceipt    Key = "cmd.receipt"
+	CmdDoctor     Key = "cmd.doctor"
+	CmdAdmin      Key = "cmd.admin"
+	CmdLang       Key = "cmd.lang"
+)
+
+// Common messages.
+const (
+	Help           Key = "help"
+	UnknownCommand Key = "unknown_command"
+	NothingFound   Key = "nothing_found"
+	SaveError      Key = "save_error"
+	SaveLater      Key = "save_later"
+	PeriodError    Key = "period_error"
+	ForPeriod      Key = "for_period"
+	AndMore        Key = "and_more"
+	LangUsage      Key = "lang_usage"
+	LangChanged    Key = "lang_changed"
+	LangName       Key = "lang_name"
+)
+
+// Periods.
+const (
+	PeriodWeek  Key = "period_week"
+	PeriodMonth Key = "period_month"
+	PeriodYear  Key = "period_year"
+	January     Key = "january"
+	February    Key = "february"
+	March       Key = "march"
+	April       Key = "april"
+	May         Key = "may"
+	June        Key = "june"
+	July        Key = "july"
+	August      Key = "august"
+	September   Key = "september"
+	October     Key = "october"
+	November    Key = "november"
+	December    Key = "december"
+)
+
+// Months are the names of the months from January on.
+var Months = []Key{January, February, March, April, May, June, July, August, September, October, November, December}
+
+// Expenses.
+const (
+	Saved          Key = "saved"
+	SavedReceipt   Key = "saved_receipt"
+	Queued         Key = "queued"
+	ExpiredButton  Key = "expired_button"
+	UndoButton     Key = "undo_button"
+	UndoNotAuthor  Key = "undo_not_author"
+	UndoExpired    Key = "undo_expired"
+	UndoFailed     Key = "undo_failed"
+	ExpenseMissing Key = "expense_missing"
+	Undone         Key = "undone"
+	UndoneExpense  Key = "undone_expense"
+)
+
+// /list, /report and /rates.
+const (
+	ListTitle        Key = "list_title"
+	SettleButton     Key = "settle_button"
+	NoActiveDebts    Key = "no_active_debts"
+	SettleFailed     Key = "settle_failed"
+	Settled          Key = "settled"
+	ReportTitle      Key = "report_title"
+	ReportPrevious   Key = "report_previous"
+	ReportByUser     Key = "report_by_user"
+	ReportByCategory Key = "report_by_category"
+	NoCategory       Key = "no_category"
+	ChartTitle       Key = "chart_title"
+	OfficialRate     Key = "official_rate"
+	Unavailable      Key = "unavailable"
+)
+
+// /categories, /pending and /doctor.
+const (
+	CategoriesUsage Key = "categories_usage"
+	NoCategories    Key = "no_categories"
+	CategoryAdded   Key = "category_added"
+	NotFound        Key = "not_found"
+	Deleted         Key = "deleted"
+	AllSynced       Key = "all_synced"
+	PendingTitle    Key = "pending_title"
+	PendingLine     Key = "pending_line"
+	DoctorOk        Key = "doctor_ok"
+	DoctorTitle     Key = "doctor_title"
+	DoctorLine      Key = "doctor_line"
+	EmptyValue      Key = "empty_value"
+	InvalidValue    Key = "invalid_value"
+)
+
+// /add.
+const (
+	StartFailed        Key = "start_failed"
+	NothingToCancel    Key = "nothing_to_cancel"
+	Cancelled          Key = "cancelled"
+	CancelAnswer       Key = "cancel_answer"
+	SkipAnswer         Key = "skip_answer"
+	AutoCategoryAnswer Key = "auto_category_answer"
+	EveryoneAnswer     Key = "everyone_answer"
+	AskAmount          Key = "ask_amount"
+	AskCurrency        Key = "ask_currency"
+	AskReason          Key = "ask_reason"
+	AskCategory        Key = "ask_category"
+	AskParticipants    Key = "ask_participants"
+	BadAmount          Key = "bad_amount"
+	BadCurrency        Key = "bad_currency"
+	BadParticipants    Key = "bad_participants"
+	BadAnswer          Key = "bad_answer"
+)
+
+// /schedule.
+const (
+	ScheduleUsage     Key = "schedule_usage"
+	JobSummary        Key = "job_summary"
+	JobRates          Key = "job_rates"
+	JobReminders      Key = "job_reminders"
+	SummaryTitle      Key = "summary_title"
+	RemindersTitle    Key = "reminders_title"
+	SchedulesOff      Key = "schedules_off"
+	ScheduleMissing   Key = "schedule_missing"
+	ScheduleRemoved   Key = "schedule_removed"
+	ScheduleAddFailed Key = "schedule_add_failed"
+	ScheduleAdded     Key = "schedule_added"
+	NoSchedules       Key = "no_schedules"
+	ReminderThreshold Key = "reminder_threshold"
+	Never             Key = "never"
+	ScheduleLine      Key = "schedule_line"
+)
+
+// Photos and /receipt.
+const (
+	PhotoUsage       Key = "photo_usage"
+	ReceiptUsage     Key = "receipt_usage"
+	ReceiptProposal  Key = "receipt_proposal"
+	SaveQuestion     Key = "save_question"
+	SaveButton       Key = "save_button"
+	DismissButton    Key = "dismiss_button"
+	ReceiptNotAuthor Key = "receipt_not_author"
+	DismissNotAuthor Key = "dismiss_not_author"
+	NotSaved         Key = "not_saved"
+	RecentReceipts   Key = "recent_receipts"
+	ReceiptOf        Key = "receipt_of"
+	ReceiptMissing   Key = "receipt_missing"
+	ReceiptsDisabled Key = "receipts_disabled"
+	ReceiptSaved     Key = "receipt_saved"
+)
+
+// /export and /import.
+const (
+	ExportFormats   Key = "export_formats"
+	ExportFailed    Key = "export_failed"
+	Exported        Key = "exported"
+	ImportUsage     Key = "import_usage"
+	ImportNoFile    Key = "import_no_file"
+	ImportNotAuthor Key = "import_not_author"
+	ImportCancelled Key = "import_cancelled"
+	Imported        Key = "imported"
+	ImportSummary   Key = "import_summary"
+	FileTooLarge    Key = "file_too_large"
+	DownloadFailed  Key = "download_failed"
+	NoAmountColumn  Key = "no_amount_column"
+	ReadFailed      Key = "read_failed"
+	ImportEmpty     Key = "import_empty"
+	ImportTitle     Key = "import_title"
+	SkippedRows     Key = "skipped_rows"
+	ImportConfirm   Key = "import_confirm"
+)
+
+// Access control and /admin.
+const (
+	AdminUsage       Key = "admin_usage"
+	AdminOnly        Key = "admin_only"
+	NoAccess         Key = "no_access"
+	NoAccessId       Key = "no_access_id"
+	AccessOpen       Key = "access_open"
+	MemberExists     Key = "member_exists"
+	MemberAdded      Key = "member_added"
+	MemberConfigured Key = "member_configured"
+	MemberMissing    Key = "member_missing"
+	MemberRemoved    Key = "member_removed"
+	RoleChat         Key = "role_chat"
+	RoleUser         Key = "role_user"
+	RoleAdmin        Key = "role_admin"
+	AdminsTitle      Key = "admins_title"
+	UsersTitle       Key = "users_title"
+	ChatsTitle       Key = "chats_title"
+	ConfiguredMark   Key = "configured_mark"
+)
@@ -0,0 +1,190 @@
+package i18n
+
+var ru = map[Key]string{
+	CmdStart:      "Список доступных команд",
+	CmdList:       "Список долгов, /list month — за период",
+	CmdAdd:        "Добавить расход по шагам",
+	CmdCancel:     "Прервать текущую команду",
+	CmdRates:      "Курсы валют",
+	CmdPending:    "Несинхронизированные записи",
+	CmdReport:     "Отчёт о расходах с графиком за месяц или период",
+	CmdCategories: "Категории и ключевые слова",
+	CmdSchedule:   "Регулярные сводки, курсы и напоминания",
+	CmdExport:     "Выгрузить расходы в CSV или XLSX",
+	CmdImport:     "Загрузить расходы из CSV файла",
+	CmdReceipt:    "Фото чека к записи",
+	CmdDoctor:     "Ошибки в таблице",
+	CmdAdmin:      "Списки доступа, для администраторов",
+	CmdLang:       "Язык бота",
+
+	Help: "/list — активные долги, /list month или /list 2026-09 за период\n" +
+		"/add — добавить расход по шагам, /cancel чтобы прервать\n" +
+		"/rates — курсы RUB => USD/EUR/GEL\n" +
+		"/report — расходы по людям и категориям с графиком, /report 2026-09 за период\n" +
+		"/categories — категории и ключевые слова, #категория в расходе задаёт её\n" +
+		"/schedule — регулярные сводки долгов, курсы и напоминания в этом чате\n" +
+		"/export — расходы файлом, /export month xlsx за период и в формате\n" +
+		"/import — добавить расходы из CSV файла\n" +
+		"/receipt — фото чека к записи, пришлите фото с подписью вроде «2300 продукты», чтобы сохранить его\n" +
+		"/pending — записи, ожидающие синхронизации\n" +
+		"/doctor — некорректные строки в таблице\n" +
+		"/admin — разрешённые чаты, пользователи и администраторы\n" +
+		"/lang — язык бота, /lang en для английского",
+	UnknownCommand: "Неизвестная команда, список команд: /start",
+	NothingFound:   "Ничего не найдено",
+	SaveError:      "При сохранении возникла ошибка",
+	SaveLater:      "Не получилось сохранить, попробуйте позже",
+	PeriodError:    "Не понял период «%s», примеры: today, week, month, year, 2026, 2026-09 или 2026-09-15",
+	ForPeriod:      " за %s",
+	AndMore:        "…и ещё %d\n",
+	LangUsage:      "Язык: %s\nСменить: /lang ru или /lang en",
+	LangChanged:    "Буду отвечать по-русски",
+	LangName:       "русский",
+
+	PeriodWeek:  "неделя с %s",
+	PeriodMonth: "%s %d",
+	PeriodYear:  "%d год",
+	January:     "январь",
+	February:    "февраль",
+	March:       "март",
+	April:       "апрель",
+	May:         "май",
+	June:        "июнь",
+	July:        "июль",
+	August:      "август",
+	September:   "сентябрь",
+	October:     "октябрь",
+	November:    "ноябрь",
+	December:    "декабрь",
+
+	Saved:          "Сохранил: %s",
+	SavedReceipt:   "\nЧек: /receipt %d",
+	Queued:         "Таблица недоступна, сохранил локально и синхронизирую позже: %s",
+	ExpiredButton:  "Кнопка устарела",
+	UndoButton:     "Отменить",
+	UndoNotAuthor:  "Отменить запись может только её автор или администратор",
+	UndoExpired:    "Время для отмены истекло",
+	UndoFailed:     "Не получилось отменить, попробуйте позже",
+	ExpenseMissing: "Запись не найдена",
+	Undone:         "Отменено",
+	UndoneExpense:  "Отменено: %s",
+
+	ListTitle:        "<b>За %s</b>\n",
+	SettleButton:     "Рассчитаться: %s",
+	NoActiveDebts:    "У %s нет активных долгов",
+	SettleFailed:     "Не получилось рассчитаться, попробуйте позже",
+	Settled:          "Рассчитались с %s: %s",
+	ReportTitle:      "<b>Расходы за %s</b>: %s",
+	ReportPrevious:   " (%s к %s: %s)",
+	ReportByUser:     "\n\n<b>По людям</b>\n",
+	ReportByCategory: "\n<b>По категориям</b>\n",
+	NoCategory:       "Без категории",
+	ChartTitle:       "Расходы за %s: %s",
+	OfficialRate:     "официальный курс",
+	Unavailable:      "<i>Временно недоступны: %s</i>\n",
+
+	CategoriesUsage: "Добавить: /categories add Транспорт: такси, uber\nУдалить слово или категорию: /categories remove uber",
+	NoCategories:    "Категорий пока нет\n",
+	CategoryAdded:   "Категория «%s»: %s",
+	NotFound:        "Не нашёл «%s»",
+	Deleted:         "Удалил «%s»",
+	AllSynced:       "Все записи синхронизированы",
+	PendingTitle:    "Ожидают синхронизации: %d\n",
+	PendingLine:     "%s (%s, попыток: %d)\n",
+	DoctorOk:        "Ошибок в таблице не найдено",
+	DoctorTitle:     "Некорректные ячейки: %d, такие строки не учитываются\n",
+	DoctorLine:      "строка %d, %s: %s\n",
+	EmptyValue:      "пустое значение",
+	InvalidValue:    "некорректное значение «%v»",
+
+	StartFailed:        "Не получилось начать, попробуйте позже",
+	NothingToCancel:    "Нечего отменять",
+	Cancelled:          "Отменил",
+	CancelAnswer:       "Отмена",
+	SkipAnswer:         "Пропустить",
+	AutoCategoryAnswer: "По описанию",
+	EveryoneAnswer:     "Все",
+	AskAmount:          "Сколько потратили?",
+	AskCurrency:        "В какой валюте?",
+	AskReason:          "На что?",
+	AskCategory:        "Какая категория?",
+	AskParticipants:    "Кто участвовал? Перечислите через пробел, например @alice @bob",
+	BadAmount:          "Не понял сумму, пришлите число, например 250 или 99,90",
+	BadCurrency:        "Пришлите код валюты из трёх букв, например RUB или USD",
+	BadParticipants:    "Перечислите имена пользователей через пробел, например @alice @bob",
+	BadAnswer:          "Не понял ответ, попробуйте ещё раз",
+
+	ScheduleUsage: "Добавить: /schedule summary|rates [cron], /schedule reminders [порог] [cron]\n" +
+		"Например: /schedule rates 0 9 * * 1-5\n" +
+		"Удалить: /schedule remove &lt;номер&gt;",
+	JobSummary:        "сводка долгов",
+	JobRates:          "курсы валют",
+	JobReminders:      "напоминания о долгах",
+	SummaryTitle:      "<b>Сводка долгов</b>\n",
+	RemindersTitle:    "<b>Пора рассчитаться</b>, суммы от %s:\n",
+	SchedulesOff:      "Расписания недоступны",
+	ScheduleMissing:   "Расписание #%d не найдено",
+	ScheduleRemoved:   "Удалил расписание #%d",
+	ScheduleAddFailed: "Не получилось добавить расписание: %s\n\n%s",
+	ScheduleAdded:     "Добавил %s",
+	NoSchedules:       "Расписаний пока нет\n\n",
+	ReminderThreshold: " от %s",
+	Never:             "никогда",
+	ScheduleLine:      "#%d %s, <code>%s</code>, ближайший запуск %s\n",
+
+	PhotoUsage:       "Добавьте к фото подпись с суммой, например «2300 продукты», или пришлите фото QR-кода с чека",
+	ReceiptUsage:     "Пришлите /receipt и номер записи, например /receipt 123",
+	ReceiptProposal:  "Чек от %s на %s",
+	SaveQuestion:     "\nСохранить как расход?",
+	SaveButton:       "Сохранить",
+	DismissButton:    "Не сохранять",
+	ReceiptNotAuthor: "Сохранить чек может только тот, кто его прислал",
+	DismissNotAuthor: "Отклонить может только автор",
+	NotSaved:         "Не сохранено",
+	RecentReceipts:   "<b>Последние чеки</b>\n",
+	ReceiptOf:        "Чек к записи %d: %s %s %s",
+	ReceiptMissing:   "Чек к записи %d не найден",
+	ReceiptSaved:     "Этот чек уже сохранён",
+	ReceiptsDisabled: "Чеки не сохраняются: в таблице нет колонки receipt, её включает GOOGLE_SHEET_EXTRA_COLUMNS",
+
+	ExportFormats: ", формат: csv или xlsx",
+	ExportFailed:  "Не получилось выгрузить расходы",
+	Exported:      "Выгрузил записей%s: %d",
+	ImportUsage: "Пришлите CSV файл с колонками суммы, описания и даты, например выписку банка или экспорт Splitwise.\n" +
+		"Перед добавлением покажу, что получилось",
+	ImportNoFile:    "Нет загруженного файла\n\n",
+	ImportNotAuthor: "Подтвердить импорт может только тот, кто загрузил файл",
+	ImportCancelled: "Отменил импорт %s",
+	Imported:        "Добавил записей из %s: %d",
+	ImportSummary:   "импорт %s, записей: %d",
+	FileTooLarge:    "Файл слишком большой, можно до %d КБ",
+	DownloadFailed:  "Не получилось скачать файл",
+	NoAmountColumn:  "В файле нет колонки с суммой, назовите её amount или «Сумма»",
+	ReadFailed:      "Не получилось прочитать файл: %s",
+	ImportEmpty:     "В %s нет записей для импорта\n",
+	ImportTitle:     "<b>Импорт %s</b>: записей %d на %s\n",
+	SkippedRows:     "\nПропущены строки с ошибками:\n",
+	ImportConfirm:   "\nДобавить в таблицу: /import confirm, отменить: /import cancel",
+
+	AdminUsage: "/admin — списки доступа\n" +
+		"/admin add chat [id] — разрешить группу, без id текущую\n" +
+		"/admin add user &lt;id&gt; — разрешить пользователя\n" +
+		"/admin add admin &lt;id&gt; — назначить администратора\n" +
+		"/admin remove chat|user|admin &lt;id&gt; — убрать из списка",
+	AdminOnly:        "Это может только администратор",
+	NoAccess:         "Нет доступа",
+	NoAccessId:       "Нет доступа. Передайте администратору ваш id: %d",
+	AccessOpen:       "Доступ открыт всем, задайте ADMINS в конфигурации, чтобы его ограничить",
+	MemberExists:     "%s %d уже в списке",
+	MemberAdded:      "%s %d добавлен",
+	MemberConfigured: "%s %d задан в конфигурации, убрать его можно только там",
+	MemberMissing:    "%s %d нет в списке",
+	MemberRemoved:    "%s %d убран",
+	RoleChat:         "Чат",
+	RoleUser:         "Пользователь",
+	RoleAdmin:        "Администратор",
+	AdminsTitle:      "Администраторы",
+	UsersTitle:       "Пользователи",
+	ChatsTitle:       "Чаты",
+	ConfiguredMark:   " (конфигурация)",
+}
@@ -0,0 +1,112 @@
+package ledgerfile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+// Header names the exported columns. They are the ledger column names, so
+// an exported file can be imported back.
+var Header = []string{"id", "amount", "reason", "from", "date", "username", "active", "category", "currency", "participants", "user_id"}
+
+// DateLayout is how dates are written to CSV files.
+const DateLayout = "2006-01-02 15:04:05"
+
+// values lays the expense out in the order of Header, dates are left as
+// time.Time in location, empty when unknown, like unknown user ids.
+func values(e sheets.Expense, location *time.Location) []interface{} {
+	var date interface{} = ""
+	if !e.Date.IsZero() {
+		date = e.Date.In(location)
+	}
+	var userId interface{} = ""
+	if e.UserId != 0 {
+		userId = e.UserId
+	}
+	return []interface{}{
+		e.Id, e.Amount, text(e.Reason), text(e.From), date, text(e.Username), e.Active,
+		text(e.Category), text(e.Currency), text(strings.Join(e.Participants, ", ")), userId,
+	}
+}
+
+// formulaPrefixes start the cells spreadsheet apps evaluate as formulas.
+const formulaPrefixes = "=+-@"
+
+// text keeps a text cell from being evaluated as a formula by prefixing it
+// with an apostrophe, which spreadsheet apps hide. ParseCSV removes it.
+func text(s string) string {
+	if s != "" && strings.ContainsRune(formulaPrefixes, rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// untext undoes text.
+func untext(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune(formulaPrefixes, rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// CSV writes the expenses as comma separated values with a header row,
+// dates are wall clock time in location.
+func CSV(expenses []sheets.Expense, location *time.Location) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write(Header); err != nil {
+		return nil, fmt.Errorf("failed to write csv: %s", err)
+	}
+	for _, e := range expenses {
+		var record []string
+		for _, value := range values(e, location) {
+			record = append(record, csvValue(value))
+		}
+		if err := w.Write(record); err != nil {
+			return nil, fmt.Errorf("failed to write csv: %s", err)
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return nil, fmt.Errorf("failed to write csv: %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strings.ToUpper(strconv.FormatBool(v))
+	case time.Time:
+		return v.Format(DateLayout)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// XLSX writes the expenses as a single sheet workbook with a header row,
+// dates are date cells of wall clock time in location.
+func XLSX(expenses []sheets.Expense, location *time.Location) ([]byte, error) {
+	rows := make([][]interface{}, 0, len(expenses)+1)
+
+	header := make([]interface{}, len(Header))
+	for i, name := range Header {
+		header[i] = name
+	}
+	rows = append(rows, header)
+
+	for _, e := range expenses {
+		rows = append(rows, values(e, location))
+	}
+	return writeWorkbook("expenses", rows)
+}
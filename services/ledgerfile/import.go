@@ -0,0 +1,123 @@
+package ledgerfile
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+// ErrNoAmount is returned for files without an amount column.
+var ErrNoAmount = errors.New("no amount column")
+
+// Defaults fill in the columns an imported file does not have, e.g. a bank
+// statement has neither ids nor users. Id is the id of the first expense,
+// the next ones are numbered on from it.
+type Defaults struct {
+	Id       int64
+	Username string
+	UserId   int64
+	Date     time.Time
+}
+
+// ParseCSV reads expenses from a CSV file with a header row, such as a file
+// written by CSV, a bank statement or a Splitwise export. Columns are found
+// by the ledger column names and aliases, values are separated by commas,
+// semicolons or tabs. Rows with invalid cells are reported and left out,
+// imported expenses are active unless the file says otherwise.
+func ParseCSV(data []byte, defaults Defaults, location *time.Location) ([]sheets.Expense, []sheets.RowError, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = delimiter(data)
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read csv: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil, ErrNoAmount
+	}
+
+	header := make([]interface{}, len(records[0]))
+	for i, name := range records[0] {
+		header[i] = name
+	}
+
+	present := map[string]bool{}
+	for _, column := range sheets.Columns {
+		present[column.Name] = named(header, column)
+	}
+	if !present["amount"] {
+		return nil, nil, ErrNoAmount
+	}
+
+	schema, _ := sheets.HeaderSchema(header, sheets.Columns, location)
+	rows := make([][]interface{}, len(records)-1)
+	for i, record := range records[1:] {
+		rows[i] = make([]interface{}, len(record))
+		for j, cell := range record {
+			rows[i][j] = untext(cell)
+		}
+	}
+
+	expenses, errs := schema.Decode(rows, 2)
+	for i := range expenses {
+		e := &expenses[i]
+		// the rows of the file, not of the ledger
+		e.Row = 0
+		e.Username = strings.TrimPrefix(e.Username, "@")
+		if !present["id"] {
+			e.Id = defaults.Id + int64(i)
+		}
+		if !present["username"] && !present["user_id"] {
+			e.Username = defaults.Username
+			e.UserId = defaults.UserId
+		}
+		if e.Date.IsZero() {
+			e.Date = defaults.Date
+		}
+		if !present["active"] {
+			e.Active = true
+		}
+	}
+	return expenses, errs, nil
+}
+
+// named reports whether the header has the column.
+func named(header []interface{}, column sheets.Column) bool {
+	for _, cell := range header {
+		name := strings.ToLower(strings.TrimSpace(fmt.Sprint(cell)))
+		if name == column.Name {
+			return true
+		}
+		for _, alias := range column.Aliases {
+			if name == alias {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// delimiter guesses the separator from the header line, bank statements
+// in Russian locales are usually separated by semicolons.
+func delimiter(data []byte) rune {
+	line := data
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		line = data[:i]
+	}
+
+	best, count := ',', bytes.Count(line, []byte{','})
+	for _, candidate := range []rune{';', '\t'} {
+		if n := bytes.Count(line, []byte(string(candidate))); n > count {
+			best, count = candidate, n
+		}
+	}
+	return best
+}
@@ -0,0 +1,162 @@
+package ledgerfile_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/ledgerfile"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+func TestCSVRoundTrip(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+	expenses := []sheets.Expense{
+		{Id: 1, Amount: money.MustParse("120.5"), Reason: `groceries, "fresh"`, Date: time.Date(2026, 9, 10, 12, 30, 0, 0, moscow), Username: "alice", Active: true, Category: "Продукты", UserId: 1001},
+		{Id: 2, Amount: money.MustParse("80"), Date: time.Date(2026, 9, 11, 9, 0, 0, 0, moscow), Username: "bob", Currency: "USD", Participants: []string{"alice", "bob"}},
+		{Id: 3, Amount: money.MustParse("-15"), Reason: `=HYPERLINK("http://example.com")`, From: "@bank", Date: time.Date(2026, 9, 12, 9, 0, 0, 0, moscow), Username: "carol"},
+	}
+
+	data, err := ledgerfile.CSV(expenses, moscow)
+	if err != nil {
+		t.Fatalf("CSV() error = %v", err)
+	}
+	lines := strings.Split(string(data), "\n")
+	if lines[1] != `1,120.5,"groceries, ""fresh""",,2026-09-10 12:30:00,alice,TRUE,Продукты,,,1001` {
+		t.Errorf("first row = %q", lines[1])
+	}
+	// text that would run as a formula is escaped, numbers are not
+	if lines[3] != `3,-15,"'=HYPERLINK(""http://example.com"")",'@bank,2026-09-12 09:00:00,carol,FALSE,,,,` {
+		t.Errorf("third row = %q", lines[3])
+	}
+
+	got, errs, err := ledgerfile.ParseCSV(data, ledgerfile.Defaults{Id: 99, Username: "carol"}, moscow)
+	if err != nil || len(errs) > 0 {
+		t.Fatalf("ParseCSV() error = %v, %v", err, errs)
+	}
+	if len(got) != len(expenses) {
+		t.Fatalf("ParseCSV() = %d expenses, want %d", len(got), len(expenses))
+	}
+	for i := range got {
+		if !got[i].Date.Equal(expenses[i].Date) {
+			t.Errorf("expense %d date = %v, want %v", i, got[i].Date, expenses[i].Date)
+		}
+		got[i].Date = expenses[i].Date
+	}
+	if !reflect.DeepEqual(got, expenses) {
+		t.Errorf("ParseCSV() = %+v, want %+v", got, expenses)
+	}
+}
+
+func TestParseCSV(t *testing.T) {
+	uploaded := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	defaults := ledgerfile.Defaults{Id: 42, Username: "alice", Date: uploaded}
+
+	t.Run("bank statement", func(t *testing.T) {
+		data := "\xef\xbb\xbfДата операции;Сумма операции;Валюта операции;Описание\n" +
+			"15.09.2026 13:45:00;1 234,50;rub;Пятёрочка\n" +
+			"16.09.2026;;RUB;Перевод\n" +
+			"17.09.2026;abc;RUB;Кафе\n" +
+			";300;RUB;Такси\n"
+		got, errs, err := ledgerfile.ParseCSV([]byte(data), defaults, time.UTC)
+		if err != nil {
+			t.Fatalf("ParseCSV() error = %v", err)
+		}
+
+		want := []sheets.Expense{
+			{Id: 42, Amount: money.MustParse("1234.5"), Reason: "Пятёрочка", Date: time.Date(2026, 9, 15, 13, 45, 0, 0, time.UTC), Username: "alice", Active: true, Currency: "RUB"},
+			{Id: 43, Amount: money.MustParse("300"), Reason: "Такси", Date: uploaded, Username: "alice", Active: true, Currency: "RUB"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseCSV() = %+v, want %+v", got, want)
+		}
+		wantErrs := []sheets.RowError{
+			{Row: 3, Column: "amount", Kind: sheets.MissingValue, Value: ""},
+			{Row: 4, Column: "amount", Kind: sheets.InvalidValue, Value: "abc"},
+		}
+		if !reflect.DeepEqual(errs, wantErrs) {
+			t.Errorf("ParseCSV() errors = %+v, want %+v", errs, wantErrs)
+		}
+	})
+
+	t.Run("splitwise export", func(t *testing.T) {
+		data := "Date,Description,Category,Cost,Currency,alice,bob\n" +
+			"2026-09-20,Dinner,Dining out,90.00,USD,45.00,-45.00\n" +
+			"\n"
+		got, errs, err := ledgerfile.ParseCSV([]byte(data), defaults, time.UTC)
+		if err != nil || len(errs) > 0 {
+			t.Fatalf("ParseCSV() error = %v, %v", err, errs)
+		}
+		want := []sheets.Expense{
+			{Id: 42, Amount: money.MustParse("90"), Reason: "Dinner", Date: time.Date(2026, 9, 20, 0, 0, 0, 0, time.UTC), Username: "alice", Active: true, Category: "Dining out", Currency: "USD"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("ParseCSV() = %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("no amount", func(t *testing.T) {
+		for _, data := range []string{"", "date,reason\n2026-09-20,Dinner\n"} {
+			if _, _, err := ledgerfile.ParseCSV([]byte(data), defaults, time.UTC); !errors.Is(err, ledgerfile.ErrNoAmount) {
+				t.Errorf("ParseCSV(%q) error = %v, want ErrNoAmount", data, err)
+			}
+		}
+	})
+}
+
+func TestXLSX(t *testing.T) {
+	expenses := []sheets.Expense{
+		{Id: 1, Amount: money.MustParse("120.5"), Reason: "bread & <butter>", Date: time.Date(2026, 9, 10, 12, 0, 0, 0, time.UTC), Username: "alice", Active: true},
+		{Id: 2, Amount: money.MustParse("1"), Reason: "=SUM(A1:A2)", Username: "bob"},
+	}
+	data, err := ledgerfile.XLSX(expenses, time.UTC)
+	if err != nil {
+		t.Fatalf("XLSX() error = %v", err)
+	}
+
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("XLSX() is not a zip archive: %v", err)
+	}
+	parts := map[string]string{}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts[f.Name] = string(content)
+	}
+
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml"} {
+		if _, ok := parts[name]; !ok {
+			t.Errorf("XLSX() has no %s", name)
+		}
+	}
+	sheet := parts["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">id</t></is></c>`,
+		`<c r="A2"><v>1</v></c><c r="B2"><v>120.5</v></c>`,
+		`<t xml:space="preserve">bread &amp; &lt;butter&gt;</t>`,
+		`<c r="E2" s="1"><v>46275.5</v></c>`,
+		`<c r="G2" t="b"><v>1</v></c>`,
+		`<c r="C3" t="inlineStr"><is><t xml:space="preserve">&#39;=SUM(A1:A2)</t></is></c>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("sheet = %s, want it to contain %s", sheet, want)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Base is the currency of amounts stored without one, rates are quoted in
+// it too.
+const Base = "RUB"
+
+// Scale is the number of fractional digits a Decimal keeps.
+const Scale = 6
+
+// one is the number of units in 1.
+const one = 1000000
+
+// ErrInvalid is returned for text that is not a number.
+var ErrInvalid = errors.New("invalid number")
+
+// limit is the largest number of units a Decimal holds, arithmetic
+// saturates at ±limit rather than wrapping around.
+var limit = big.NewInt(math.MaxInt64)
+
+// Max and Min are the largest and the smallest Decimal.
+var (
+	Max = Decimal{units: math.MaxInt64}
+	Min = Decimal{units: -math.MaxInt64}
+)
+
+// Decimal is an exact decimal number with Scale fractional digits. Unlike
+// float64, sums of amounts read from the ledger stay exact. The zero value
+// is 0.
+type Decimal struct {
+	units int64
+}
+
+// New returns value·10^exp, e.g. New(12050, -2) is 120.50. Digits beyond
+// Scale are rounded half away from zero.
+func New(value int64, exp int) Decimal {
+	return Decimal{units: clamp(shift(big.NewInt(value), exp+Scale))}
+}
+
+// shift returns n·10^exp rounded half away from zero.
+func shift(n *big.Int, exp int) *big.Int {
+	pow := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(exp))), nil)
+	if exp >= 0 {
+		return new(big.Int).Mul(n, pow)
+	}
+	return divRound(n, pow)
+}
+
+// clamp converts n to units, saturating at ±limit.
+func clamp(n *big.Int) int64 {
+	if n.CmpAbs(limit) > 0 {
+		if n.Sign() < 0 {
+			return -math.MaxInt64
+		}
+		return math.MaxInt64
+	}
+	return n.Int64()
+}
+
+// divRound returns n/d rounded half away from zero.
+func divRound(n, d *big.Int) *big.Int {
+	q, r := new(big.Int).QuoRem(n, d, new(big.Int))
+	if new(big.Int).Mul(new(big.Int).Abs(r), big.NewInt(2)).Cmp(new(big.Int).Abs(d)) >= 0 {
+		if n.Sign()*d.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	return q
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// Parse reads a number such as "1234.5", "-3" or "1 234,50": spaces group
+// thousands and the decimal separator is a point or a comma. Digits beyond
+// Scale are rounded half away from zero.
+func Parse(text string) (Decimal, error) {
+	s := strings.NewReplacer(" ", "", " ", "", " ", "").Replace(strings.TrimSpace(text))
+	negative := strings.HasPrefix(s, "-")
+	if negative || strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+	if strings.Count(s, ".")+strings.Count(s, ",") > 1 {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalid, text)
+	}
+	whole, fraction := s, ""
+	if i := strings.IndexAny(s, ".,"); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if whole+fraction == "" || strings.Trim(whole+fraction, "0123456789") != "" {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalid, text)
+	}
+
+	digits, ok := new(big.Int).SetString(whole+fraction, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalid, text)
+	}
+	if negative {
+		digits.Neg(digits)
+	}
+	// a trillion leaves room to sum amounts without overflowing units
+	if new(big.Int).Abs(digits).Cmp(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(len(fraction)+12)), nil)) >= 0 {
+		return Decimal{}, fmt.Errorf("%w: %q is too large", ErrInvalid, text)
+	}
+	return Decimal{units: clamp(shift(digits, Scale-len(fraction)))}, nil
+}
+
+// MustParse is Parse panicking on errors, for constants.
+func MustParse(text string) Decimal {
+	d, err := Parse(text)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// FromFloat converts f through its shortest decimal form, so 0.1 becomes
+// exactly 0.1. It fails for NaN, infinities and numbers Parse rejects as
+// too large.
+func FromFloat(f float64) (Decimal, error) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return Decimal{}, fmt.Errorf("%w: %v", ErrInvalid, f)
+	}
+	return Parse(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// Float64 returns the nearest float64, for spreadsheets and charts.
+func (d Decimal) Float64() float64 {
+	f, _ := strconv.ParseFloat(d.String(), 64)
+	return f
+}
+
+// Add returns d+other, saturating at Max and Min.
+func (d Decimal) Add(other Decimal) Decimal {
+	n := new(big.Int).Add(big.NewInt(d.units), big.NewInt(other.units))
+	return Decimal{units: clamp(n)}
+}
+
+// Sub returns d-other, saturating at Max and Min.
+func (d Decimal) Sub(other Decimal) Decimal {
+	n := new(big.Int).Sub(big.NewInt(d.units), big.NewInt(other.units))
+	return Decimal{units: clamp(n)}
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{units: -d.units}
+}
+
+// Mul returns d·other rounded to Scale, saturating at Max and Min.
+func (d Decimal) Mul(other Decimal) Decimal {
+	n := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(other.units))
+	return Decimal{units: clamp(divRound(n, big.NewInt(one)))}
+}
+
+// Div returns d/other rounded to Scale, it fails on division by zero and
+// when the quotient is beyond Max or Min.
+func (d Decimal) Div(other Decimal) (Decimal, error) {
+	if other.units == 0 {
+		return Decimal{}, errors.New("division by zero")
+	}
+	n := new(big.Int).Mul(big.NewInt(d.units), big.NewInt(one))
+	q := divRound(n, big.NewInt(other.units))
+	if q.CmpAbs(limit) > 0 {
+		return Decimal{}, errors.New("quotient is too large")
+	}
+	return Decimal{units: q.Int64()}, nil
+}
+
+// Round rounds d to places fractional digits, half away from zero.
+func (d Decimal) Round(places int) Decimal {
+	if places >= Scale {
+		return d
+	}
+	return New(clamp(shift(big.NewInt(d.units), places-Scale)), -places)
+}
+
+// Minor returns d counted in 10^-places, rounded half away from zero, e.g.
+// kopecks for 2. It saturates at the limits of int64.
+func (d Decimal) Minor(places int) int64 {
+	return clamp(shift(big.NewInt(d.units), places-Scale))
+}
+
+// Cmp returns -1, 0 or +1 as d is less than, equal to or greater than other.
+func (d Decimal) Cmp(other Decimal) int {
+	switch {
+	case d.units < other.units:
+		return -1
+	case d.units > other.units:
+		return 1
+	}
+	return 0
+}
+
+// Sign returns -1, 0 or +1 as d is negative, zero or positive.
+func (d Decimal) Sign() int {
+	return d.Cmp(Decimal{})
+}
+
+func (d Decimal) IsZero() bool {
+	return d.units == 0
+}
+
+// Fixed writes d rounded to places fractional digits, e.g. "120.50".
+func (d Decimal) Fixed(places int) string {
+	if places < 0 {
+		places = 0
+	}
+	units := d.Round(places).units
+	sign := ""
+	if units < 0 {
+		sign, units = "-", -units
+	}
+	whole, fraction := units/one, units%one
+	if places == 0 {
+		return sign + strconv.FormatInt(whole, 10)
+	}
+	digits := fmt.Sprintf("%0*d", Scale, fraction)
+	for len(digits) < places {
+		digits += "0"
+	}
+	return sign + strconv.FormatInt(whole, 10) + "." + digits[:places]
+}
+
+// String writes d without trailing zeros, e.g. "120.5".
+func (d Decimal) String() string {
+	s := d.Fixed(Scale)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+// MarshalJSON writes d as a JSON number.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// UnmarshalJSON reads a JSON number or a number in a string, in plain or
+// exponent form. null and an empty string read as zero.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	if s == "null" || s == "" {
+		*d = Decimal{}
+		return nil
+	}
+	if strings.ContainsAny(s, "eE") {
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrInvalid, data)
+		}
+		parsed, err := FromFloat(f)
+		if err != nil {
+			return err
+		}
+		*d = parsed
+		return nil
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Amount is a sum of money, an empty Currency is Base.
+type Amount struct {
+	Value    Decimal
+	Currency string
+}
+
+// Code returns the currency of a, Base when empty.
+func (a Amount) Code() string {
+	if a.Currency == "" {
+		return Base
+	}
+	return strings.ToUpper(a.Currency)
+}
+
+func (a Amount) String() string {
+	return a.Value.String() + " " + a.Code()
+}
+
+// Rate is the price of one From in To.
+type Rate struct {
+	From  string
+	To    string
+	Value Decimal
+}
+
+// Convert returns a in To, it fails for amounts in other currencies.
+func (r Rate) Convert(a Amount) (Amount, error) {
+	if a.Code() != r.From {
+		return Amount{}, fmt.Errorf("failed to convert %s with the rate of %s", a, r.From)
+	}
+	return Amount{Value: a.Value.Mul(r.Value), Currency: r.To}, nil
+}
+
+// Cross divides r by other quoted for the same currency, e.g. EUR in RUB by
+// EUR in GEL gives GEL in RUB.
+func (r Rate) Cross(other Rate) (Rate, error) {
+	if r.From != other.From {
+		return Rate{}, fmt.Errorf("failed to cross %s/%s with %s/%s", r.From, r.To, other.From, other.To)
+	}
+	value, err := r.Value.Div(other.Value)
+	if err != nil {
+		return Rate{}, fmt.Errorf("failed to cross %s/%s with %s/%s: %s", r.From, r.To, other.From, other.To, err)
+	}
+	return Rate{From: other.To, To: r.To, Value: value}, nil
+}
+
+func (r Rate) String() string {
+	return fmt.Sprintf("%s/%s %s", r.From, r.To, r.Value)
+}
@@ -0,0 +1,146 @@
+package money_test
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/money"
+)
+
+func TestParse(t *testing.T) {
+	for text, want := range map[string]string{
+		"1234.5":     "1234.5",
+		"1 234,50":   "1234.5",
+		"-3":         "-3",
+		"+0,1":       "0.1",
+		".5":         "0.5",
+		"0.1234565":  "0.123457",
+		"-0.1234565": "-0.123457",
+		"007":        "7",
+	} {
+		got, err := money.Parse(text)
+		if err != nil || got.String() != want {
+			t.Errorf("Parse(%q) = %s, %v, want %s", text, got, err, want)
+		}
+	}
+	for _, text := range []string{"", "abc", "1.2.3", "1,2.3", "-", "12e3", "1000000000000", "+-5", "--5", "++5"} {
+		if got, err := money.Parse(text); err == nil {
+			t.Errorf("Parse(%q) = %s, want an error", text, got)
+		}
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	// 0.1 + 0.2 is not 0.3 in float64
+	tenth, err := money.FromFloat(0.1)
+	if err != nil {
+		t.Fatalf("FromFloat() error = %v", err)
+	}
+	fifth, err := money.FromFloat(0.2)
+	if err != nil {
+		t.Fatalf("FromFloat() error = %v", err)
+	}
+	var total money.Decimal
+	for i := 0; i < 10; i++ {
+		total = total.Add(tenth).Add(fifth)
+	}
+	if total.Cmp(money.MustParse("3")) != 0 {
+		t.Errorf("sum = %s, want 3", total)
+	}
+
+	if got := money.MustParse("1.5").Mul(money.MustParse("-2.25")); got.String() != "-3.375" {
+		t.Errorf("Mul() = %s", got)
+	}
+	if got, err := money.MustParse("100.12").Div(money.MustParse("2.875")); err != nil || got.String() != "34.824348" {
+		t.Errorf("Div() = %s, %v", got, err)
+	}
+	if _, err := money.MustParse("1").Div(money.Decimal{}); err == nil {
+		t.Errorf("Div() by zero did not fail")
+	}
+	if got := money.New(12345, -4).Round(3); got.String() != "1.235" {
+		t.Errorf("Round() = %s, want half away from zero", got)
+	}
+	if got := money.MustParse("-2.5").Round(0); got.String() != "-3" {
+		t.Errorf("Round() = %s", got)
+	}
+	if got := money.MustParse("1234.505").Minor(2); got != 123451 {
+		t.Errorf("Minor() = %d", got)
+	}
+	if got := money.MustParse("-0.5").Fixed(2); got != "-0.50" {
+		t.Errorf("Fixed() = %s", got)
+	}
+	if got := money.MustParse("7").Fixed(0); got != "7" {
+		t.Errorf("Fixed() = %s", got)
+	}
+}
+
+func TestOverflow(t *testing.T) {
+	for _, f := range []float64{1e12, -1e15, math.NaN(), math.Inf(1)} {
+		if got, err := money.FromFloat(f); err == nil {
+			t.Errorf("FromFloat(%v) = %s, want an error", f, got)
+		}
+	}
+
+	large := money.MustParse("999999999999")
+	if got := money.Max.Add(large); got != money.Max {
+		t.Errorf("Max + %s = %s, want Max", large, got)
+	}
+	if got := money.Min.Sub(large); got != money.Min {
+		t.Errorf("Min - %s = %s, want Min", large, got)
+	}
+	if got := large.Mul(large); got != money.Max {
+		t.Errorf("Mul() = %s, want Max", got)
+	}
+	if got := large.Neg().Mul(large); got != money.Min {
+		t.Errorf("Mul() = %s, want Min", got)
+	}
+	if got, err := large.Div(money.MustParse("0.000001")); err == nil {
+		t.Errorf("Div() = %s, want the quotient too large", got)
+	}
+	if got := money.Max.Minor(8); got != math.MaxInt64 {
+		t.Errorf("Minor() = %d, want the largest int64", got)
+	}
+	if got := money.New(math.MaxInt64, 3); got != money.Max {
+		t.Errorf("New() = %s, want Max", got)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var got struct {
+		Old    money.Decimal
+		Quoted money.Decimal
+		Exp    money.Decimal
+	}
+	if err := json.Unmarshal([]byte(`{"Old": 120.5, "Quoted": "99.9", "Exp": 1e3}`), &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if got.Old.String() != "120.5" || got.Quoted.String() != "99.9" || got.Exp.String() != "1000" {
+		t.Errorf("Unmarshal() = %+v", got)
+	}
+	data, err := json.Marshal(got)
+	if err != nil || string(data) != `{"Old":120.5,"Quoted":99.9,"Exp":1000}` {
+		t.Errorf("Marshal() = %s, %v", data, err)
+	}
+}
+
+func TestRate(t *testing.T) {
+	usd := money.Rate{From: "USD", To: money.Base, Value: money.MustParse("92.41")}
+	got, err := usd.Convert(money.Amount{Value: money.MustParse("10.5"), Currency: "usd"})
+	if err != nil || got.String() != "970.305 RUB" {
+		t.Errorf("Convert() = %s, %v", got, err)
+	}
+	if _, err := usd.Convert(money.Amount{Value: money.MustParse("1")}); err == nil {
+		t.Errorf("Convert() of rubles did not fail")
+	}
+
+	eurRub := money.Rate{From: "EUR", To: "RUB", Value: money.MustParse("100.12")}
+	eurGel := money.Rate{From: "EUR", To: "GEL", Value: money.MustParse("2.875")}
+	gel, err := eurRub.Cross(eurGel)
+	if err != nil || gel.From != "GEL" || gel.To != "RUB" || gel.Value.String() != "34.824348" {
+		t.Errorf("Cross() = %s, %v", gel, err)
+	}
+	if _, err := eurRub.Cross(usd); err == nil {
+		t.Errorf("Cross() of rates for different currencies did not fail")
+	}
+}
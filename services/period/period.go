@@ -0,0 +1,117 @@
+package period
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Period is the half-open time range [Start, End).
+type Period struct {
+	Start time.Time
+	End   time.Time
+
+	// years, months and days are the length used to step to the previous period
+	years, months, days int
+}
+
+// Kind is the length of a period, messages describe periods by it.
+type Kind int
+
+const (
+	Daily Kind = iota
+	Weekly
+	Monthly
+	Yearly
+)
+
+// Parse reads a period argument, relative periods are counted from now.
+// Calendar boundaries are taken in the location of now.
+func Parse(arg string, now time.Time) (Period, error) {
+	arg = strings.ToLower(strings.TrimSpace(arg))
+	loc := now.Location()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+
+	switch arg {
+	case "today", "сегодня":
+		return Day(today), nil
+	case "week", "неделя":
+		// weeks start on Monday
+		offset := (int(today.Weekday()) + 6) % 7
+		return Week(today.AddDate(0, 0, -offset)), nil
+	case "month", "месяц":
+		return Month(now.Year(), now.Month(), loc), nil
+	case "year", "год":
+		return Year(now.Year(), loc), nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", arg, loc); err == nil {
+		return Day(t), nil
+	}
+	if t, err := time.ParseInLocation("2006-01", arg, loc); err == nil {
+		return Month(t.Year(), t.Month(), loc), nil
+	}
+	if t, err := time.ParseInLocation("2006", arg, loc); err == nil {
+		return Year(t.Year(), loc), nil
+	}
+
+	return Period{}, fmt.Errorf("unknown period %q", arg)
+}
+
+// Day is the calendar day of t in its location.
+func Day(t time.Time) Period {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return Period{Start: start, End: start.AddDate(0, 0, 1), days: 1}
+}
+
+// Week is the seven days starting at the day of t.
+func Week(t time.Time) Period {
+	start := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return Period{Start: start, End: start.AddDate(0, 0, 7), days: 7}
+}
+
+// Month is the calendar month of year in loc.
+func Month(year int, month time.Month, loc *time.Location) Period {
+	start := time.Date(year, month, 1, 0, 0, 0, 0, loc)
+	return Period{Start: start, End: start.AddDate(0, 1, 0), months: 1}
+}
+
+// Year is the calendar year in loc.
+func Year(year int, loc *time.Location) Period {
+	start := time.Date(year, time.January, 1, 0, 0, 0, 0, loc)
+	return Period{Start: start, End: start.AddDate(1, 0, 0), years: 1}
+}
+
+// Kind tells whether p is a day, a week, a month or a year.
+func (p Period) Kind() Kind {
+	switch {
+	case p.years > 0:
+		return Yearly
+	case p.months > 0:
+		return Monthly
+	case p.days == 7:
+		return Weekly
+	default:
+		return Daily
+	}
+}
+
+// Previous returns the period of the same kind right before p.
+func (p Period) Previous() Period {
+	start := p.Start.AddDate(-p.years, -p.months, -p.days)
+	switch p.Kind() {
+	case Yearly:
+		return Year(start.Year(), start.Location())
+	case Monthly:
+		return Month(start.Year(), start.Month(), start.Location())
+	case Weekly:
+		return Week(start)
+	default:
+		return Day(start)
+	}
+}
+
+// Contains reports whether t falls into the period.
+func (p Period) Contains(t time.Time) bool {
+	return !t.Before(p.Start) && t.Before(p.End)
+}
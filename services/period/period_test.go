@@ -0,0 +1,83 @@
+package period_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/period"
+)
+
+func TestParse(t *testing.T) {
+	tbilisi := time.FixedZone("GET", 4*60*60)
+	// a Wednesday
+	now := time.Date(2026, 10, 14, 1, 30, 0, 0, tbilisi)
+
+	tests := []struct {
+		arg        string
+		start, end time.Time
+		kind       period.Kind
+	}{
+		{"today", time.Date(2026, 10, 14, 0, 0, 0, 0, tbilisi), time.Date(2026, 10, 15, 0, 0, 0, 0, tbilisi), period.Daily},
+		{"week", time.Date(2026, 10, 12, 0, 0, 0, 0, tbilisi), time.Date(2026, 10, 19, 0, 0, 0, 0, tbilisi), period.Weekly},
+		{"Month", time.Date(2026, 10, 1, 0, 0, 0, 0, tbilisi), time.Date(2026, 11, 1, 0, 0, 0, 0, tbilisi), period.Monthly},
+		{"год", time.Date(2026, 1, 1, 0, 0, 0, 0, tbilisi), time.Date(2027, 1, 1, 0, 0, 0, 0, tbilisi), period.Yearly},
+		{"2026-09", time.Date(2026, 9, 1, 0, 0, 0, 0, tbilisi), time.Date(2026, 10, 1, 0, 0, 0, 0, tbilisi), period.Monthly},
+		{"2025-12", time.Date(2025, 12, 1, 0, 0, 0, 0, tbilisi), time.Date(2026, 1, 1, 0, 0, 0, 0, tbilisi), period.Monthly},
+		{"2026-02-28", time.Date(2026, 2, 28, 0, 0, 0, 0, tbilisi), time.Date(2026, 3, 1, 0, 0, 0, 0, tbilisi), period.Daily},
+		{"2024", time.Date(2024, 1, 1, 0, 0, 0, 0, tbilisi), time.Date(2025, 1, 1, 0, 0, 0, 0, tbilisi), period.Yearly},
+	}
+
+	for _, tt := range tests {
+		p, err := period.Parse(tt.arg, now)
+		if err != nil {
+			t.Errorf("Parse(%q) error = %v", tt.arg, err)
+			continue
+		}
+		if !p.Start.Equal(tt.start) || !p.End.Equal(tt.end) || p.Kind() != tt.kind {
+			t.Errorf("Parse(%q) = %v - %v %v, want %v - %v %v", tt.arg, p.Start, p.End, p.Kind(), tt.start, tt.end, tt.kind)
+		}
+	}
+
+	for _, arg := range []string{"someday", "2026-13", "26-09"} {
+		if _, err := period.Parse(arg, now); err == nil {
+			t.Errorf("Parse(%q) error = nil, want error", arg)
+		}
+	}
+}
+
+func TestContains(t *testing.T) {
+	p := period.Month(2026, time.September, time.UTC)
+
+	if !p.Contains(time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("period does not contain its start")
+	}
+	if p.Contains(time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Error("period contains its end")
+	}
+	// 03:30 on October 1 in Tbilisi is still September in UTC
+	if !p.Contains(time.Date(2026, 10, 1, 3, 30, 0, 0, time.FixedZone("GET", 4*60*60))) {
+		t.Error("period does not contain a time given in another zone")
+	}
+}
+
+func TestPrevious(t *testing.T) {
+	now := time.Date(2026, 3, 31, 12, 0, 0, 0, time.UTC)
+
+	tests := map[string]time.Time{
+		"today":   time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC),
+		"week":    time.Date(2026, 3, 23, 0, 0, 0, 0, time.UTC),
+		"month":   time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC),
+		"2026-01": time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC),
+		"year":    time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	for arg, want := range tests {
+		p, err := period.Parse(arg, now)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", arg, err)
+		}
+		previous := p.Previous()
+		if !previous.Start.Equal(want) || !previous.End.Equal(p.Start) || previous.Kind() != p.Kind() {
+			t.Errorf("Parse(%q).Previous() = %v - %v, want %v - %v", arg, previous.Start, previous.End, want, p.Start)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/sheets"
+	"github.com/kn9ka/fundbot-go/services/store"
+)
+
+const (
+	MinRetryDelay = 5 * time.Second
+	MaxRetryDelay = 10 * time.Minute
+)
+
+// Writer is the part of the ledger the queue syncs entries to.
+type Writer interface {
+	Write(expenses []sheets.Expense) bool
+}
+
+type Entry struct {
+	Id int64 `json:"id"`
+	// ChatId is the chat the entry was queued from.
+	ChatId   int64            `json:"chatId,omitempty"`
+	Expenses []sheets.Expense `json:"expenses"`
+	Summary  string           `json:"summary"`
+	QueuedAt time.Time        `json:"queuedAt"`
+	Attempts int              `json:"attempts"`
+}
+
+type state struct {
+	LastId  int64   `json:"lastId"`
+	Entries []Entry `json:"entries"`
+}
+
+// Queue durably keeps ledger appends that failed and retries them with
+// exponential backoff until the ledger accepts them.
+type Queue struct {
+	mu      sync.Mutex
+	syncing sync.Mutex
+	file    *store.File
+	state   state
+	writer  Writer
+	wake    chan struct{}
+	// dirty is set while the state on disk lags behind, e.g. still lists
+	// an entry that was written.
+	dirty bool
+}
+
+func New(path string, writer Writer) (*Queue, error) {
+	q := &Queue{
+		file:   store.NewFile(path),
+		writer: writer,
+		wake:   make(chan struct{}, 1),
+	}
+
+	if err := q.file.Load(&q.state); err != nil {
+		return nil, err
+	}
+	if len(q.state.Entries) > 0 {
+		log.Printf("%d pending ledger entries loaded from %s", len(q.state.Entries), path)
+	}
+
+	return q, nil
+}
+
+// Push persists expenses queued from chatId to be written later. Summary is
+// a human readable description shown by Pending.
+func (q *Queue) Push(chatId int64, expenses []sheets.Expense, summary string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.state.LastId++
+	q.state.Entries = append(q.state.Entries, Entry{
+		Id:       q.state.LastId,
+		ChatId:   chatId,
+		Expenses: expenses,
+		Summary:  summary,
+		QueuedAt: time.Now(),
+	})
+
+	dirty := q.dirty
+	if err := q.save(); err != nil {
+		q.state.Entries = q.state.Entries[:len(q.state.Entries)-1]
+		q.dirty = dirty
+		return err
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns a copy of the entries not synced yet, oldest first.
+func (q *Queue) Pending() []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := make([]Entry, len(q.state.Entries))
+	copy(entries, q.state.Entries)
+	return entries
+}
+
+// PendingIn returns the entries queued from chatId, oldest first.
+func (q *Queue) PendingIn(chatId int64) []Entry {
+	var entries []Entry
+	for _, entry := range q.Pending() {
+		if entry.ChatId == chatId {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Run retries pending entries until ctx is cancelled. The delay between
+// attempts doubles after every failure and resets once the ledger is back.
+func (q *Queue) Run(ctx context.Context) {
+	delay := MinRetryDelay
+
+	for {
+		if len(q.Pending()) == 0 && !q.isDirty() {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			}
+		}
+
+		err := q.Flush(ctx)
+		if err == nil {
+			delay = MinRetryDelay
+			continue
+		}
+		log.Printf("Pending ledger entries not synced, retrying in %v: %v", delay, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > MaxRetryDelay {
+			delay = MaxRetryDelay
+		}
+	}
+}
+
+// Flush tries to write every pending entry in order and stops at the first
+// failure, so entries keep the order they were queued in. Nothing is written
+// while the queue file cannot be updated, a written entry left in it would be
+// written again after a restart.
+func (q *Queue) Flush(ctx context.Context) error {
+	q.syncing.Lock()
+	defer q.syncing.Unlock()
+
+	if err := q.persist(); err != nil {
+		return err
+	}
+
+	for _, entry := range q.Pending() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		ok := q.writer.Write(entry.Expenses)
+		if err := q.complete(entry.Id, ok); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("failed to write entry %d", entry.Id)
+		}
+		log.Printf("Pending ledger entry %d synced", entry.Id)
+	}
+	return nil
+}
+
+func (q *Queue) complete(id int64, ok bool) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := range q.state.Entries {
+		if q.state.Entries[i].Id != id {
+			continue
+		}
+		if ok {
+			q.state.Entries = append(q.state.Entries[:i], q.state.Entries[i+1:]...)
+		} else {
+			q.state.Entries[i].Attempts++
+		}
+		break
+	}
+
+	q.dirty = true
+	return q.save()
+}
+
+func (q *Queue) isDirty() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dirty
+}
+
+// persist saves the state if an earlier save failed.
+func (q *Queue) persist() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if !q.dirty {
+		return nil
+	}
+	return q.save()
+}
+
+// save writes the state to disk, q.mu must be held.
+func (q *Queue) save() error {
+	if err := q.file.Save(q.state); err != nil {
+		q.dirty = true
+		return err
+	}
+	q.dirty = false
+	return nil
+}
@@ -0,0 +1,145 @@
+package queue_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/queue"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+// writer records the expenses written to it while up.
+type writer struct {
+	mu      sync.Mutex
+	down    bool
+	written []sheets.Expense
+}
+
+func (w *writer) Write(expenses []sheets.Expense) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.down {
+		return false
+	}
+	w.written = append(w.written, expenses...)
+	return true
+}
+
+func (w *writer) setDown(down bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.down = down
+}
+
+func expense(id int64, reason string) []sheets.Expense {
+	return []sheets.Expense{{Id: id, Amount: money.New(100, 0), Reason: reason, Active: true}}
+}
+
+func TestFlushKeepsOrderAndCountsAttempts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending.json")
+	w := &writer{down: true}
+	q, err := queue.New(path, w)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if err := q.Push(-100, expense(1, "tea"), "tea"); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+	if err := q.Push(-200, expense(2, "coffee"), "coffee"); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	if err := q.Flush(context.Background()); err == nil {
+		t.Errorf("Flush() error = nil while the ledger is down")
+	}
+	pending := q.Pending()
+	if len(pending) != 2 || pending[0].Attempts != 1 || pending[1].Attempts != 0 {
+		t.Errorf("Pending() = %+v, want the first entry tried once and the second untouched", pending)
+	}
+
+	// entries survive a restart
+	w.setDown(false)
+	reloaded, err := queue.New(path, w)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := reloaded.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if len(w.written) != 2 || w.written[0].Reason != "tea" || w.written[1].Reason != "coffee" {
+		t.Errorf("written = %+v, want tea then coffee", w.written)
+	}
+	if pending := reloaded.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() = %+v, want none", pending)
+	}
+}
+
+func TestPendingIn(t *testing.T) {
+	q, err := queue.New(filepath.Join(t.TempDir(), "pending.json"), &writer{down: true})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	_ = q.Push(-100, expense(1, "tea"), "tea")
+	_ = q.Push(-200, expense(2, "coffee"), "coffee")
+
+	entries := q.PendingIn(-200)
+	if len(entries) != 1 || entries[0].Summary != "coffee" {
+		t.Errorf("PendingIn() = %+v, want only the entry of the chat", entries)
+	}
+	if entries := q.PendingIn(-300); len(entries) != 0 {
+		t.Errorf("PendingIn() of another chat = %+v, want none", entries)
+	}
+}
+
+func TestWrittenEntryIsNotWrittenAgainWhenSaveFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pending.json")
+	w := &writer{}
+	q, err := queue.New(path, w)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if err := q.Push(-100, expense(1, "tea"), "tea"); err != nil {
+		t.Fatalf("Push() error = %v", err)
+	}
+
+	// a directory in place of the file makes every save fail
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := q.Flush(context.Background()); err == nil {
+		t.Errorf("Flush() error = nil, want the failed save")
+	}
+	if err := q.Flush(context.Background()); err == nil {
+		t.Errorf("second Flush() error = nil, want the failed save")
+	}
+	if len(w.written) != 1 {
+		t.Errorf("written = %+v, want the entry written once", w.written)
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v once the file can be saved", err)
+	}
+	reloaded, err := queue.New(path, w)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if pending := reloaded.Pending(); len(pending) != 0 {
+		t.Errorf("Pending() after a restart = %+v, want the written entry gone", pending)
+	}
+	if len(w.written) != 1 {
+		t.Errorf("written = %+v, want the entry written once", w.written)
+	}
+}
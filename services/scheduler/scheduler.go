@@ -0,0 +1,245 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/store"
+)
+
+type Job string
+
+const (
+	// Summary posts the debts of the chat, as /list does.
+	Summary Job = "summary"
+	// Rates posts the exchange rates, as /rates does.
+	Rates Job = "rates"
+	// Reminders mentions users whose balance reached the threshold.
+	Reminders Job = "reminders"
+)
+
+// Jobs are the known jobs with their default cron expressions.
+var Jobs = map[Job]string{
+	Summary:   "0 10 * * 1",
+	Rates:     "0 9 * * *",
+	Reminders: "0 19 * * 5",
+}
+
+// MissedRunGrace is how long before a start a missed run is still made up for.
+const MissedRunGrace = 10 * time.Minute
+
+type Schedule struct {
+	Id     int64  `json:"id"`
+	ChatId int64  `json:"chatId"`
+	Job    Job    `json:"job"`
+	Spec   string `json:"spec"`
+	// Threshold is the balance reminders start at.
+	Threshold money.Decimal `json:"threshold,omitempty"`
+	// Lang is the language of the user who added the schedule.
+	Lang      string    `json:"lang,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	LastRun   time.Time `json:"lastRun,omitempty"`
+}
+
+type state struct {
+	LastId    int64      `json:"lastId"`
+	Schedules []Schedule `json:"schedules"`
+}
+
+// Scheduler keeps per-chat schedules on disk and runs them in location.
+type Scheduler struct {
+	mu       sync.Mutex
+	file     *store.File
+	state    state
+	location *time.Location
+	started  time.Time
+	wake     chan struct{}
+}
+
+func New(path string, location *time.Location) (*Scheduler, error) {
+	s := &Scheduler{
+		file:     store.NewFile(path),
+		location: location,
+		started:  time.Now(),
+		wake:     make(chan struct{}, 1),
+	}
+	if err := s.file.Load(&s.state); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Add validates and stores a schedule, the id is assigned by the scheduler.
+func (s *Scheduler) Add(schedule Schedule) (Schedule, error) {
+	if _, ok := Jobs[schedule.Job]; !ok {
+		return Schedule{}, fmt.Errorf("unknown job %q", schedule.Job)
+	}
+	if _, err := ParseSpec(schedule.Spec); err != nil {
+		return Schedule{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.LastId++
+	schedule.Id = s.state.LastId
+	schedule.CreatedAt = time.Now()
+	s.state.Schedules = append(s.state.Schedules, schedule)
+
+	if err := s.file.Save(s.state); err != nil {
+		s.state.Schedules = s.state.Schedules[:len(s.state.Schedules)-1]
+		return Schedule{}, err
+	}
+	s.notify()
+	return schedule, nil
+}
+
+// Remove deletes a schedule of the chat and reports whether it existed.
+func (s *Scheduler) Remove(chatId, id int64) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, schedule := range s.state.Schedules {
+		if schedule.Id != id || schedule.ChatId != chatId {
+			continue
+		}
+		schedules := s.state.Schedules
+		s.state.Schedules = append(append([]Schedule(nil), schedules[:i]...), schedules[i+1:]...)
+		if err := s.file.Save(s.state); err != nil {
+			s.state.Schedules = schedules
+			return false, err
+		}
+		s.notify()
+		return true, nil
+	}
+	return false, nil
+}
+
+// List returns the schedules of the chat ordered by id.
+func (s *Scheduler) List(chatId int64) []Schedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []Schedule
+	for _, schedule := range s.state.Schedules {
+		if schedule.ChatId == chatId {
+			result = append(result, schedule)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Id < result[j].Id })
+	return result
+}
+
+// Next returns when the schedule runs next. Runs missed while the bot was
+// stopped are not repeated, except the ones within MissedRunGrace of the start.
+func (s *Scheduler) Next(schedule Schedule) time.Time {
+	spec, err := ParseSpec(schedule.Spec)
+	if err != nil {
+		return time.Time{}
+	}
+
+	after := s.started.Add(-MissedRunGrace)
+	for _, t := range []time.Time{schedule.LastRun, schedule.CreatedAt} {
+		if t.After(after) {
+			after = t
+		}
+	}
+	return spec.Next(after.In(s.location))
+}
+
+// Due returns the schedules that should have run by now.
+func (s *Scheduler) Due(now time.Time) []Schedule {
+	s.mu.Lock()
+	schedules := append([]Schedule(nil), s.state.Schedules...)
+	s.mu.Unlock()
+
+	var due []Schedule
+	for _, schedule := range schedules {
+		if next := s.Next(schedule); !next.IsZero() && !next.After(now) {
+			due = append(due, schedule)
+		}
+	}
+	return due
+}
+
+// MarkRun records a run, so the schedule is not due again until its next time.
+func (s *Scheduler) MarkRun(id int64, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.state.Schedules {
+		if s.state.Schedules[i].Id == id {
+			s.state.Schedules[i].LastRun = at
+			return s.file.Save(s.state)
+		}
+	}
+	return nil
+}
+
+// Run calls handler for every due schedule until ctx is cancelled. Jobs run
+// one at a time, Run returns once the current one finished.
+func (s *Scheduler) Run(ctx context.Context, handler func(ctx context.Context, schedule Schedule)) {
+	for {
+		now := time.Now()
+		for _, schedule := range s.Due(now) {
+			if ctx.Err() != nil {
+				return
+			}
+			handler(ctx, schedule)
+			// a job cut short by shutdown has to run again after the restart
+			if ctx.Err() != nil {
+				return
+			}
+			if err := s.MarkRun(schedule.Id, now); err != nil {
+				log.Printf("Unable to save run of schedule %d: %v", schedule.Id, err)
+			}
+		}
+
+		timer := time.NewTimer(s.untilNext(time.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// maxSleep makes Run recheck schedules after clock jumps.
+const maxSleep = time.Hour
+
+func (s *Scheduler) untilNext(now time.Time) time.Duration {
+	s.mu.Lock()
+	schedules := append([]Schedule(nil), s.state.Schedules...)
+	s.mu.Unlock()
+
+	wait := maxSleep
+	for _, schedule := range schedules {
+		next := s.Next(schedule)
+		if next.IsZero() {
+			continue
+		}
+		if d := next.Sub(now); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+// notify wakes Run after the schedules changed, s.mu must be held.
+func (s *Scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,192 @@
+package scheduler_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/scheduler"
+)
+
+func TestSpecNext(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+	// a Monday
+	from := time.Date(2026, 10, 19, 9, 30, 15, 0, moscow)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 19, 9, 31, 0, 0, moscow)},
+		{"0 9 * * *", time.Date(2026, 10, 20, 9, 0, 0, 0, moscow)},
+		{"45 9 * * *", time.Date(2026, 10, 19, 9, 45, 0, 0, moscow)},
+		{"*/20 * * * *", time.Date(2026, 10, 19, 9, 40, 0, 0, moscow)},
+		{"0 10 * * 1", time.Date(2026, 10, 19, 10, 0, 0, 0, moscow)},
+		{"0 10 * * 0", time.Date(2026, 10, 25, 10, 0, 0, 0, moscow)},
+		{"0 10 * * 7", time.Date(2026, 10, 25, 10, 0, 0, 0, moscow)},
+		{"0 9 * * 6-7", time.Date(2026, 10, 24, 9, 0, 0, 0, moscow)},
+		{"0 0 1,15 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, moscow)},
+		// either day matches when both are restricted
+		{"0 12 25 * 3", time.Date(2026, 10, 21, 12, 0, 0, 0, moscow)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, moscow)},
+		{"@monthly", time.Date(2026, 11, 1, 0, 0, 0, 0, moscow)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		spec, err := scheduler.ParseSpec(tt.expr)
+		if err != nil {
+			t.Errorf("ParseSpec(%q) error = %v", tt.expr, err)
+			continue
+		}
+		if got := spec.Next(from); !got.Equal(tt.want) {
+			t.Errorf("ParseSpec(%q).Next() = %v, want %v", tt.expr, got, tt.want)
+		}
+	}
+
+	for _, expr := range []string{"", "0 9 * *", "60 * * * *", "0 9 * * 8", "a * * * *", "*/0 * * * *", "5-1 * * * *"} {
+		if _, err := scheduler.ParseSpec(expr); err == nil {
+			t.Errorf("ParseSpec(%q) error = nil, want error", expr)
+		}
+	}
+}
+
+func TestSchedulesArePersisted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	s, err := scheduler.New(path, time.UTC)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	first, err := s.Add(scheduler.Schedule{ChatId: 1, Job: scheduler.Rates, Spec: "0 9 * * *"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := s.Add(scheduler.Schedule{ChatId: 1, Job: scheduler.Reminders, Spec: "0 19 * * 5", Threshold: money.MustParse("500")}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := s.Add(scheduler.Schedule{ChatId: 2, Job: scheduler.Summary, Spec: "@weekly"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if _, err := s.Add(scheduler.Schedule{ChatId: 1, Job: "dance", Spec: "@daily"}); err == nil {
+		t.Error("Add() of an unknown job error = nil")
+	}
+	if _, err := s.Add(scheduler.Schedule{ChatId: 1, Job: scheduler.Rates, Spec: "every day"}); err == nil {
+		t.Error("Add() of an invalid spec error = nil")
+	}
+
+	if removed, _ := s.Remove(2, first.Id); removed {
+		t.Error("Remove() removed a schedule of another chat")
+	}
+	if removed, err := s.Remove(1, first.Id); err != nil || !removed {
+		t.Errorf("Remove() = %v, %v", removed, err)
+	}
+
+	reloaded, err := scheduler.New(path, time.UTC)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	got := reloaded.List(1)
+	if len(got) != 1 || got[0].Job != scheduler.Reminders || got[0].Threshold.Cmp(money.MustParse("500")) != 0 || got[0].Id != 2 {
+		t.Errorf("List(1) = %+v, want the reminders schedule", got)
+	}
+	if got := reloaded.List(2); len(got) != 1 || got[0].Spec != "@weekly" {
+		t.Errorf("List(2) = %+v, want the summary schedule", got)
+	}
+}
+
+func TestRemoveKeepsScheduleWhenSaveFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	s, err := scheduler.New(path, time.UTC)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	schedule, err := s.Add(scheduler.Schedule{ChatId: 1, Job: scheduler.Rates, Spec: "0 9 * * *"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// a directory in place of the file makes every save fail
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(path, "blocked"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	if removed, err := s.Remove(1, schedule.Id); removed || err == nil {
+		t.Errorf("Remove() = %v, %v, want the failed save", removed, err)
+	}
+	if got := s.List(1); len(got) != 1 || got[0].Id != schedule.Id {
+		t.Errorf("List() = %+v, want the schedule kept", got)
+	}
+}
+
+func TestDue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	s, err := scheduler.New(path, time.UTC)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	schedule, err := s.Add(scheduler.Schedule{ChatId: 1, Job: scheduler.Rates, Spec: "* * * * *"})
+	if err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	now := time.Now()
+	if due := s.Due(now); len(due) != 0 {
+		t.Errorf("Due(now) = %+v, want nothing before the next minute", due)
+	}
+	later := now.Add(2 * time.Minute)
+	if due := s.Due(later); len(due) != 1 || due[0].Id != schedule.Id {
+		t.Fatalf("Due(+2m) = %+v, want the schedule", due)
+	}
+
+	if err := s.MarkRun(schedule.Id, later); err != nil {
+		t.Fatalf("MarkRun() error = %v", err)
+	}
+	if due := s.Due(later); len(due) != 0 {
+		t.Errorf("Due() after MarkRun = %+v, want nothing", due)
+	}
+	if next := s.Next(s.List(1)[0]); !next.After(later) {
+		t.Errorf("Next() = %v, want after the last run %v", next, later)
+	}
+}
+
+func TestRunDoesNotMarkJobsCutShort(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	created := time.Now().Add(-2 * time.Minute).UTC().Format(time.RFC3339)
+	content := `{"lastId": 1, "schedules": [{"id": 1, "chatId": 1, "job": "rates", "spec": "* * * * *", "createdAt": "` + created + `"}]}`
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	s, err := scheduler.New(path, time.UTC)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runs := 0
+	s.Run(ctx, func(ctx context.Context, schedule scheduler.Schedule) {
+		runs++
+		// shutdown while the job is posting
+		cancel()
+	})
+
+	if runs != 1 {
+		t.Fatalf("handler ran %d times, want once", runs)
+	}
+	if got := s.List(1); len(got) != 1 || !got[0].LastRun.IsZero() {
+		t.Errorf("List() = %+v, want the run not recorded", got)
+	}
+	if due := s.Due(time.Now()); len(due) != 1 {
+		t.Errorf("Due() = %+v, want the schedule still due", due)
+	}
+}
@@ -0,0 +1,528 @@
+package sheets
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/money"
+)
+
+type Kind int
+
+const (
+	Text Kind = iota
+	Integer
+	Number
+	Bool
+	// Date cells hold date serial numbers, the days since 1899-12-30.
+	Date
+)
+
+// Column describes a ledger column, the header names it is recognised by
+// and the Expense field it is decoded into. Optional columns are only kept
+// in the sheet when enabled in the configuration.
+type Column struct {
+	Name     string
+	Aliases  []string
+	Kind     Kind
+	Required bool
+	Optional bool
+	set      func(e *Expense, value interface{})
+	get      func(e Expense) interface{}
+}
+
+// Columns are all known ledger columns, in the order of the legacy A:G
+// layout followed by the newer ones.
+var Columns = []Column{
+	{
+		Name: "id", Aliases: []string{"№"}, Kind: Integer,
+		set: func(e *Expense, v interface{}) { e.Id = v.(int64) },
+		get: func(e Expense) interface{} { return e.Id },
+	},
+	{
+		Name: "amount", Aliases: []string{"сумма", "сумма операции", "cost"}, Kind: Number, Required: true,
+		set: func(e *Expense, v interface{}) { e.Amount = v.(money.Decimal) },
+		// the decimal goes out as a JSON number, e.g. 120.5, not through float64
+		get: func(e Expense) interface{} { return e.Amount },
+	},
+	{
+		Name: "reason", Aliases: []string{"причина", "описание", "description"}, Kind: Text,
+		set: func(e *Expense, v interface{}) { e.Reason = v.(string) },
+		get: func(e Expense) interface{} { return e.Reason },
+	},
+	{
+		Name: "from", Aliases: []string{"откуда"}, Kind: Text,
+		set: func(e *Expense, v interface{}) { e.From = v.(string) },
+		get: func(e Expense) interface{} { return e.From },
+	},
+	{
+		Name: "date", Aliases: []string{"дата", "дата операции"}, Kind: Date,
+		set: func(e *Expense, v interface{}) { e.Date = v.(time.Time) },
+		get: func(e Expense) interface{} { return e.Date },
+	},
+	{
+		// rows of users without a username only have their user_id
+		Name: "username", Aliases: []string{"user", "пользователь"}, Kind: Text,
+		set: func(e *Expense, v interface{}) { e.Username = v.(string) },
+		get: func(e Expense) interface{} { return e.Username },
+	},
+	{
+		Name: "active", Aliases: []string{"активно"}, Kind: Bool,
+		set: func(e *Expense, v interface{}) { e.Active = v.(bool) },
+		get: func(e Expense) interface{} { return e.Active },
+	},
+	{
+		Name: "category", Aliases: []string{"категория"}, Kind: Text,
+		set: func(e *Expense, v interface{}) { e.Category = v.(string) },
+		get: func(e Expense) interface{} { return e.Category },
+	},
+	{
+		Name: "user_id", Aliases: []string{"user id", "telegram id", "id пользователя"}, Kind: Integer,
+		set: func(e *Expense, v interface{}) { e.UserId = v.(int64) },
+		get: func(e Expense) interface{} {
+			if e.UserId == 0 {
+				return ""
+			}
+			return e.UserId
+		},
+	},
+	{
+		Name: "chat_id", Aliases: []string{"chat id", "чат"}, Kind: Integer,
+		set: func(e *Expense, v interface{}) { e.ChatId = v.(int64) },
+		get: func(e Expense) interface{} {
+			if e.ChatId == 0 {
+				return ""
+			}
+			return e.ChatId
+		},
+	},
+	{
+		Name: "deleted", Aliases: []string{"удалено"}, Kind: Bool,
+		set: func(e *Expense, v interface{}) { e.Deleted = v.(bool) },
+		get: func(e Expense) interface{} {
+			if !e.Deleted {
+				return ""
+			}
+			return true
+		},
+	},
+	{
+		Name: "currency", Aliases: []string{"валюта", "валюта операции"}, Kind: Text, Optional: true,
+		set: func(e *Expense, v interface{}) { e.Currency = strings.ToUpper(v.(string)) },
+		get: func(e Expense) interface{} { return e.Currency },
+	},
+	{
+		Name: "participants", Aliases: []string{"участники"}, Kind: Text, Optional: true,
+		set: func(e *Expense, v interface{}) { e.Participants = splitList(v.(string)) },
+		get: func(e Expense) interface{} { return strings.Join(e.Participants, ", ") },
+	},
+	{
+		Name: "receipt", Aliases: []string{"чек"}, Kind: Text, Optional: true,
+		set: func(e *Expense, v interface{}) { e.Receipt = v.(string) },
+		get: func(e Expense) interface{} { return e.Receipt },
+	},
+}
+
+// EnabledColumns returns the standard columns followed by the optional ones
+// named in extra.
+func EnabledColumns(extra []string) ([]Column, error) {
+	enabled := map[string]bool{}
+	for _, name := range extra {
+		enabled[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+
+	var columns []Column
+	for _, column := range Columns {
+		if column.Optional && !enabled[column.Name] {
+			continue
+		}
+		delete(enabled, column.Name)
+		columns = append(columns, column)
+	}
+
+	if len(enabled) > 0 {
+		var unknown []string
+		for name := range enabled {
+			unknown = append(unknown, name)
+		}
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown sheet columns: %s", strings.Join(unknown, ", "))
+	}
+	return columns, nil
+}
+
+// Schema maps columns to their zero based positions in a sheet row. Dates
+// are written and read as wall clock time in location.
+type Schema struct {
+	columns   []Column
+	positions []int
+	location  *time.Location
+}
+
+// PositionalSchema lays the columns out one after another starting at A.
+func PositionalSchema(columns []Column, location *time.Location) Schema {
+	positions := make([]int, len(columns))
+	for i := range columns {
+		positions[i] = i
+	}
+	return Schema{columns: columns, positions: positions, location: location}
+}
+
+// HeaderSchema finds the columns in the header row by name or alias, case
+// insensitive. A header naming none of the A:G columns belongs to a sheet
+// from before the header mapping, which keeps them in the legacy layout.
+// Columns absent from the header are placed after it and returned as
+// missing, their names have to be added to the header.
+func HeaderSchema(header []interface{}, columns []Column, location *time.Location) (Schema, []Column) {
+	found := map[string]int{}
+	for i, cell := range header {
+		name := strings.ToLower(strings.TrimSpace(fmt.Sprint(cell)))
+		if _, ok := found[name]; !ok && name != "" {
+			found[name] = i
+		}
+	}
+
+	schema := Schema{columns: columns, positions: make([]int, len(columns)), location: location}
+	legacy := len(header) > 0
+	for _, column := range columns {
+		if _, ok := lookup(found, column); ok && legacyPosition(column.Name) >= 0 {
+			legacy = false
+		}
+	}
+
+	next := len(header)
+	if legacy && next < len(legacyColumns) {
+		next = len(legacyColumns)
+	}
+	var missing []Column
+	for i, column := range columns {
+		if position := legacyPosition(column.Name); legacy && position >= 0 {
+			schema.positions[i] = position
+			continue
+		}
+		if position, ok := lookup(found, column); ok {
+			schema.positions[i] = position
+			continue
+		}
+		schema.positions[i] = next
+		next++
+		missing = append(missing, column)
+	}
+
+	return schema, missing
+}
+
+// legacyColumns is the A:G layout used before the header row was read.
+var legacyColumns = []string{"id", "amount", "reason", "from", "date", "username", "active"}
+
+func legacyPosition(name string) int {
+	for i, legacy := range legacyColumns {
+		if legacy == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func lookup(found map[string]int, column Column) (int, bool) {
+	if position, ok := found[column.Name]; ok {
+		return position, true
+	}
+	for _, alias := range column.Aliases {
+		if position, ok := found[alias]; ok {
+			return position, true
+		}
+	}
+	return 0, false
+}
+
+// Width is the number of cells a row needs to hold every column.
+func (s Schema) Width() int {
+	width := 0
+	for _, position := range s.positions {
+		if position+1 > width {
+			width = position + 1
+		}
+	}
+	return width
+}
+
+func (s Schema) position(name string) int {
+	for i, column := range s.columns {
+		if column.Name == name {
+			return s.positions[i]
+		}
+	}
+	return -1
+}
+
+// Encode lays the expense out as a row for this schema.
+func (s Schema) Encode(e Expense) []interface{} {
+	row := make([]interface{}, s.Width())
+	for i := range row {
+		row[i] = ""
+	}
+	for i, column := range s.columns {
+		value := column.get(e)
+		if t, ok := value.(time.Time); ok {
+			value = ""
+			if !t.IsZero() {
+				value = DateSerial(t, s.location)
+			}
+		}
+		row[s.positions[i]] = value
+	}
+	return row
+}
+
+type ErrorKind int
+
+const (
+	MissingValue ErrorKind = iota
+	InvalidValue
+)
+
+// RowError points at a cell that could not be decoded. Row is the row
+// number as shown in the spreadsheet.
+type RowError struct {
+	Row    int
+	Column string
+	Kind   ErrorKind
+	Value  interface{}
+}
+
+func (e RowError) Error() string {
+	if e.Kind == MissingValue {
+		return fmt.Sprintf("row %d: %s is empty", e.Row, e.Column)
+	}
+	return fmt.Sprintf("row %d: invalid %s %q", e.Row, e.Column, fmt.Sprint(e.Value))
+}
+
+// DecodeRows decodes rows in the legacy A:G layout with dates in UTC, see
+// Schema.Decode.
+func DecodeRows(rows [][]interface{}, firstRow int) ([]Expense, []RowError) {
+	columns, _ := EnabledColumns(nil)
+	return PositionalSchema(columns, time.UTC).Decode(rows, firstRow)
+}
+
+// Decode converts rows as returned by the Sheets API into expenses.
+// firstRow is the spreadsheet row number of rows[0]. Cells may be missing,
+// since the API trims trailing empty cells, and may hold strings, numbers or
+// booleans. Empty and deleted rows are skipped, rows with invalid cells are
+// reported and left out of the result.
+func (s Schema) Decode(rows [][]interface{}, firstRow int) ([]Expense, []RowError) {
+	expenses := make([]Expense, 0, len(rows))
+	var errs []RowError
+
+	for i, row := range rows {
+		if isEmptyRow(row) {
+			continue
+		}
+
+		expense := Expense{Row: firstRow + i}
+		var rowErrs []RowError
+
+		for j, column := range s.columns {
+			var cell interface{}
+			if position := s.positions[j]; position < len(row) {
+				cell = row[position]
+			}
+
+			value, err := decodeCell(column.Kind, cell, s.location)
+			if err == nil && value == nil && column.Required {
+				err = &RowError{Kind: MissingValue}
+			}
+			if err != nil {
+				rowErrs = append(rowErrs, RowError{Row: firstRow + i, Column: column.Name, Kind: err.Kind, Value: cell})
+				continue
+			}
+			if value != nil {
+				column.set(&expense, value)
+			}
+		}
+
+		if expense.Deleted {
+			continue
+		}
+		if len(rowErrs) > 0 {
+			errs = append(errs, rowErrs...)
+			continue
+		}
+		expenses = append(expenses, expense)
+	}
+
+	return expenses, errs
+}
+
+// decodeCell returns nil for an empty cell.
+func decodeCell(kind Kind, cell interface{}, location *time.Location) (interface{}, *RowError) {
+	if s, ok := cell.(string); ok {
+		cell = strings.TrimSpace(s)
+	}
+	if cell == nil || cell == "" {
+		return nil, nil
+	}
+
+	invalid := &RowError{Kind: InvalidValue}
+
+	switch kind {
+	case Integer:
+		n, ok := toNumber(cell)
+		if !ok || n != math.Trunc(n) {
+			return nil, invalid
+		}
+		return int64(n), nil
+
+	case Number:
+		n, ok := toDecimal(cell)
+		if !ok {
+			return nil, invalid
+		}
+		return n, nil
+
+	case Date:
+		t, ok := toTime(cell, location)
+		if !ok {
+			return nil, invalid
+		}
+		return t, nil
+
+	case Bool:
+		switch v := cell.(type) {
+		case bool:
+			return v, nil
+		case float64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, nil
+			}
+		}
+		return nil, invalid
+
+	default:
+		switch v := cell.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strings.ToUpper(strconv.FormatBool(v)), nil
+		}
+		return fmt.Sprint(cell), nil
+	}
+}
+
+// toNumber accepts numeric cells as well as numbers typed as text, with a
+// decimal comma and spaces as thousands separators.
+func toNumber(cell interface{}) (float64, bool) {
+	switch v := cell.(type) {
+	case float64:
+		return v, true
+	case string:
+		s := strings.NewReplacer(" ", "", " ", "", ",", ".").Replace(v)
+		n, err := strconv.ParseFloat(s, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+// toDecimal is toNumber keeping the digits of numbers typed as text exact.
+func toDecimal(cell interface{}) (money.Decimal, bool) {
+	switch v := cell.(type) {
+	case float64:
+		n, err := money.FromFloat(v)
+		return n, err == nil
+	case string:
+		n, err := money.Parse(v)
+		return n, err == nil
+	}
+	return money.Decimal{}, false
+}
+
+// sheetsEpoch is day zero of date serial numbers.
+var sheetsEpoch = time.Date(1899, time.December, 30, 0, 0, 0, 0, time.UTC)
+
+// maxDateSerial is far beyond any real date, larger numbers are unix
+// timestamps written before dates were stored as serial numbers.
+const maxDateSerial = 1e6
+
+// DateSerial converts t to a date serial number of its wall clock time in location.
+func DateSerial(t time.Time, location *time.Location) float64 {
+	wall := t.In(location)
+	utc := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, time.UTC)
+	return utc.Sub(sheetsEpoch).Seconds() / 86400
+}
+
+// FromDateSerial converts a date serial number to wall clock time in location,
+// rounded to seconds.
+func FromDateSerial(serial float64, location *time.Location) time.Time {
+	seconds := int64(math.Round(serial * 86400))
+	utc := sheetsEpoch.Add(time.Duration(seconds) * time.Second)
+	return time.Date(utc.Year(), utc.Month(), utc.Day(), utc.Hour(), utc.Minute(), utc.Second(), 0, location)
+}
+
+// dateLayouts are accepted for dates typed as text.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02.01.2006 15:04:05",
+	"02.01.2006 15:04",
+	"02.01.2006",
+}
+
+// toTime accepts date serial numbers, legacy unix timestamps and dates typed
+// as text.
+func toTime(cell interface{}, location *time.Location) (time.Time, bool) {
+	if n, ok := toNumber(cell); ok {
+		if n > maxDateSerial {
+			return time.Unix(int64(n), 0).In(location), true
+		}
+		if n < 0 {
+			return time.Time{}, false
+		}
+		return FromDateSerial(n, location), true
+	}
+
+	s, ok := cell.(string)
+	if !ok {
+		return time.Time{}, false
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, location); err == nil {
+			return t.In(location), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// splitList splits a comma separated cell, dropping empty items.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func isEmptyRow(row []interface{}) bool {
+	for _, cell := range row {
+		if s, ok := cell.(string); ok {
+			cell = strings.TrimSpace(s)
+		}
+		if cell != nil && cell != "" {
+			return false
+		}
+	}
+	return true
+}
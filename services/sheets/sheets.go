@@ -2,77 +2,342 @@ package sheets
 
 import (
 	"context"
+	"fmt"
+	"github.com/kn9ka/fundbot-go/services/config"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/period"
 	"golang.org/x/oauth2/google"
 	"log"
 	"os"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
+// DateFormat is the number format pattern of the date column.
+const DateFormat = "dd.mm.yyyy hh:mm"
+
 type ISheetsAPI interface {
 	LoadValues() []Expense
-	Write(values [][]interface{}) bool
-	LoadValuesByUsername(username string) []Expense
+	// Diagnose lists the cells LoadValues could not decode.
+	Diagnose() []RowError
+	Write(expenses []Expense) bool
+	// Append writes the expenses and returns the sheet rows they were written to.
+	Append(expenses []Expense) ([]int, error)
+	// Delete marks the row holding the expense as deleted, found by its id,
+	// user and date starting with expense.Row. The row is kept, so the rows
+	// below keep their numbers. It reports whether it was found.
+	Delete(expense Expense) (bool, error)
+	// Deactivate marks the expenses in the given sheet rows as settled.
+	Deactivate(rows []int) error
+	// AssignUserIds fills in the user id of rows written before ids were
+	// stored, ids are keyed by lowercase username. It returns the number of
+	// rows updated.
+	AssignUserIds(ids map[string]int64) (int, error)
+	// LoadValuesByUser returns the expenses of the user, see FilterByUser.
+	LoadValuesByUser(userId int64, username string) []Expense
 	LoadTotalByUsers(onlyActive bool) []AmountByUser
 }
 type SheetService struct {
-	client *sheets.Service
+	client        *sheets.Service
+	spreadsheetId string
+	worksheet     string
+	columns       []Column
+	location      *time.Location
+
+	// schema is read from the header row on first use and refreshed on every load
+	mu     sync.Mutex
+	schema *Schema
+	// headerFailed is set once adding missing columns to the header failed,
+	// it is not retried until the next start.
+	headerFailed bool
 }
 
+// AmountByUser is the total of a user in one currency. Name is the latest
+// username in the rows, UserId is zero for users only known by their
+// username.
 type AmountByUser struct {
-	Name  string
-	Total float64
+	Name   string
+	UserId int64
+	// Currency is the code of Total, empty for the ledger currency.
+	Currency string
+	Total    money.Decimal
+}
+
+// AmountByCategory is the total of a category in one currency, see
+// AmountByUser.
+type AmountByCategory struct {
+	Name     string
+	Currency string
+	Total    money.Decimal
 }
 
 type Expense struct {
-	Id       int64
-	Amount   float64
-	Reason   string
-	From     string
-	Date     string
-	Username string
-	Active   bool
+	Id int64
+	// Amount is in Currency, the ledger currency when empty.
+	Amount       money.Decimal
+	Reason       string
+	From         string
+	Date         time.Time
+	Username     string
+	Active       bool
+	Category     string
+	Currency     string
+	Participants []string
+	// Receipt is the Telegram file id of the receipt photo.
+	Receipt string
+	// UserId is the Telegram id of the author, zero in rows written before
+	// ids were stored.
+	UserId int64
+	// ChatId is the chat the expense was written in, zero in rows written
+	// before chats were stored.
+	ChatId int64
+	// Deleted rows hold undone expenses, they are never decoded.
+	Deleted bool
+	// Row is the spreadsheet row the expense was read from, zero for new ones.
+	Row int
 }
 
-func initService() *sheets.Service {
+// NewService connects to the spreadsheet with the service account from cfg.
+// Dates are stored as wall clock time in location.
+func NewService(cfg config.Sheets, location *time.Location) (ISheetsAPI, error) {
 	ctx := context.Background()
-	serviceAccount, err := os.ReadFile("./serviceAccount.json")
+	serviceAccount, err := os.ReadFile(cfg.ServiceAccountPath)
 
 	if err != nil {
-		log.Fatalf("Unable to read client secret file: %v", err)
+		return nil, fmt.Errorf("unable to read client secret file: %s", err)
 	}
 
 	// If modifying these scopes, delete your previously saved token.json.
 	// Создаем объект конфигурации из JSON-ключа
-	config, err := google.JWTConfigFromJSON(serviceAccount, "https://www.googleapis.com/auth/spreadsheets")
+	jwtConfig, err := google.JWTConfigFromJSON(serviceAccount, "https://www.googleapis.com/auth/spreadsheets")
 	if err != nil {
-		log.Fatalf("Failed to get json config %v", err)
+		return nil, fmt.Errorf("failed to get json config: %s", err)
 	}
 
 	// Создаем клиент API для доступа к Google Sheets API
-	client := config.Client(ctx)
-	sheetsService, err := sheets.NewService(ctx, option.WithHTTPClient(client))
-
+	service, err := NewServiceWithOptions(cfg, location, option.WithHTTPClient(jwtConfig.Client(ctx)))
 	if err != nil {
-		log.Fatalf("Unable to retrieve Sheets client: %v", err)
+		return nil, err
 	}
 	log.Println("Google API Successfully initialize!")
 
-	return sheetsService
+	if err := service.Migrate(); err != nil {
+		log.Printf("Unable to migrate sheet, retrying on next start: %v", err)
+	}
+
+	return service, nil
 }
 
-func NewService() ISheetsAPI {
+// NewServiceWithOptions creates the ledger with custom client options, e.g.
+// option.WithEndpoint to talk to a local Sheets API emulator.
+func NewServiceWithOptions(cfg config.Sheets, location *time.Location, opts ...option.ClientOption) (*SheetService, error) {
+	columns, err := EnabledColumns(cfg.ExtraColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := sheets.NewService(context.Background(), opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to retrieve Sheets client: %s", err)
+	}
+
 	return &SheetService{
-		client: initService(),
+		client:        client,
+		spreadsheetId: cfg.SpreadsheetId,
+		worksheet:     cfg.Worksheet,
+		columns:       columns,
+		location:      location,
+	}, nil
+}
+
+// Migrate reads the header row and adds the names of the enabled columns
+// that are missing from it. Dates written as unix timestamps are converted
+// to date values and the date column gets a date format.
+func (s *SheetService) Migrate() error {
+	schema, err := s.readHeader()
+	if err != nil {
+		return err
+	}
+
+	column := columnLetter(schema.position("date"))
+	if err := s.migrateDates(column); err != nil {
+		return err
+	}
+	return s.formatDates(schema.position("date"))
+}
+
+// migrateDates rewrites unix timestamps in the date column as date serial numbers.
+func (s *SheetService) migrateDates(column string) error {
+	readRange := s.sheetRange(fmt.Sprintf("%s2:%s", column, column))
+	resp, err := s.client.Spreadsheets.Values.Get(s.spreadsheetId, readRange).ValueRenderOption("UNFORMATTED_VALUE").Do()
+	if err != nil {
+		return fmt.Errorf("failed to read dates: %w", err)
+	}
+
+	var data []*sheets.ValueRange
+	for i, row := range resp.Values {
+		if len(row) == 0 {
+			continue
+		}
+		if n, ok := row[0].(float64); ok && n > maxDateSerial {
+			data = append(data, &sheets.ValueRange{
+				Range:  s.sheetRange(fmt.Sprintf("%s%d", column, i+2)),
+				Values: [][]interface{}{{DateSerial(time.Unix(int64(n), 0), s.location)}},
+			})
+		}
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	rb := &sheets.BatchUpdateValuesRequest{ValueInputOption: "RAW", Data: data}
+	if _, err := s.client.Spreadsheets.Values.BatchUpdate(s.spreadsheetId, rb).Do(); err != nil {
+		return fmt.Errorf("failed to convert dates: %w", err)
+	}
+	log.Printf("Converted %d unix timestamps in the sheet to dates", len(data))
+	return nil
+}
+
+// formatDates shows the date column as date and time below the header.
+func (s *SheetService) formatDates(column int) error {
+	sheetId, err := s.sheetId()
+	if err != nil {
+		return err
+	}
+
+	rb := &sheets.BatchUpdateSpreadsheetRequest{
+		Requests: []*sheets.Request{{
+			RepeatCell: &sheets.RepeatCellRequest{
+				Range: &sheets.GridRange{
+					SheetId:          sheetId,
+					StartRowIndex:    1,
+					StartColumnIndex: int64(column),
+					EndColumnIndex:   int64(column) + 1,
+					ForceSendFields:  []string{"SheetId"},
+				},
+				Cell: &sheets.CellData{
+					UserEnteredFormat: &sheets.CellFormat{
+						NumberFormat: &sheets.NumberFormat{Type: "DATE_TIME", Pattern: DateFormat},
+					},
+				},
+				Fields: "userEnteredFormat.numberFormat",
+			},
+		}},
 	}
+	if _, err := s.client.Spreadsheets.BatchUpdate(s.spreadsheetId, rb).Do(); err != nil {
+		return fmt.Errorf("failed to format dates: %w", err)
+	}
+	return nil
+}
+
+// sheetId looks up the id of the worksheet, which requests changing the
+// sheet itself rather than its values refer to it by.
+func (s *SheetService) sheetId() (int64, error) {
+	spreadsheet, err := s.client.Spreadsheets.Get(s.spreadsheetId).Fields("sheets.properties(sheetId,title)").Do()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spreadsheet: %w", err)
+	}
+
+	for _, candidate := range spreadsheet.Sheets {
+		if candidate.Properties != nil && candidate.Properties.Title == s.worksheet {
+			return candidate.Properties.SheetId, nil
+		}
+	}
+	return 0, fmt.Errorf("worksheet %q not found", s.worksheet)
 }
 
-func (s *SheetService) Write(values [][]interface{}) bool {
-	spreadsheetId := os.Getenv("GOOGLE_SHEET_ID")
-	range2 := "1!A2:G"
+func (s *SheetService) readHeader() (Schema, error) {
+	resp, err := s.client.Spreadsheets.Values.Get(s.spreadsheetId, s.sheetRange("1:1")).Do()
+	if err != nil {
+		return Schema{}, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	var header []interface{}
+	if len(resp.Values) > 0 {
+		header = resp.Values[0]
+	}
+	return s.useHeader(header), nil
+}
+
+// useHeader maps the columns by header and caches the result. Missing
+// columns are added to the header, if that fails the sheet is still read
+// with the columns it has.
+func (s *SheetService) useHeader(header []interface{}) Schema {
+	schema, missing := HeaderSchema(header, s.columns, s.location)
+
+	s.mu.Lock()
+	failed := s.headerFailed
+	s.mu.Unlock()
+
+	if len(missing) > 0 && !failed {
+		if err := s.addHeaders(schema, missing); err != nil {
+			log.Printf("Unable to update sheet header, not retrying until restart: %v", err)
+			failed = true
+		}
+	}
+
+	s.mu.Lock()
+	s.schema = &schema
+	s.headerFailed = failed
+	s.mu.Unlock()
+	return schema
+}
+
+func (s *SheetService) addHeaders(schema Schema, missing []Column) error {
+	var names []string
+	data := make([]*sheets.ValueRange, 0, len(missing))
+	for _, column := range missing {
+		names = append(names, column.Name)
+		data = append(data, &sheets.ValueRange{
+			Range:  s.sheetRange(columnLetter(schema.position(column.Name)) + "1"),
+			Values: [][]interface{}{{column.Name}},
+		})
+	}
+
+	rb := &sheets.BatchUpdateValuesRequest{ValueInputOption: "RAW", Data: data}
+	if _, err := s.client.Spreadsheets.Values.BatchUpdate(s.spreadsheetId, rb).Do(); err != nil {
+		return fmt.Errorf("failed to add columns %s to header: %w", strings.Join(names, ", "), err)
+	}
+	log.Printf("Added columns to sheet header: %s", strings.Join(names, ", "))
+	return nil
+}
+
+func (s *SheetService) currentSchema() (Schema, error) {
+	s.mu.Lock()
+	schema := s.schema
+	s.mu.Unlock()
+
+	if schema != nil {
+		return *schema, nil
+	}
+	return s.readHeader()
+}
+
+func (s *SheetService) Write(expenses []Expense) bool {
+	if _, err := s.Append(expenses); err != nil {
+		log.Printf("Unable to write data to sheet: %v\n", err)
+		return false
+	}
+	return true
+}
+
+func (s *SheetService) Append(expenses []Expense) ([]int, error) {
+	schema, err := s.currentSchema()
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([][]interface{}, 0, len(expenses))
+	for _, expense := range expenses {
+		values = append(values, schema.Encode(expense))
+	}
+
 	// How the input data should be interpreted.
 	valueInputOption := "RAW"
 
@@ -81,81 +346,360 @@ func (s *SheetService) Write(values [][]interface{}) bool {
 	rb := &sheets.ValueRange{
 		Values: values,
 	}
-	_, err := s.client.Spreadsheets.Values.Append(spreadsheetId, range2, rb).ValueInputOption(valueInputOption).InsertDataOption(insertDataOption).Do()
+	appendRange := s.sheetRange("A1:" + columnLetter(schema.Width()-1))
+	resp, err := s.client.Spreadsheets.Values.Append(s.spreadsheetId, appendRange, rb).ValueInputOption(valueInputOption).InsertDataOption(insertDataOption).Do()
 
 	if err != nil {
-		log.Printf("Unable to write data to sheet: %v\n", err)
+		return nil, fmt.Errorf("failed to append rows: %w", err)
+	}
+	if resp.Updates == nil {
+		return nil, fmt.Errorf("failed to append rows: no updated range in response")
+	}
+
+	first, last, err := rangeRows(resp.Updates.UpdatedRange)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]int, 0, last-first+1)
+	for row := first; row <= last; row++ {
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// rangeRows returns the first and the last row of an A1 range such as
+// "'1'!A5:J6".
+func rangeRows(a1 string) (int, int, error) {
+	cells := a1[strings.LastIndex(a1, "!")+1:]
+	bounds := strings.SplitN(cells, ":", 2)
+
+	var rows []int
+	for _, bound := range bounds {
+		row, err := strconv.Atoi(strings.TrimLeft(bound, "ABCDEFGHIJKLMNOPQRSTUVWXYZ"))
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse range %q: %s", a1, err)
+		}
+		rows = append(rows, row)
+	}
+	if len(rows) == 1 {
+		rows = append(rows, rows[0])
+	}
+	return rows[0], rows[1], nil
+}
+
+// Same reports whether e and other are the same expense: ids are message
+// ids, which are only unique within a chat, so the author and the date have
+// to match too. Authors are compared by user id when both have one and by
+// username otherwise. A zero date of other matches any.
+func (e Expense) Same(other Expense) bool {
+	if e.Id != other.Id || (!other.Date.IsZero() && !e.Date.Equal(other.Date)) {
 		return false
 	}
-	return true
+	if e.UserId != 0 && other.UserId != 0 {
+		return e.UserId == other.UserId
+	}
+	return strings.EqualFold(e.Username, other.Username)
+}
+
+func (s *SheetService) Delete(expense Expense) (bool, error) {
+	expenses, _, err := s.load()
+	if err != nil {
+		return false, err
+	}
+	row := findRow(expenses, expense)
+	if row == 0 {
+		return false, nil
+	}
+
+	schema, err := s.currentSchema()
+	if err != nil {
+		return false, err
+	}
+	rb := &sheets.BatchUpdateValuesRequest{
+		ValueInputOption: "RAW",
+		Data: []*sheets.ValueRange{{
+			Range:  s.sheetRange(fmt.Sprintf("%s%d", columnLetter(schema.position("deleted")), row)),
+			Values: [][]interface{}{{true}},
+		}},
+	}
+	if _, err := s.client.Spreadsheets.Values.BatchUpdate(s.spreadsheetId, rb).Do(); err != nil {
+		return false, fmt.Errorf("failed to delete row %d: %w", row, err)
+	}
+	return true, nil
+}
+
+// findRow returns the row of the expense with the id, username and date of
+// expense, preferring expense.Row since rows may be moved by hand. It
+// returns zero when there is none.
+func findRow(expenses []Expense, expense Expense) int {
+	row := 0
+	for _, e := range expenses {
+		if !e.Same(expense) {
+			continue
+		}
+		if e.Row == expense.Row {
+			return e.Row
+		}
+		if row == 0 {
+			row = e.Row
+		}
+	}
+	return row
+}
+
+func (s *SheetService) Deactivate(rows []int) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	schema, err := s.currentSchema()
+	if err != nil {
+		return err
+	}
+
+	column := columnLetter(schema.position("active"))
+	data := make([]*sheets.ValueRange, 0, len(rows))
+	for _, row := range rows {
+		data = append(data, &sheets.ValueRange{
+			Range:  s.sheetRange(fmt.Sprintf("%s%d", column, row)),
+			Values: [][]interface{}{{false}},
+		})
+	}
+
+	rb := &sheets.BatchUpdateValuesRequest{ValueInputOption: "RAW", Data: data}
+	if _, err := s.client.Spreadsheets.Values.BatchUpdate(s.spreadsheetId, rb).Do(); err != nil {
+		return fmt.Errorf("failed to deactivate rows: %w", err)
+	}
+	return nil
 }
 
 func (s *SheetService) LoadValues() []Expense {
-	spreadsheetId := os.Getenv("GOOGLE_SHEET_ID")
-	readRange := "1!A2:G"
-	resp, err := s.client.Spreadsheets.Values.Get(spreadsheetId, readRange).Do()
+	expenses, errs, err := s.load()
 	if err != nil {
 		log.Printf("Unable to retrieve data from sheet: %v\n", err)
 	}
+	if len(errs) > 0 {
+		log.Printf("Skipped %d malformed cells in sheet, run /doctor for details\n", len(errs))
+	}
+	return expenses
+}
 
-	expenses := make([]Expense, len(resp.Values))
+func (s *SheetService) Diagnose() []RowError {
+	_, errs, err := s.load()
+	if err != nil {
+		log.Printf("Unable to retrieve data from sheet: %v\n", err)
+	}
+	return errs
+}
 
-	for i, row := range resp.Values {
-		id, _ := strconv.ParseInt(row[0].(string), 10, 64)
-		amount := fixAmount(row[1].(string))
-		isActive, _ := strconv.ParseBool(row[6].(string))
+func (s *SheetService) load() ([]Expense, []RowError, error) {
+	resp, err := s.client.Spreadsheets.Values.Get(s.spreadsheetId, s.sheetRange("")).ValueRenderOption("UNFORMATTED_VALUE").Do()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read sheet: %w", err)
+	}
 
-		expenses[i] = Expense{
-			Id:       id,
-			Amount:   amount,
-			Reason:   row[2].(string),
-			From:     row[3].(string),
-			Date:     row[4].(string),
-			Username: row[5].(string),
-			Active:   isActive,
-		}
+	if len(resp.Values) == 0 {
+		return nil, nil, nil
 	}
+	expenses, errs := s.useHeader(resp.Values[0]).Decode(resp.Values[1:], 2)
+	return expenses, errs, nil
+}
 
-	return expenses
+// sheetRange prefixes an A1 range with the quoted worksheet name, an empty
+// range means the whole worksheet.
+func (s *SheetService) sheetRange(a1 string) string {
+	name := "'" + strings.ReplaceAll(s.worksheet, "'", "''") + "'"
+	if a1 == "" {
+		return name
+	}
+	return name + "!" + a1
 }
 
-func (s *SheetService) LoadValuesByUsername(username string) []Expense {
-	expenses := s.LoadValues()
-	var expensesByUsername []Expense
+// columnLetter converts a zero based column index to its A1 name.
+func columnLetter(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
 
-	for _, expense := range expenses {
-		if expense.Username == username {
-			expensesByUsername = append(expensesByUsername, expense)
+func (s *SheetService) AssignUserIds(ids map[string]int64) (int, error) {
+	expenses, _, err := s.load()
+	if err != nil {
+		return 0, err
+	}
+	schema, err := s.currentSchema()
+	if err != nil {
+		return 0, err
+	}
+
+	column := columnLetter(schema.position("user_id"))
+	var data []*sheets.ValueRange
+	for _, e := range expenses {
+		if id := ids[strings.ToLower(e.Username)]; e.UserId == 0 && id != 0 {
+			data = append(data, &sheets.ValueRange{
+				Range:  s.sheetRange(fmt.Sprintf("%s%d", column, e.Row)),
+				Values: [][]interface{}{{id}},
+			})
 		}
 	}
+	if len(data) == 0 {
+		return 0, nil
+	}
 
-	return expensesByUsername
+	rb := &sheets.BatchUpdateValuesRequest{ValueInputOption: "RAW", Data: data}
+	if _, err := s.client.Spreadsheets.Values.BatchUpdate(s.spreadsheetId, rb).Do(); err != nil {
+		return 0, fmt.Errorf("failed to assign user ids: %w", err)
+	}
+	return len(data), nil
+}
+
+func (s *SheetService) LoadValuesByUser(userId int64, username string) []Expense {
+	return FilterByUser(s.LoadValues(), userId, username)
 }
 
 func (s *SheetService) LoadTotalByUsers(onlyActive bool) []AmountByUser {
-	expensesByUserName := map[string]float64{}
+	return TotalByUsers(s.LoadValues(), onlyActive)
+}
 
-	for _, row := range s.LoadValues() {
-		if !onlyActive || row.Active {
-			expensesByUserName[row.Username] += row.Amount
+// userIds maps the usernames of rows having a user id to the id, so rows
+// of the same user written before ids were stored are counted for them.
+func userIds(expenses []Expense) map[string]int64 {
+	ids := map[string]int64{}
+	for _, e := range expenses {
+		if e.UserId != 0 && e.Username != "" {
+			ids[strings.ToLower(e.Username)] = e.UserId
 		}
 	}
+	return ids
+}
+
+// userKey identifies the author of an expense: by id when it is known, by
+// lowercase username otherwise.
+type userKey struct {
+	id       int64
+	username string
+}
+
+func keyOf(e Expense, ids map[string]int64) userKey {
+	if e.UserId != 0 {
+		return userKey{id: e.UserId}
+	}
+	username := strings.ToLower(e.Username)
+	if id := ids[username]; id != 0 {
+		return userKey{id: id}
+	}
+	return userKey{username: username}
+}
+
+// FilterByUser keeps the expenses of the user with userId, or of the user
+// with username when userId is zero.
+func FilterByUser(expenses []Expense, userId int64, username string) []Expense {
+	ids := userIds(expenses)
+	want := userKey{id: userId}
+	if userId == 0 {
+		want = userKey{username: strings.ToLower(username)}
+	}
 
-	result := make([]AmountByUser, 0, len(expensesByUserName))
-	for name, amount := range expensesByUserName {
-		result = append(result, AmountByUser{Name: name, Total: amount})
+	var result []Expense
+	for _, expense := range expenses {
+		if keyOf(expense, ids) == want {
+			result = append(result, expense)
+		}
 	}
+	return result
+}
 
+// FilterByChat keeps the expenses written in the chat. Rows without a chat
+// are only kept when withUnknown is set, they may belong to any chat.
+func FilterByChat(expenses []Expense, chatId int64, withUnknown bool) []Expense {
+	var result []Expense
+	for _, expense := range expenses {
+		if expense.ChatId == chatId || (expense.ChatId == 0 && withUnknown) {
+			result = append(result, expense)
+		}
+	}
 	return result
 }
 
-func fixAmount(str string) float64 {
-	if str == "" {
-		return 0
+// TotalByCategories sums expenses per category and currency, the ledger
+// currency first and largest first within a currency. Expenses without a
+// category are summed under an empty name.
+func TotalByCategories(expenses []Expense) []AmountByCategory {
+	type key struct{ name, currency string }
+	totals := map[key]money.Decimal{}
+	for _, expense := range expenses {
+		k := key{expense.Category, CurrencyOf(expense)}
+		totals[k] = totals[k].Add(expense.Amount)
 	}
-	amount, err := strconv.ParseFloat(strings.Replace(str, ",", ".", -1), 64)
-	if err != nil {
-		log.Printf("Failed to parse amount: %v, original value: %s\n", err, str)
+
+	result := make([]AmountByCategory, 0, len(totals))
+	for k, amount := range totals {
+		result = append(result, AmountByCategory{Name: k.name, Currency: k.currency, Total: amount})
 	}
-	return amount
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Currency != result[j].Currency {
+			return result[i].Currency < result[j].Currency
+		}
+		if c := result[i].Total.Cmp(result[j].Total); c != 0 {
+			return c > 0
+		}
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// CurrencyOf returns the uppercase currency code of an expense, empty for
+// the ledger currency however it is written.
+func CurrencyOf(e Expense) string {
+	if code := (money.Amount{Currency: e.Currency}).Code(); code != money.Base {
+		return code
+	}
+	return ""
+}
+
+// FilterByPeriod keeps the expenses dated within p.
+func FilterByPeriod(expenses []Expense, p period.Period) []Expense {
+	var result []Expense
+	for _, expense := range expenses {
+		if p.Contains(expense.Date) {
+			result = append(result, expense)
+		}
+	}
+	return result
+}
+
+// TotalByUsers sums expenses per user and currency, see AmountByUser.
+func TotalByUsers(expenses []Expense, onlyActive bool) []AmountByUser {
+	type group struct {
+		user     userKey
+		currency string
+	}
+	ids := userIds(expenses)
+	totals := map[group]*AmountByUser{}
+	var keys []group
+
+	for _, row := range expenses {
+		if onlyActive && !row.Active {
+			continue
+		}
+		key := group{keyOf(row, ids), CurrencyOf(row)}
+		total, ok := totals[key]
+		if !ok {
+			total = &AmountByUser{UserId: key.user.id, Currency: key.currency}
+			totals[key] = total
+			keys = append(keys, key)
+		}
+		total.Total = total.Total.Add(row.Amount)
+		if row.Username != "" {
+			total.Name = row.Username
+		}
+	}
+
+	result := make([]AmountByUser, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, *totals[key])
+	}
+
+	return result
 }
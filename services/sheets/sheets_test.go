@@ -0,0 +1,470 @@
+package sheets_test
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/config"
+	"github.com/kn9ka/fundbot-go/services/money"
+	"github.com/kn9ka/fundbot-go/services/sheets"
+	"github.com/kn9ka/fundbot-go/testing/fakes"
+	"google.golang.org/api/option"
+)
+
+var header = []interface{}{"id", "amount", "reason", "from", "date", "username", "active"}
+
+var seed = [][]interface{}{
+	{101, 250.5, "taxi", "", 1696000000, "alice", true},
+	{102, 99, "coffee", "", 1696000100, "bob", true},
+	{103, 1000, "rent", "", 1696000200, "alice", false},
+}
+
+func at(unix int64) time.Time {
+	return time.Unix(unix, 0).UTC()
+}
+
+func newService(t *testing.T, server *fakes.Sheets, worksheet string, extra ...string) *sheets.SheetService {
+	t.Helper()
+
+	cfg := config.Sheets{SpreadsheetId: fakes.SpreadsheetId, Worksheet: worksheet, ExtraColumns: extra}
+	service, err := sheets.NewServiceWithOptions(cfg, time.UTC, option.WithEndpoint(server.ApiUrl), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewServiceWithOptions() error = %v", err)
+	}
+	return service
+}
+
+// ledgers returns every ISheetsAPI implementation seeded with rows, so the
+// same expectations hold for the real service and the in-memory fake.
+func ledgers(t *testing.T, rows [][]interface{}) map[string]sheets.ISheetsAPI {
+	t.Helper()
+
+	server := fakes.NewSheets()
+	t.Cleanup(server.Close)
+	server.SetRows("1", append([][]interface{}{header}, rows...))
+
+	return map[string]sheets.ISheetsAPI{
+		"emulator": newService(t, server, "1"),
+		"memory":   fakes.NewLedger(rows...),
+	}
+}
+
+func TestLoadValues(t *testing.T) {
+	for name, ledger := range ledgers(t, seed) {
+		t.Run(name, func(t *testing.T) {
+			got := ledger.LoadValues()
+			want := []sheets.Expense{
+				{Id: 101, Amount: money.MustParse("250.5"), Reason: "taxi", Date: at(1696000000), Username: "alice", Active: true, Row: 2},
+				{Id: 102, Amount: money.MustParse("99"), Reason: "coffee", Date: at(1696000100), Username: "bob", Active: true, Row: 3},
+				{Id: 103, Amount: money.MustParse("1000"), Reason: "rent", Date: at(1696000200), Username: "alice", Active: false, Row: 4},
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadValues() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestWriteAppendsRows(t *testing.T) {
+	for name, ledger := range ledgers(t, seed) {
+		t.Run(name, func(t *testing.T) {
+			ok := ledger.Write([]sheets.Expense{{Id: 104, Amount: money.MustParse("12.75"), Reason: "bread", Date: at(1696000300), Username: "bob", Active: true}})
+			if !ok {
+				t.Fatal("Write() = false")
+			}
+
+			expenses := ledger.LoadValues()
+			if len(expenses) != len(seed)+1 {
+				t.Fatalf("LoadValues() returned %d rows, want %d", len(expenses), len(seed)+1)
+			}
+			want := sheets.Expense{Id: 104, Amount: money.MustParse("12.75"), Reason: "bread", Date: at(1696000300), Username: "bob", Active: true, Row: 5}
+			if got := expenses[len(expenses)-1]; !reflect.DeepEqual(got, want) {
+				t.Errorf("appended expense = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestAppendAndDelete(t *testing.T) {
+	for name, ledger := range ledgers(t, seed) {
+		t.Run(name, func(t *testing.T) {
+			rows, err := ledger.Append([]sheets.Expense{
+				{Id: 104, Amount: money.MustParse("12.75"), Reason: "bread", Date: at(1696000300), Username: "bob", Active: true},
+				{Id: 105, Amount: money.MustParse("3"), Reason: "gum", Date: at(1696000400), Username: "bob", Active: true},
+			})
+			if err != nil || !reflect.DeepEqual(rows, []int{5, 6}) {
+				t.Fatalf("Append() = %v, %v, want rows 5 and 6", rows, err)
+			}
+
+			if deleted, err := ledger.Delete(sheets.Expense{Row: 3, Id: 102, Username: "bob", Date: at(1696000100)}); err != nil || !deleted {
+				t.Fatalf("Delete() = %v, %v", deleted, err)
+			}
+			// a row given by mistake, it is still found by id, username and date
+			if deleted, err := ledger.Delete(sheets.Expense{Row: 4, Id: 105, Username: "bob", Date: at(1696000400)}); err != nil || !deleted {
+				t.Fatalf("Delete() of another row = %v, %v", deleted, err)
+			}
+			if deleted, _ := ledger.Delete(sheets.Expense{Row: 2, Id: 101, Username: "alice", Date: at(1696000001)}); deleted {
+				t.Error("Delete() removed an expense of another date")
+			}
+			if deleted, err := ledger.Delete(sheets.Expense{Row: 3, Id: 102, Username: "bob", Date: at(1696000100)}); err != nil || deleted {
+				t.Errorf("second Delete() = %v, %v, want the expense gone", deleted, err)
+			}
+
+			// deleted rows are kept, the ones below keep their numbers
+			if err := ledger.Deactivate([]int{5}); err != nil {
+				t.Fatalf("Deactivate() error = %v", err)
+			}
+			var ids []int64
+			for _, e := range ledger.LoadValues() {
+				ids = append(ids, e.Id)
+				if e.Id == 104 && e.Active {
+					t.Errorf("expense 104 = %+v, want it settled", e)
+				}
+			}
+			if !reflect.DeepEqual(ids, []int64{101, 103, 104}) {
+				t.Errorf("ids = %v, want 101, 103, 104", ids)
+			}
+		})
+	}
+}
+
+func TestDeleteFailsWhenApiIsDown(t *testing.T) {
+	server := fakes.NewSheets()
+	defer server.Close()
+	server.SetRows("1", append([][]interface{}{header}, seed...))
+	service := newService(t, server, "1")
+	server.SetScenario(fakes.ServerError)
+
+	if deleted, err := service.Delete(sheets.Expense{Row: 2, Id: 101, Username: "alice", Date: at(1696000000)}); err == nil || deleted {
+		t.Errorf("Delete() = %v, %v, want the read error", deleted, err)
+	}
+}
+
+func TestAssignUserIdsFailsWhenApiIsDown(t *testing.T) {
+	server := fakes.NewSheets()
+	defer server.Close()
+	server.SetRows("1", append([][]interface{}{header}, seed...))
+	service := newService(t, server, "1")
+	service.LoadValues()
+	server.SetScenario(fakes.ServerError)
+
+	if updated, err := service.AssignUserIds(map[string]int64{"alice": 1001}); err == nil || updated != 0 {
+		t.Errorf("AssignUserIds() = %d, %v, want the read error", updated, err)
+	}
+}
+
+func TestDeactivate(t *testing.T) {
+	for name, ledger := range ledgers(t, seed) {
+		t.Run(name, func(t *testing.T) {
+			if err := ledger.Deactivate([]int{2, 3}); err != nil {
+				t.Fatalf("Deactivate() error = %v", err)
+			}
+			for _, e := range ledger.LoadValues() {
+				if e.Active {
+					t.Errorf("expense %d in row %d is still active", e.Id, e.Row)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadValuesByUser(t *testing.T) {
+	for name, ledger := range ledgers(t, seed) {
+		t.Run(name, func(t *testing.T) {
+			expenses := ledger.LoadValuesByUser(0, "Alice")
+			if len(expenses) != 2 || expenses[0].Id != 101 || expenses[1].Id != 103 {
+				t.Errorf("LoadValuesByUser(alice) = %+v", expenses)
+			}
+		})
+	}
+}
+
+func TestAssignUserIds(t *testing.T) {
+	for name, ledger := range ledgers(t, seed) {
+		t.Run(name, func(t *testing.T) {
+			updated, err := ledger.AssignUserIds(map[string]int64{"alice": 1001})
+			if err != nil || updated != 2 {
+				t.Fatalf("AssignUserIds() = %d, %v, want 2 rows", updated, err)
+			}
+			if updated, err := ledger.AssignUserIds(map[string]int64{"alice": 1001}); err != nil || updated != 0 {
+				t.Errorf("second AssignUserIds() = %d, %v, want nothing to update", updated, err)
+			}
+
+			// a renamed user keeps their rows
+			if _, err := ledger.Append([]sheets.Expense{{Id: 104, Amount: money.MustParse("50"), Date: at(1696000300), Username: "alicia", UserId: 1001, Active: true}}); err != nil {
+				t.Fatalf("Append() error = %v", err)
+			}
+			if expenses := ledger.LoadValuesByUser(1001, "alicia"); len(expenses) != 3 {
+				t.Errorf("LoadValuesByUser(1001) = %+v, want 3 expenses", expenses)
+			}
+			got := ledger.LoadTotalByUsers(true)
+			sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+			want := []sheets.AmountByUser{{Name: "alicia", UserId: 1001, Total: money.MustParse("300.5")}, {Name: "bob", Total: money.MustParse("99")}}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LoadTotalByUsers() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestLoadTotalByUsers(t *testing.T) {
+	tests := []struct {
+		onlyActive bool
+		want       []sheets.AmountByUser
+	}{
+		{onlyActive: true, want: []sheets.AmountByUser{{Name: "alice", Total: money.MustParse("250.5")}, {Name: "bob", Total: money.MustParse("99")}}},
+		{onlyActive: false, want: []sheets.AmountByUser{{Name: "alice", Total: money.MustParse("1250.5")}, {Name: "bob", Total: money.MustParse("99")}}},
+	}
+
+	for name, ledger := range ledgers(t, seed) {
+		for _, tt := range tests {
+			got := ledger.LoadTotalByUsers(tt.onlyActive)
+			sort.Slice(got, func(i, j int) bool { return got[i].Name < got[j].Name })
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("%s: LoadTotalByUsers(%v) = %+v, want %+v", name, tt.onlyActive, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestEmulatorStoresRawValues(t *testing.T) {
+	server := fakes.NewSheets()
+	defer server.Close()
+	server.SetRows("1", [][]interface{}{header})
+
+	service := newService(t, server, "1")
+
+	if !service.Write([]sheets.Expense{{Id: 7, Amount: money.MustParse("10.5"), Reason: "lunch", Date: at(1696000000), Username: "carol", Active: true}}) {
+		t.Fatal("Write() = false")
+	}
+
+	rows := server.Rows("1")
+	want := []interface{}{float64(7), 10.5, "lunch", "", sheets.DateSerial(at(1696000000), time.UTC), "carol", true, "", "", "", ""}
+	if len(rows) != 2 || !reflect.DeepEqual(rows[1], want) {
+		t.Errorf("sheet rows = %v, want header and %v", rows, want)
+	}
+}
+
+func TestWriteFailsWhenApiIsDown(t *testing.T) {
+	server := fakes.NewSheets()
+	defer server.Close()
+	server.SetScenario(fakes.ServerError)
+
+	service := newService(t, server, "1")
+
+	if service.Write([]sheets.Expense{{Id: 1, Amount: money.MustParse("1"), Username: "alice", Active: true}}) {
+		t.Error("Write() = true, want false")
+	}
+	if expenses := service.LoadValues(); len(expenses) != 0 {
+		t.Errorf("LoadValues() = %+v, want none", expenses)
+	}
+}
+
+func TestDecodeRows(t *testing.T) {
+	rows := [][]interface{}{
+		// trailing empty cells are trimmed by the API
+		{"5", "1 234,50", "groceries", "", "1696000000", "alice"},
+		// unformatted numbers and booleans
+		{6.0, 99.9, "coffee", "", 1696000100.0, "bob", true},
+		{},
+		{"x", "abc", "broken", "", "", "", "maybe"},
+		{8.5, 10.0, "", "", "", "carol", "FALSE"},
+		// date serial numbers and dates typed as text
+		{9.0, 5.0, "tea", "", 46280.5, "dave"},
+		{10.0, 6.0, "cake", "", "15.09.2026 14:30", "dave"},
+		{11.0, 7.0, "soda", "", "yesterday", "dave"},
+		// users without a username are known by their id only
+		{12.0, 8.0, "juice", "", 1696000200.0, "", true, "", 1001.0},
+		// amounts beyond a trillion are typos
+		{13.0, 1e12, "flat", "", 1696000300.0, "erin"},
+	}
+
+	expenses, errs := sheets.DecodeRows(rows, 2)
+
+	wantExpenses := []sheets.Expense{
+		{Id: 5, Amount: money.MustParse("1234.5"), Reason: "groceries", Date: at(1696000000), Username: "alice", Row: 2},
+		{Id: 6, Amount: money.MustParse("99.9"), Reason: "coffee", Date: at(1696000100), Username: "bob", Active: true, Row: 3},
+		{Id: 9, Amount: money.MustParse("5"), Reason: "tea", Date: time.Date(2026, 9, 15, 12, 0, 0, 0, time.UTC), Username: "dave", Row: 7},
+		{Id: 10, Amount: money.MustParse("6"), Reason: "cake", Date: time.Date(2026, 9, 15, 14, 30, 0, 0, time.UTC), Username: "dave", Row: 8},
+		{Id: 12, Amount: money.MustParse("8"), Reason: "juice", Date: at(1696000200), UserId: 1001, Active: true, Row: 10},
+	}
+	if !reflect.DeepEqual(expenses, wantExpenses) {
+		t.Errorf("DecodeRows() expenses = %+v, want %+v", expenses, wantExpenses)
+	}
+
+	wantErrs := []sheets.RowError{
+		{Row: 5, Column: "id", Kind: sheets.InvalidValue, Value: "x"},
+		{Row: 5, Column: "amount", Kind: sheets.InvalidValue, Value: "abc"},
+		{Row: 5, Column: "active", Kind: sheets.InvalidValue, Value: "maybe"},
+		{Row: 6, Column: "id", Kind: sheets.InvalidValue, Value: 8.5},
+		{Row: 9, Column: "date", Kind: sheets.InvalidValue, Value: "yesterday"},
+		{Row: 11, Column: "amount", Kind: sheets.InvalidValue, Value: 1e12},
+	}
+	if !reflect.DeepEqual(errs, wantErrs) {
+		t.Errorf("DecodeRows() errors = %+v, want %+v", errs, wantErrs)
+	}
+}
+
+func TestDiagnose(t *testing.T) {
+	rows := append([][]interface{}{}, seed...)
+	rows = append(rows, []interface{}{104, "n/a", "typo", "", 1696000300, "bob", true})
+
+	for name, ledger := range ledgers(t, rows) {
+		t.Run(name, func(t *testing.T) {
+			errs := ledger.Diagnose()
+			if len(errs) != 1 || errs[0].Row != 5 || errs[0].Column != "amount" {
+				t.Errorf("Diagnose() = %+v, want invalid amount in row 5", errs)
+			}
+			if got := len(ledger.LoadValues()); got != len(seed) {
+				t.Errorf("LoadValues() returned %d rows, want %d", got, len(seed))
+			}
+		})
+	}
+}
+
+func TestColumnsMappedByHeader(t *testing.T) {
+	server := fakes.NewSheets()
+	defer server.Close()
+	server.SetRows("Расходы", [][]interface{}{
+		{"Пользователь", "Сумма", "Active", "Причина", "Категория", "Дата", "ID"},
+		{"alice", 250.5, true, "taxi", "transport", 1696000000, 101},
+	})
+
+	service := newService(t, server, "Расходы")
+
+	want := []sheets.Expense{{Id: 101, Amount: money.MustParse("250.5"), Reason: "taxi", Date: at(1696000000), Username: "alice", Active: true, Category: "transport", Row: 2}}
+	if got := service.LoadValues(); !reflect.DeepEqual(got, want) {
+		t.Errorf("LoadValues() = %+v, want %+v", got, want)
+	}
+
+	if !service.Write([]sheets.Expense{{Id: 102, Amount: money.MustParse("99"), Reason: "coffee", Date: at(1696000100), Username: "bob", Active: true, Category: "food"}}) {
+		t.Fatal("Write() = false")
+	}
+
+	rows := server.Rows("Расходы")
+	// the missing columns are added after the existing ones
+	wantHeader := []interface{}{"Пользователь", "Сумма", "Active", "Причина", "Категория", "Дата", "ID", "from", "user_id", "chat_id", "deleted"}
+	wantRow := []interface{}{"bob", float64(99), true, "coffee", "food", sheets.DateSerial(at(1696000100), time.UTC), float64(102), "", "", "", ""}
+	if len(rows) != 3 || !reflect.DeepEqual(rows[0], wantHeader) || !reflect.DeepEqual(rows[2], wantRow) {
+		t.Errorf("sheet rows = %v, want header %v and row %v", rows, wantHeader, wantRow)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []interface{}
+		want   []interface{}
+	}{
+		{
+			name: "empty sheet",
+			want: []interface{}{"id", "amount", "reason", "from", "date", "username", "active", "category", "user_id", "chat_id", "deleted", "currency", "participants"},
+		},
+		{
+			name:   "known header",
+			header: header,
+			want:   []interface{}{"id", "amount", "reason", "from", "date", "username", "active", "category", "user_id", "chat_id", "deleted", "currency", "participants"},
+		},
+		{
+			name:   "legacy header",
+			header: []interface{}{"Сообщение", "Сколько", "За что"},
+			want:   []interface{}{"Сообщение", "Сколько", "За что", nil, nil, nil, nil, "category", "user_id", "chat_id", "deleted", "currency", "participants"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakes.NewSheets()
+			defer server.Close()
+			if tt.header != nil {
+				server.SetRows("1", [][]interface{}{tt.header, {1, 10, "tea", "", 1696000000, "alice", true}})
+			}
+
+			service := newService(t, server, "1", "currency", "participants")
+			if err := service.Migrate(); err != nil {
+				t.Fatalf("Migrate() error = %v", err)
+			}
+			if rows := server.Rows("1"); len(rows) == 0 || !reflect.DeepEqual(rows[0], tt.want) {
+				t.Fatalf("header = %v, want %v", rows, tt.want)
+			}
+
+			expense := sheets.Expense{Id: 2, Amount: money.MustParse("5"), Date: at(1696000100), Username: "bob", Active: true, Category: "Кафе", Currency: "USD", Participants: []string{"alice", "bob"}}
+			if !service.Write([]sheets.Expense{expense}) {
+				t.Fatal("Write() = false")
+			}
+			expenses := service.LoadValues()
+			expense.Row = len(server.Rows("1"))
+			if got := expenses[len(expenses)-1]; !reflect.DeepEqual(got, expense) {
+				t.Errorf("written expense = %+v, want %+v", got, expense)
+			}
+		})
+	}
+}
+
+func TestReadOnlySheetIsReadWithItsColumns(t *testing.T) {
+	server := fakes.NewSheets()
+	defer server.Close()
+	server.SetRows("1", append([][]interface{}{header}, seed...))
+	server.SetReadOnly(true)
+
+	service := newService(t, server, "1", "currency")
+	for i := 0; i < 3; i++ {
+		if expenses := service.LoadValues(); len(expenses) != len(seed) {
+			t.Fatalf("LoadValues() = %+v, want the seeded expenses", expenses)
+		}
+	}
+
+	writes := 0
+	for _, req := range server.Requests() {
+		if req.Method != "GET" {
+			writes++
+		}
+	}
+	if writes != 1 {
+		t.Errorf("header writes = %d, want a single attempt", writes)
+	}
+}
+
+func TestMigrateDates(t *testing.T) {
+	server := fakes.NewSheets()
+	defer server.Close()
+	server.SetRows("1", append([][]interface{}{header}, seed...))
+
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("LoadLocation() error = %v", err)
+	}
+	cfg := config.Sheets{SpreadsheetId: fakes.SpreadsheetId, Worksheet: "1"}
+	service, err := sheets.NewServiceWithOptions(cfg, moscow, option.WithEndpoint(server.ApiUrl), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatalf("NewServiceWithOptions() error = %v", err)
+	}
+
+	if err := service.Migrate(); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+
+	// 1696000000 is 2023-09-29 15:06:40 UTC, 18:06:40 in Moscow
+	rows := server.Rows("1")
+	want := sheets.DateSerial(time.Date(2023, 9, 29, 18, 6, 40, 0, time.UTC), time.UTC)
+	if got := rows[1][4]; got != want {
+		t.Errorf("migrated date = %v, want %v", got, want)
+	}
+	if got := server.NumberFormat("1", 4); got != sheets.DateFormat {
+		t.Errorf("date column format = %q, want %q", got, sheets.DateFormat)
+	}
+
+	expenses := service.LoadValues()
+	if len(expenses) != len(seed) || !expenses[0].Date.Equal(at(1696000000)) || expenses[0].Date.Location() != moscow {
+		t.Errorf("LoadValues() = %+v, want dates of the seed in Moscow time", expenses)
+	}
+}
+
+func TestUnknownExtraColumn(t *testing.T) {
+	_, err := sheets.NewServiceWithOptions(config.Sheets{ExtraColumns: []string{"tags"}}, time.UTC, option.WithoutAuthentication())
+	if err == nil {
+		t.Error("NewServiceWithOptions() error = nil, want unknown column error")
+	}
+}
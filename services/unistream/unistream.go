@@ -3,7 +3,10 @@ package unistream
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/services/money"
 	"io"
 	"log"
 	"net/http"
@@ -23,34 +26,46 @@ const (
 type ResponseBody struct {
 	Message string `json:"message"`
 	Fees    []struct {
-		Name                     string  `json:"name"`
-		AcceptedAmount           float64 `json:"acceptedAmount"`
-		AcceptedCurrency         string  `json:"acceptedCurrency"`
-		WithdrawAmount           float64 `json:"withdrawAmount"`
-		WithdrawCurrency         string  `json:"withdrawCurrency"`
-		Rate                     float64 `json:"rate"`
-		AcceptedTotalFee         float64 `json:"acceptedTotalFee"`
-		AcceptedTotalFeeCurrency string  `json:"acceptedTotalFeeCurrency"`
+		Name                     string        `json:"name"`
+		AcceptedAmount           money.Decimal `json:"acceptedAmount"`
+		AcceptedCurrency         string        `json:"acceptedCurrency"`
+		WithdrawAmount           money.Decimal `json:"withdrawAmount"`
+		WithdrawCurrency         string        `json:"withdrawCurrency"`
+		Rate                     float64       `json:"rate"`
+		AcceptedTotalFee         float64       `json:"acceptedTotalFee"`
+		AcceptedTotalFeeCurrency string        `json:"acceptedTotalFeeCurrency"`
 	} `json:"fees"`
 }
 
-func GetRates() map[string]string {
-	result := map[string]string{}
+type Service struct {
+	client *httpclient.Client
+	apiUrl string
+}
 
-	if rubUsd, err := getRate(RUB, USD); err == nil {
-		result["USD"] = rubUsd
-	}
-	if rubGel, err := getRate(RUB, GEL); err == nil {
-		result["GEL"] = rubGel
-	}
-	if rubEur, err := getRate(RUB, EUR); err == nil {
-		result["EUR"] = rubEur
+// NewService creates a provider calling apiUrl, which is ApiUrl in production.
+func NewService(client *httpclient.Client, apiUrl string) *Service {
+	return &Service{client: client, apiUrl: apiUrl}
+}
+
+// GetRates returns the rates it managed to fetch along with the errors of the failed ones.
+func (s *Service) GetRates() (map[string]money.Rate, error) {
+	result := map[string]money.Rate{}
+	var errs []error
+
+	for _, currency := range []string{USD, GEL, EUR} {
+		rate, err := s.getRate(RUB, currency)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		result[currency] = rate
 	}
 
-	return result
+	return result, errors.Join(errs...)
 }
 
-func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
+// getRate returns the price of outCurrencyCode paid in inCurrencyCode.
+func (s *Service) getRate(inCurrencyCode string, outCurrencyCode string) (money.Rate, error) {
 	form := url.Values{}
 	form.Add("senderBankId", "361934")
 	form.Add("acceptedCurrency", inCurrencyCode)
@@ -58,22 +73,23 @@ func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
 	form.Add("amount", "1000")
 	form.Add("countryCode", "GEO")
 
-	req, err := http.NewRequest("POST", ApiUrl, bytes.NewBufferString(form.Encode()))
+	req, err := http.NewRequest("POST", s.apiUrl, bytes.NewBufferString(form.Encode()))
 
 	if err != nil {
 		log.Printf("failed to create request: %v", err)
-		return "", fmt.Errorf("failed to create request: %s", err)
+		return money.Rate{}, fmt.Errorf("failed to create request: %s", err)
 	}
 
 	req.Header.Set("Accept", "*/*")
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+	// calculating fees changes nothing, it is safe to send again
+	httpclient.MarkIdempotent(req)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	resp, err := s.client.Do(req)
 
 	if err != nil {
 		log.Printf("failed to send request: %v", err)
-		return "", fmt.Errorf("failed to send request: %s", err)
+		return money.Rate{}, fmt.Errorf("failed to send request: %w", err)
 	}
 
 	defer func(Body io.ReadCloser) {
@@ -85,19 +101,24 @@ func getRate(inCurrencyCode string, outCurrencyCode string) (string, error) {
 
 	if resp.StatusCode != http.StatusOK {
 		log.Printf("failed to fetch exchange rate: %v", resp.Status)
-		return "", fmt.Errorf("failed to fetch exchange rate: %s", resp.Status)
+		return money.Rate{}, fmt.Errorf("failed to fetch exchange rate: %s", resp.Status)
 	}
 
 	var jsonResp ResponseBody
 
 	if err := json.NewDecoder(resp.Body).Decode(&jsonResp); err != nil {
 		log.Printf("failed to decode response: %v", err)
-		return "", err
+		return money.Rate{}, err
+	}
+
+	if len(jsonResp.Fees) == 0 || jsonResp.Fees[0].WithdrawAmount.IsZero() {
+		log.Printf("no fees in response: %s", jsonResp.Message)
+		return money.Rate{}, fmt.Errorf("no fees for %s => %s: %s", inCurrencyCode, outCurrencyCode, jsonResp.Message)
 	}
 
-	rate := fmt.Sprintf(
-		"%.5f",
-		jsonResp.Fees[0].AcceptedAmount/jsonResp.Fees[0].WithdrawAmount,
-	)
-	return rate, nil
+	value, err := jsonResp.Fees[0].AcceptedAmount.Div(jsonResp.Fees[0].WithdrawAmount)
+	if err != nil {
+		return money.Rate{}, fmt.Errorf("failed to compute rate for %s => %s: %s", inCurrencyCode, outCurrencyCode, err)
+	}
+	return money.Rate{From: outCurrencyCode, To: inCurrencyCode, Value: value}, nil
 }
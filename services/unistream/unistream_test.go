@@ -0,0 +1,70 @@
+package unistream_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+	"github.com/kn9ka/fundbot-go/services/unistream"
+	"github.com/kn9ka/fundbot-go/testing/fakes"
+)
+
+func TestGetRatesRecorded(t *testing.T) {
+	server := fakes.NewUnistream()
+	defer server.Close()
+
+	rates, err := unistream.NewService(fakes.NewHttpClient(), server.ApiUrl).GetRates()
+	if err != nil {
+		t.Fatalf("GetRates() error = %v", err)
+	}
+
+	want := map[string]string{"USD": "91.95", "GEL": "35.54", "EUR": "100.48"}
+	for currency, rate := range want {
+		if got := rates[currency]; got.Value.String() != rate || got.From != currency || got.To != "RUB" {
+			t.Errorf("rates[%s] = %s, want %s in RUB", currency, got, rate)
+		}
+	}
+
+	for _, req := range server.Requests() {
+		if got := req.Form.Get("acceptedCurrency"); got != unistream.RUB {
+			t.Errorf("acceptedCurrency = %q, want %q", got, unistream.RUB)
+		}
+		if got := req.Header.Get("Content-Type"); got != "application/x-www-form-urlencoded; charset=UTF-8" {
+			t.Errorf("Content-Type = %q", got)
+		}
+	}
+}
+
+func TestGetRatesFailures(t *testing.T) {
+	tests := []struct {
+		name       string
+		scenario   fakes.Scenario
+		statusCode int
+	}{
+		{name: "empty fees", scenario: fakes.Empty},
+		{name: "malformed body", scenario: fakes.Malformed},
+		{name: "server error", scenario: fakes.ServerError, statusCode: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := fakes.NewUnistream()
+			defer server.Close()
+			server.SetScenario(tt.scenario)
+
+			rates, err := unistream.NewService(fakes.NewHttpClient(), server.ApiUrl).GetRates()
+			if err == nil {
+				t.Fatalf("GetRates() error = nil, rates = %v", rates)
+			}
+			if len(rates) != 0 {
+				t.Errorf("GetRates() rates = %v, want none", rates)
+			}
+
+			var statusErr *httpclient.StatusError
+			if tt.statusCode != 0 && (!errors.As(err, &statusErr) || statusErr.StatusCode != tt.statusCode) {
+				t.Errorf("GetRates() error = %v, want status %d", err, tt.statusCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package users
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/store"
+)
+
+// User is a Telegram user seen by the bot. The id never changes, the
+// username and name are the latest ones.
+type User struct {
+	Id       int64  `json:"id"`
+	Username string `json:"username,omitempty"`
+	Name     string `json:"name,omitempty"`
+	// Lang is the language picked with /lang, empty to follow the client.
+	Lang   string    `json:"lang,omitempty"`
+	SeenAt time.Time `json:"seenAt"`
+}
+
+// Label is how the user is shown in messages: the @username, the name for
+// users without one, or the id.
+func (u User) Label() string {
+	if u.Username != "" {
+		return "@" + u.Username
+	}
+	if u.Name != "" {
+		return u.Name
+	}
+	return "id" + strconv.FormatInt(u.Id, 10)
+}
+
+type state struct {
+	Users []User `json:"users"`
+	// FirstSeen maps lowercase usernames to the id of the first user seen
+	// with them.
+	FirstSeen map[string]int64 `json:"firstSeen,omitempty"`
+}
+
+// Registry keeps the users on disk by their Telegram id.
+type Registry struct {
+	mu    sync.Mutex
+	file  *store.File
+	state state
+}
+
+func New(path string) (*Registry, error) {
+	r := &Registry{file: store.NewFile(path)}
+	if err := r.file.Load(&r.state); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Observe records the current username and name of a user. It reports
+// whether the user is new, and saves only when something changed, so it can
+// be called on every update.
+func (r *Registry) Observe(id int64, username, firstName, lastName string) (bool, error) {
+	name := strings.TrimSpace(firstName + " " + lastName)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(id)
+	if i >= 0 && r.state.Users[i].Username == username && r.state.Users[i].Name == name {
+		return false, nil
+	}
+
+	user := User{Id: id, Username: username, Name: name, SeenAt: time.Now().UTC()}
+	previous, previousSeen := r.state.Users, r.state.FirstSeen
+	if key := strings.ToLower(username); key != "" {
+		if _, ok := previousSeen[key]; !ok {
+			r.state.FirstSeen = map[string]int64{key: id}
+			for k, v := range previousSeen {
+				r.state.FirstSeen[k] = v
+			}
+		}
+	}
+	if i >= 0 {
+		user.Lang = previous[i].Lang
+		r.state.Users = append([]User(nil), previous...)
+		r.state.Users[i] = user
+	} else {
+		r.state.Users = append(append([]User(nil), previous...), user)
+		sort.Slice(r.state.Users, func(a, b int) bool { return r.state.Users[a].Id < r.state.Users[b].Id })
+	}
+
+	if err := r.file.Save(r.state); err != nil {
+		r.state.Users, r.state.FirstSeen = previous, previousSeen
+		return false, err
+	}
+	return i < 0, nil
+}
+
+// SetLang keeps the language of a known user, empty to follow the client.
+// It reports whether the user is known.
+func (r *Registry) SetLang(id int64, lang string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	i := r.find(id)
+	if i < 0 {
+		return false, nil
+	}
+	previous := r.state.Users
+	r.state.Users = append([]User(nil), previous...)
+	r.state.Users[i].Lang = lang
+	if err := r.file.Save(r.state); err != nil {
+		r.state.Users = previous
+		return false, err
+	}
+	return true, nil
+}
+
+func (r *Registry) Get(id int64) (User, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if i := r.find(id); i >= 0 {
+		return r.state.Users[i], true
+	}
+	return User{}, false
+}
+
+// ByUsername finds the user having username, case insensitive and with or
+// without the leading @. A username given up by one user may be taken by
+// another, the one seen last wins.
+func (r *Registry) ByUsername(username string) (User, bool) {
+	username = strings.TrimPrefix(strings.TrimSpace(username), "@")
+	if username == "" {
+		return User{}, false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var found User
+	ok := false
+	for _, user := range r.state.Users {
+		if strings.EqualFold(user.Username, username) && (!ok || user.SeenAt.After(found.SeenAt)) {
+			found, ok = user, true
+		}
+	}
+	return found, ok
+}
+
+// FirstSeen returns the ids of the first users seen with usernames, keyed
+// by lowercase username. Unlike ByUsername it never hands a username over to
+// whoever took it later.
+func (r *Registry) FirstSeen() map[string]int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	seen := make(map[string]int64, len(r.state.FirstSeen))
+	for username, id := range r.state.FirstSeen {
+		seen[username] = id
+	}
+	return seen
+}
+
+// Users returns every known user sorted by id.
+func (r *Registry) Users() []User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]User(nil), r.state.Users...)
+}
+
+// find returns the index of the user with id, r.mu must be held.
+func (r *Registry) find(id int64) int {
+	i := sort.Search(len(r.state.Users), func(i int) bool { return r.state.Users[i].Id >= id })
+	if i < len(r.state.Users) && r.state.Users[i].Id == id {
+		return i
+	}
+	return -1
+}
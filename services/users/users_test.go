@@ -0,0 +1,95 @@
+package users_test
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/users"
+)
+
+func TestRegistry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	r, err := users.New(path)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+
+	if added, err := r.Observe(2, "bob", "Bob", ""); !added || err != nil {
+		t.Errorf("Observe() = %v, %v, want a new user", added, err)
+	}
+	if added, err := r.Observe(1, "alice", "Alice", "Smith"); !added || err != nil {
+		t.Errorf("Observe() = %v, %v, want a new user", added, err)
+	}
+	if added, err := r.Observe(1, "alice", "Alice", "Smith"); added || err != nil {
+		t.Errorf("second Observe() = %v, %v, want a known user", added, err)
+	}
+
+	// renamed users keep their id
+	time.Sleep(time.Millisecond)
+	if added, err := r.Observe(1, "alicia", "Alice", "Smith"); added || err != nil {
+		t.Errorf("Observe() after rename = %v, %v, want a known user", added, err)
+	}
+	if user, ok := r.Get(1); !ok || user.Username != "alicia" || user.Name != "Alice Smith" {
+		t.Errorf("Get() = %+v, %v", user, ok)
+	}
+
+	if known, err := r.SetLang(1, "en"); !known || err != nil {
+		t.Errorf("SetLang() = %v, %v", known, err)
+	}
+	if known, _ := r.SetLang(42, "en"); known {
+		t.Errorf("SetLang() of an unknown user reported it known")
+	}
+	if _, err := r.Observe(1, "alicia", "Alice", ""); err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	if user, _ := r.Get(1); user.Lang != "en" {
+		t.Errorf("Lang = %q after a new name, want it kept", user.Lang)
+	}
+
+	// a username given up is taken by the user seen last
+	time.Sleep(time.Millisecond)
+	if _, err := r.Observe(3, "alice", "Another", ""); err != nil {
+		t.Fatalf("Observe() error = %v", err)
+	}
+	if user, ok := r.ByUsername("@ALICE"); !ok || user.Id != 3 {
+		t.Errorf("ByUsername() = %+v, %v, want user 3", user, ok)
+	}
+	if _, ok := r.ByUsername(""); ok {
+		t.Errorf("ByUsername() of an empty name found a user")
+	}
+
+	// but not the rows written under it before
+	want := map[string]int64{"alice": 1, "alicia": 1, "bob": 2}
+	if seen := r.FirstSeen(); !reflect.DeepEqual(seen, want) {
+		t.Errorf("FirstSeen() = %v, want %v", seen, want)
+	}
+
+	reloaded, err := users.New(path)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	got := reloaded.Users()
+	if len(got) != 3 || got[0].Id != 1 || got[1].Id != 2 || got[2].Id != 3 {
+		t.Errorf("Users() = %+v, want 3 users sorted by id", got)
+	}
+	if seen := reloaded.FirstSeen(); !reflect.DeepEqual(seen, want) {
+		t.Errorf("FirstSeen() after a reload = %v, want %v", seen, want)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	for _, tc := range []struct {
+		user users.User
+		want string
+	}{
+		{users.User{Id: 1, Username: "alice", Name: "Alice"}, "@alice"},
+		{users.User{Id: 2, Name: "Bob"}, "Bob"},
+		{users.User{Id: 3}, "id3"},
+	} {
+		if got := tc.user.Label(); got != tc.want {
+			t.Errorf("Label() of %+v = %q, want %q", tc.user, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package fakes
+
+import (
+	"strconv"
+	"strings"
+)
+
+// formatCell renders a stored cell the way the Sheets API returns it with
+// the default FORMATTED_VALUE render option.
+func formatCell(cell interface{}) interface{} {
+	switch v := cell.(type) {
+	case nil:
+		return ""
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	default:
+		return v
+	}
+}
+
+// parseCell interprets a cell sent with valueInputOption USER_ENTERED.
+func parseCell(cell interface{}) interface{} {
+	s, ok := cell.(string)
+	if !ok {
+		return cell
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		return n
+	}
+	switch strings.ToUpper(s) {
+	case "TRUE":
+		return true
+	case "FALSE":
+		return false
+	}
+	return s
+}
+
+func isEmptyCell(cell interface{}) bool {
+	return cell == nil || cell == ""
+}
+
+// trimRow drops trailing empty cells, the Sheets API never returns them.
+func trimRow(row []interface{}) []interface{} {
+	end := len(row)
+	for end > 0 && isEmptyCell(row[end-1]) {
+		end--
+	}
+	return row[:end]
+}
+
+// renderRows converts stored rows into an API response, formatted unless
+// render is UNFORMATTED_VALUE, without trailing empty cells and rows.
+func renderRows(rows [][]interface{}, render string) [][]interface{} {
+	result := make([][]interface{}, 0, len(rows))
+	for _, row := range rows {
+		rendered := make([]interface{}, 0, len(row))
+		for _, cell := range trimRow(row) {
+			if render == "UNFORMATTED_VALUE" {
+				rendered = append(rendered, cell)
+			} else {
+				rendered = append(rendered, formatCell(cell))
+			}
+		}
+		result = append(result, rendered)
+	}
+
+	for len(result) > 0 && len(result[len(result)-1]) == 0 {
+		result = result[:len(result)-1]
+	}
+	return result
+}
@@ -0,0 +1,19 @@
+package fakes
+
+import (
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/config"
+	"github.com/kn9ka/fundbot-go/services/httpclient"
+)
+
+// NewHttpClient returns a shared client suited for tests: it does not retry
+// and never opens its circuit breaker.
+func NewHttpClient() *httpclient.Client {
+	return httpclient.New(config.Http{
+		Timeout:          5 * time.Second,
+		MaxRetries:       0,
+		BreakerThreshold: 1000,
+		BreakerCooldown:  time.Minute,
+	})
+}
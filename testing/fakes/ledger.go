@@ -0,0 +1,183 @@
+package fakes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kn9ka/fundbot-go/services/sheets"
+)
+
+// Ledger is an in-memory sheets.ISheetsAPI. Rows are kept the way the Sheets
+// API returns them, unformatted and without trailing empty cells, and parsed
+// by the same code as sheets.SheetService. The columns follow the legacy
+// A:G layout with every optional column enabled after it, dates are in UTC.
+type Ledger struct {
+	mu     sync.Mutex
+	rows   [][]interface{}
+	down   bool
+	schema sheets.Schema
+}
+
+// NewLedger creates a ledger holding rows, which start at row 2.
+func NewLedger(rows ...[]interface{}) *Ledger {
+	l := &Ledger{schema: sheets.PositionalSchema(sheets.Columns, time.UTC)}
+	l.append(rows)
+	return l
+}
+
+// SetDown makes Write fail like it does when the Sheets API is unavailable.
+func (l *Ledger) SetDown(down bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.down = down
+}
+
+// Rows returns the stored rows as the Sheets API would return them.
+func (l *Ledger) Rows() [][]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	rows := make([][]interface{}, len(l.rows))
+	for i, row := range l.rows {
+		rows[i] = append([]interface{}(nil), row...)
+	}
+	return rows
+}
+
+func (l *Ledger) Write(expenses []sheets.Expense) bool {
+	_, err := l.Append(expenses)
+	return err == nil
+}
+
+func (l *Ledger) Append(expenses []sheets.Expense) ([]int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.down {
+		return nil, errors.New("ledger is down")
+	}
+
+	values := make([][]interface{}, 0, len(expenses))
+	rows := make([]int, 0, len(expenses))
+	for _, expense := range expenses {
+		values = append(values, l.schema.Encode(expense))
+		rows = append(rows, len(l.rows)+len(rows)+2)
+	}
+	l.append(values)
+	return rows, nil
+}
+
+func (l *Ledger) Delete(expense sheets.Expense) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.down {
+		return false, errors.New("ledger is down")
+	}
+
+	expenses, _ := l.schema.Decode(l.rows, 2)
+	row := 0
+	for _, e := range expenses {
+		if e.Same(expense) && (row == 0 || e.Row == expense.Row) {
+			row = e.Row
+		}
+	}
+	if row == 0 {
+		return false, nil
+	}
+	l.set(row, columnIndex("deleted"), true)
+	return true, nil
+}
+
+// append stores values as if they went through the API: numbers become
+// float64 like they do after a JSON round trip.
+func (l *Ledger) append(values [][]interface{}) {
+	var raw [][]interface{}
+	data, _ := json.Marshal(values)
+	_ = json.Unmarshal(data, &raw)
+
+	for _, row := range raw {
+		l.rows = append(l.rows, trimRow(row))
+	}
+}
+
+// activeColumn is the position of the active column in the legacy layout.
+const activeColumn = 6
+
+func (l *Ledger) Deactivate(rows []int) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.down {
+		return errors.New("ledger is down")
+	}
+	for _, row := range rows {
+		i := row - 2
+		if i < 0 || i >= len(l.rows) {
+			return fmt.Errorf("row %d is out of range", row)
+		}
+		l.set(row, activeColumn, false)
+	}
+	return nil
+}
+
+// set writes the cell of the sheet row, extending the row when it is trimmed.
+func (l *Ledger) set(row, column int, value interface{}) {
+	i := row - 2
+	for len(l.rows[i]) <= column {
+		l.rows[i] = append(l.rows[i], "")
+	}
+	l.rows[i][column] = value
+}
+
+func (l *Ledger) AssignUserIds(ids map[string]int64) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.down {
+		return 0, errors.New("ledger is down")
+	}
+	column := columnIndex("user_id")
+	expenses, _ := l.schema.Decode(l.rows, 2)
+	updated := 0
+	for _, e := range expenses {
+		if id := ids[strings.ToLower(e.Username)]; e.UserId == 0 && id != 0 {
+			// numbers come back from the API as float64
+			l.set(e.Row, column, float64(id))
+			updated++
+		}
+	}
+	return updated, nil
+}
+
+// columnIndex is the position of the named column in the ledger rows.
+func columnIndex(name string) int {
+	for i, column := range sheets.Columns {
+		if column.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func (l *Ledger) LoadValues() []sheets.Expense {
+	expenses, _ := l.schema.Decode(l.Rows(), 2)
+	return expenses
+}
+
+func (l *Ledger) Diagnose() []sheets.RowError {
+	_, errs := l.schema.Decode(l.Rows(), 2)
+	return errs
+}
+
+func (l *Ledger) LoadValuesByUser(userId int64, username string) []sheets.Expense {
+	return sheets.FilterByUser(l.LoadValues(), userId, username)
+}
+
+func (l *Ledger) LoadTotalByUsers(onlyActive bool) []sheets.AmountByUser {
+	return sheets.TotalByUsers(l.LoadValues(), onlyActive)
+}
@@ -0,0 +1,195 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+const (
+	UnistreamPath    = "/api/v1/transfer/calculate"
+	CoronaPath       = "/transfers/online/api/transfers/tariffs"
+	AlphaVantagePath = "/query"
+	ContactPath      = "/api/contact/v2"
+)
+
+// NewUnistream fakes the unistream transfer calculator.
+func NewUnistream() *Server {
+	return newServer(UnistreamPath, func(w http.ResponseWriter, req Request, scenario Scenario) {
+		if req.Method != http.MethodPost || req.Path != UnistreamPath {
+			http.NotFound(w, nil)
+			return
+		}
+		for _, field := range []string{"senderBankId", "acceptedCurrency", "withdrawCurrency", "amount", "countryCode"} {
+			if req.Form.Get(field) == "" {
+				badRequest(w, field+" is required")
+				return
+			}
+		}
+
+		if scenario == Empty {
+			writeRecorded(w, "unistream_empty.json")
+			return
+		}
+		writeRecorded(w, fmt.Sprintf("unistream_%s.json", req.Form.Get("withdrawCurrency")))
+	})
+}
+
+// NewCorona fakes the koronapay tariffs API.
+func NewCorona() *Server {
+	return newServer(CoronaPath, func(w http.ResponseWriter, req Request, scenario Scenario) {
+		if req.Method != http.MethodGet || req.Path != CoronaPath {
+			http.NotFound(w, nil)
+			return
+		}
+		for _, field := range []string{"sendingCurrencyId", "receivingCurrencyId", "receivingAmount", "sendingCountryId", "receivingCountryId"} {
+			if req.Query.Get(field) == "" {
+				badRequest(w, field+" is required")
+				return
+			}
+		}
+
+		if scenario == Empty {
+			writeJSON(w, http.StatusOK, "[]")
+			return
+		}
+		writeRecorded(w, fmt.Sprintf("corona_%s.json", req.Query.Get("receivingCurrencyId")))
+	})
+}
+
+// NewAlphaVantage fakes the alphaVantage query API. The Empty scenario
+// replays the rate limit note the API answers with status 200.
+func NewAlphaVantage() *Server {
+	return newServer(AlphaVantagePath, func(w http.ResponseWriter, req Request, scenario Scenario) {
+		if req.Method != http.MethodGet || req.Path != AlphaVantagePath {
+			http.NotFound(w, nil)
+			return
+		}
+		if req.Query.Get("function") != "CURRENCY_EXCHANGE_RATE" {
+			writeJSON(w, http.StatusOK, `{"Error Message": "This API function does not exist."}`)
+			return
+		}
+		if req.Query.Get("apikey") == "" {
+			writeJSON(w, http.StatusOK, `{"Error Message": "the parameter apikey is invalid or missing."}`)
+			return
+		}
+
+		if scenario == Empty {
+			writeRecorded(w, "alphavantage_empty.json")
+			return
+		}
+		writeRecorded(w, fmt.Sprintf("alphavantage_%s_%s.json", req.Query.Get("from_currency"), req.Query.Get("to_currency")))
+	})
+}
+
+// Contact fakes the contact transfer API including its token handling.
+type Contact struct {
+	*Server
+
+	mu            sync.Mutex
+	generation    int
+	tokenRequests int
+	forms         map[string]string
+}
+
+func NewContact() *Contact {
+	c := &Contact{forms: map[string]string{}}
+	c.Server = newServer(ContactPath, c.handle)
+	return c
+}
+
+// ExpireTokens invalidates every token issued so far, the next request
+// made with an old token is answered with 401.
+func (c *Contact) ExpireTokens() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+}
+
+// TokenRequests returns how many times a token was requested.
+func (c *Contact) TokenRequests() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokenRequests
+}
+
+// Forms returns how many transfer forms were created.
+func (c *Contact) Forms() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.forms)
+}
+
+func (c *Contact) token() string {
+	return fmt.Sprintf("eyJhbGciOiJIUzI1NiJ9.anonymous.%d", c.generation)
+}
+
+func (c *Contact) handle(w http.ResponseWriter, req Request, scenario Scenario) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	path := strings.TrimPrefix(req.Path, ContactPath)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+
+	if path == "/auth/token" && req.Method == http.MethodPost {
+		var body struct {
+			TokenType string `json:"tokenType"`
+			GrantType string `json:"grantType"`
+		}
+		if err := json.Unmarshal(req.Body, &body); err != nil || body.TokenType == "" || body.GrantType == "" {
+			badRequest(w, "tokenType and grantType are required")
+			return
+		}
+		c.tokenRequests++
+
+		http.SetCookie(w, &http.Cookie{Name: "tokenTailAccess2", Value: "access-tail", Path: "/", MaxAge: 900})
+		http.SetCookie(w, &http.Cookie{Name: "tokenTailRefresh2", Value: "refresh-tail", Path: "/", MaxAge: 86400})
+		writeJSON(w, http.StatusOK, fmt.Sprintf(`{"accessToken": %q, "refreshToken": "3f7c1a2e-refresh", "expiresIn": 900}`, c.token()))
+		return
+	}
+
+	if req.Header.Get("Authorization") != "SplitTokenV2 "+c.token() {
+		writeJSON(w, http.StatusUnauthorized, `{"message":"token expired"}`)
+		return
+	}
+
+	switch {
+	case path == "/trns/bank" && req.Method == http.MethodPost:
+		id := fmt.Sprintf("7b5d3c1e-0f5a-4a52-9b1e-%012d", len(c.forms)+1)
+		c.forms[id] = ""
+		writeJSON(w, http.StatusOK, fmt.Sprintf(`{"id": %q}`, id))
+
+	case len(parts) == 3 && parts[0] == "trns" && parts[2] == "fields" && req.Method == http.MethodPut:
+		if _, ok := c.forms[parts[1]]; !ok {
+			writeJSON(w, http.StatusNotFound, `{"message":"form not found"}`)
+			return
+		}
+		var body struct {
+			Amount   string `json:"trnAmount"`
+			Currency string `json:"trnCurrency"`
+		}
+		if err := json.Unmarshal(req.Body, &body); err != nil || body.Amount == "" || body.Currency == "" {
+			badRequest(w, "trnAmount and trnCurrency are required")
+			return
+		}
+		c.forms[parts[1]] = body.Currency
+		writeJSON(w, http.StatusOK, `{}`)
+
+	case len(parts) == 3 && parts[0] == "trns" && parts[2] == "fees" && req.Method == http.MethodPost:
+		currency, ok := c.forms[parts[1]]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, `{"message":"form not found"}`)
+			return
+		}
+		if scenario == Empty {
+			writeRecorded(w, "contact_fees_empty.json")
+			return
+		}
+		writeRecorded(w, fmt.Sprintf("contact_fees_%s.json", currency))
+
+	default:
+		http.NotFound(w, nil)
+	}
+}
@@ -0,0 +1,31 @@
+package fakes
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+
+	"github.com/makiuchi-d/gozxing"
+	"github.com/makiuchi-d/gozxing/qrcode"
+)
+
+// ReceiptPhoto renders text as a QR code on a larger grey background and
+// encodes it as JPEG, like a photo of a receipt.
+func ReceiptPhoto(text string) ([]byte, error) {
+	code, err := qrcode.NewQRCodeWriter().Encode(text, gozxing.BarcodeFormat_QR_CODE, 300, 300, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	photo := image.NewRGBA(image.Rect(0, 0, 640, 480))
+	draw.Draw(photo, photo.Bounds(), image.NewUniform(color.Gray{Y: 220}), image.Point{}, draw.Src)
+	draw.Draw(photo, image.Rect(170, 90, 470, 390), code, image.Point{}, draw.Src)
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, photo, &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
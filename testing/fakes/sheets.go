@@ -0,0 +1,479 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+const SpreadsheetId = "fake-spreadsheet"
+
+// Sheets emulates the spreadsheets.values get, append, update and batchUpdate
+// endpoints of the Sheets API for a single spreadsheet, as well as reading
+// sheet properties, repeatCell format and deleteDimension requests. Create the real client with
+// option.WithEndpoint(ApiUrl) and option.WithoutAuthentication().
+type Sheets struct {
+	*Server
+
+	mu     sync.Mutex
+	sheets map[string][][]interface{}
+	// titles holds sheet names in order of creation, the index is the sheet id
+	titles   []string
+	formats  map[string]map[int]string
+	readOnly bool
+}
+
+// NewSheets creates a spreadsheet with a single empty sheet named "1", SetRows
+// adds more sheets.
+func NewSheets() *Sheets {
+	s := &Sheets{sheets: map[string][][]interface{}{"1": nil}, titles: []string{"1"}, formats: map[string]map[int]string{}}
+	s.Server = newServer("/", s.handle)
+	return s
+}
+
+// SetRows replaces the content of sheet, rows start at row 1 and hold raw
+// values, as if written with valueInputOption RAW.
+func (s *Sheets) SetRows(sheet string, rows [][]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sheets[sheet]; !ok {
+		s.titles = append(s.titles, sheet)
+	}
+	s.sheets[sheet] = nil
+	for _, row := range rows {
+		s.sheets[sheet] = append(s.sheets[sheet], append([]interface{}(nil), row...))
+	}
+}
+
+// Rows returns the raw content of sheet starting at row 1.
+func (s *Sheets) Rows(sheet string) [][]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rows := make([][]interface{}, len(s.sheets[sheet]))
+	for i, row := range s.sheets[sheet] {
+		rows[i] = append([]interface{}(nil), row...)
+	}
+	return rows
+}
+
+// SetReadOnly makes every write fail with 403, as for a service account
+// that was only given read access.
+func (s *Sheets) SetReadOnly(readOnly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readOnly = readOnly
+}
+
+func (s *Sheets) isReadOnly() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readOnly
+}
+
+// NumberFormat returns the number format pattern applied to column col of
+// sheet, rows below the header are assumed to share it.
+func (s *Sheets) NumberFormat(sheet string, col int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.formats[sheet][col]
+}
+
+func (s *Sheets) handle(w http.ResponseWriter, req Request, scenario Scenario) {
+	spreadsheet := "/v4/spreadsheets/" + SpreadsheetId
+	prefix := spreadsheet + "/values/"
+	if !strings.HasPrefix(req.Path, "/v4/spreadsheets/") {
+		writeSheetsError(w, http.StatusNotFound, "NOT_FOUND", "Method not found.")
+		return
+	}
+	if req.Method != http.MethodGet && s.isReadOnly() {
+		writeSheetsError(w, http.StatusForbidden, "PERMISSION_DENIED", "The caller does not have permission")
+		return
+	}
+
+	switch {
+	case req.Path == spreadsheet && req.Method == http.MethodGet:
+		s.properties(w)
+		return
+	case req.Path == spreadsheet+":batchUpdate" && req.Method == http.MethodPost:
+		s.batchUpdateSpreadsheet(w, req)
+		return
+	case req.Path == strings.TrimSuffix(prefix, "/")+":batchUpdate" && req.Method == http.MethodPost:
+		s.batchUpdate(w, req)
+		return
+	case !strings.HasPrefix(req.Path, prefix):
+		writeSheetsError(w, http.StatusNotFound, "NOT_FOUND", "Requested entity was not found.")
+		return
+	}
+	target := strings.TrimPrefix(req.Path, prefix)
+	action := ""
+	if strings.HasSuffix(target, ":append") {
+		target, action = strings.TrimSuffix(target, ":append"), "append"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rng, err := s.parseRange(target)
+	if err != nil {
+		writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	switch {
+	case req.Method == http.MethodGet && action == "":
+		var values [][]interface{}
+		if scenario != Empty {
+			values = renderRows(s.read(rng), req.Query.Get("valueRenderOption"))
+		}
+		writeSheets(w, sheets.ValueRange{Range: rng.String(), MajorDimension: "ROWS", Values: values})
+
+	case req.Method == http.MethodPost && action == "append":
+		values, ok := s.decodeValues(w, req)
+		if !ok {
+			return
+		}
+		tableRange := rng
+		rng.startRow = len(trimRows(s.sheets[rng.sheet]))
+		if rng.startRow < tableRange.startRow {
+			rng.startRow = tableRange.startRow
+		}
+		updated := s.write(rng, values)
+		writeSheets(w, sheets.AppendValuesResponse{
+			SpreadsheetId: SpreadsheetId,
+			TableRange:    tableRange.String(),
+			Updates:       updated,
+		})
+
+	case req.Method == http.MethodPut && action == "":
+		values, ok := s.decodeValues(w, req)
+		if !ok {
+			return
+		}
+		writeSheets(w, s.write(rng, values))
+
+	default:
+		writeSheetsError(w, http.StatusNotFound, "NOT_FOUND", "Method not found.")
+	}
+}
+
+func (s *Sheets) properties(w http.ResponseWriter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	spreadsheet := sheets.Spreadsheet{SpreadsheetId: SpreadsheetId}
+	for id, title := range s.titles {
+		spreadsheet.Sheets = append(spreadsheet.Sheets, &sheets.Sheet{
+			Properties: &sheets.SheetProperties{SheetId: int64(id), Title: title, ForceSendFields: []string{"SheetId"}},
+		})
+	}
+	writeSheets(w, spreadsheet)
+}
+
+// batchUpdateSpreadsheet supports repeatCell requests setting a number format
+// and deleteDimension requests deleting rows.
+func (s *Sheets) batchUpdateSpreadsheet(w http.ResponseWriter, req Request) {
+	var body sheets.BatchUpdateSpreadsheetRequest
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	resp := sheets.BatchUpdateSpreadsheetResponse{SpreadsheetId: SpreadsheetId}
+	for _, request := range body.Requests {
+		if remove := request.DeleteDimension; remove != nil && remove.Range != nil {
+			if remove.Range.Dimension != "ROWS" || remove.Range.StartIndex >= remove.Range.EndIndex {
+				writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "only deleting rows is supported")
+				return
+			}
+			title, ok := s.title(w, remove.Range.SheetId)
+			if !ok {
+				return
+			}
+			rows := s.sheets[title]
+			start, end := int(remove.Range.StartIndex), int(remove.Range.EndIndex)
+			if end > len(rows) {
+				end = len(rows)
+			}
+			if start < end {
+				s.sheets[title] = append(rows[:start], rows[end:]...)
+			}
+			resp.Replies = append(resp.Replies, &sheets.Response{})
+			continue
+		}
+
+		repeat := request.RepeatCell
+		if repeat == nil || repeat.Range == nil || repeat.Cell == nil || repeat.Cell.UserEnteredFormat == nil ||
+			repeat.Cell.UserEnteredFormat.NumberFormat == nil {
+			writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "only repeatCell number formats and deleteDimension are supported")
+			return
+		}
+		title, ok := s.title(w, repeat.Range.SheetId)
+		if !ok {
+			return
+		}
+
+		if s.formats[title] == nil {
+			s.formats[title] = map[int]string{}
+		}
+		for col := repeat.Range.StartColumnIndex; col < repeat.Range.EndColumnIndex; col++ {
+			s.formats[title][int(col)] = repeat.Cell.UserEnteredFormat.NumberFormat.Pattern
+		}
+		resp.Replies = append(resp.Replies, &sheets.Response{})
+	}
+	writeSheets(w, resp)
+}
+
+// title finds the sheet by id, s.mu must be held.
+func (s *Sheets) title(w http.ResponseWriter, id int64) (string, bool) {
+	if id < 0 || int(id) >= len(s.titles) {
+		writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", fmt.Sprintf("No grid with id: %d", id))
+		return "", false
+	}
+	return s.titles[id], true
+}
+
+func (s *Sheets) batchUpdate(w http.ResponseWriter, req Request) {
+	var body sheets.BatchUpdateValuesRequest
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+	if body.ValueInputOption != "RAW" && body.ValueInputOption != "USER_ENTERED" {
+		writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "valueInputOption is required")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// validate every range first, the API applies all updates or none
+	ranges := make([]a1Range, len(body.Data))
+	for i, data := range body.Data {
+		rng, err := s.parseRange(data.Range)
+		if err != nil {
+			writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+			return
+		}
+		ranges[i] = rng
+	}
+
+	resp := sheets.BatchUpdateValuesResponse{SpreadsheetId: SpreadsheetId}
+	for i, data := range body.Data {
+		if body.ValueInputOption == "USER_ENTERED" {
+			for _, row := range data.Values {
+				for j, cell := range row {
+					row[j] = parseCell(cell)
+				}
+			}
+		}
+		updated := s.write(ranges[i], data.Values)
+		resp.Responses = append(resp.Responses, updated)
+		resp.TotalUpdatedCells += updated.UpdatedCells
+	}
+	writeSheets(w, resp)
+}
+
+func (s *Sheets) decodeValues(w http.ResponseWriter, req Request) ([][]interface{}, bool) {
+	option := req.Query.Get("valueInputOption")
+	if option != "RAW" && option != "USER_ENTERED" {
+		writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "valueInputOption is required")
+		return nil, false
+	}
+
+	var body sheets.ValueRange
+	if err := json.Unmarshal(req.Body, &body); err != nil {
+		writeSheetsError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return nil, false
+	}
+
+	if option == "USER_ENTERED" {
+		for _, row := range body.Values {
+			for i, cell := range row {
+				row[i] = parseCell(cell)
+			}
+		}
+	}
+	return body.Values, true
+}
+
+func (s *Sheets) read(rng a1Range) [][]interface{} {
+	var rows [][]interface{}
+	for i, row := range s.sheets[rng.sheet] {
+		if i < rng.startRow || (rng.endRow >= 0 && i > rng.endRow) {
+			continue
+		}
+		var cells []interface{}
+		for j, cell := range row {
+			if j >= rng.startCol && (rng.endCol < 0 || j <= rng.endCol) {
+				cells = append(cells, cell)
+			}
+		}
+		rows = append(rows, cells)
+	}
+	return rows
+}
+
+func (s *Sheets) write(rng a1Range, values [][]interface{}) *sheets.UpdateValuesResponse {
+	columns := 0
+	for i, row := range values {
+		r := rng.startRow + i
+		for len(s.sheets[rng.sheet]) <= r {
+			s.sheets[rng.sheet] = append(s.sheets[rng.sheet], nil)
+		}
+		for j, cell := range row {
+			c := rng.startCol + j
+			for len(s.sheets[rng.sheet][r]) <= c {
+				s.sheets[rng.sheet][r] = append(s.sheets[rng.sheet][r], nil)
+			}
+			s.sheets[rng.sheet][r][c] = cell
+		}
+		if len(row) > columns {
+			columns = len(row)
+		}
+	}
+
+	updated := a1Range{
+		sheet:    rng.sheet,
+		startRow: rng.startRow,
+		startCol: rng.startCol,
+		endRow:   rng.startRow + len(values) - 1,
+		endCol:   rng.startCol + columns - 1,
+	}
+	return &sheets.UpdateValuesResponse{
+		SpreadsheetId:  SpreadsheetId,
+		UpdatedRange:   updated.String(),
+		UpdatedRows:    int64(len(values)),
+		UpdatedColumns: int64(columns),
+		UpdatedCells:   int64(len(values) * columns),
+	}
+}
+
+// a1Range is a parsed A1 notation range with zero based bounds, a negative
+// end means the range is open in that direction.
+type a1Range struct {
+	sheet              string
+	startRow, startCol int
+	endRow, endCol     int
+}
+
+func (s *Sheets) parseRange(value string) (a1Range, error) {
+	rng := a1Range{endRow: -1, endCol: -1}
+
+	name, cells := value, ""
+	if i := strings.LastIndex(value, "!"); i >= 0 {
+		name, cells = value[:i], value[i+1:]
+	}
+	name = strings.ReplaceAll(strings.Trim(name, "'"), "''", "'")
+	if _, ok := s.sheets[name]; !ok {
+		return rng, fmt.Errorf("unable to parse range: %s", value)
+	}
+	rng.sheet = name
+
+	if cells == "" {
+		return rng, nil
+	}
+
+	bounds := strings.SplitN(cells, ":", 2)
+	var err error
+	if rng.startCol, rng.startRow, err = parseCellRef(bounds[0]); err != nil {
+		return rng, fmt.Errorf("unable to parse range: %s", value)
+	}
+	if rng.startCol < 0 {
+		rng.startCol = 0
+	}
+	if rng.startRow < 0 {
+		rng.startRow = 0
+	}
+	if len(bounds) == 1 {
+		rng.endCol, rng.endRow = rng.startCol, rng.startRow
+		return rng, nil
+	}
+	if rng.endCol, rng.endRow, err = parseCellRef(bounds[1]); err != nil {
+		return rng, fmt.Errorf("unable to parse range: %s", value)
+	}
+	return rng, nil
+}
+
+func (r a1Range) String() string {
+	end := ""
+	if r.endCol >= 0 {
+		end = columnName(r.endCol)
+	}
+	if r.endRow >= 0 {
+		end += strconv.Itoa(r.endRow + 1)
+	}
+	return fmt.Sprintf("'%s'!%s%d:%s", strings.ReplaceAll(r.sheet, "'", "''"), columnName(r.startCol), r.startRow+1, end)
+}
+
+// parseCellRef parses references like "B7", "G" or "12" into zero based
+// column and row, -1 marks the missing part.
+func parseCellRef(ref string) (col int, row int, err error) {
+	col, row = -1, -1
+
+	i := 0
+	for i < len(ref) && ref[i] >= 'A' && ref[i] <= 'Z' {
+		if col < 0 {
+			col = 0
+		}
+		col = col*26 + int(ref[i]-'A'+1)
+		i++
+	}
+	if col > 0 {
+		col--
+	}
+
+	if i < len(ref) {
+		n, err := strconv.Atoi(ref[i:])
+		if err != nil || n < 1 {
+			return 0, 0, fmt.Errorf("invalid cell reference %q", ref)
+		}
+		row = n - 1
+	}
+	if col < 0 && row < 0 {
+		return 0, 0, fmt.Errorf("invalid cell reference %q", ref)
+	}
+	return col, row, nil
+}
+
+func columnName(col int) string {
+	name := ""
+	for col >= 0 {
+		name = string(rune('A'+col%26)) + name
+		col = col/26 - 1
+	}
+	return name
+}
+
+func trimRows(rows [][]interface{}) [][]interface{} {
+	end := len(rows)
+	for end > 0 && len(trimRow(rows[end-1])) == 0 {
+		end--
+	}
+	return rows[:end]
+}
+
+func writeSheets(w http.ResponseWriter, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		writeSheetsError(w, http.StatusInternalServerError, "INTERNAL", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, string(data))
+}
+
+func writeSheetsError(w http.ResponseWriter, code int, status string, message string) {
+	data, _ := json.Marshal(map[string]interface{}{
+		"error": map[string]interface{}{"code": code, "message": message, "status": status},
+	})
+	writeJSON(w, code, string(data))
+}
@@ -0,0 +1,462 @@
+package fakes
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	TelegramToken = "123456:fake-token"
+	// maxPollWait caps long polling so tests don't wait for the bot's timeout.
+	maxPollWait = 200 * time.Millisecond
+	// pollGrace is how long a getUpdates call waits for a cancelled one to
+	// be noticed by the server before it is a conflict.
+	pollGrace = 50 * time.Millisecond
+)
+
+// Sent is a Bot API call made by the bot, except getMe and getUpdates.
+// Files holds uploaded files by form field, e.g. "photo". MessageId is the
+// id of the message sent or edited by the call.
+type Sent struct {
+	Method    string
+	Params    url.Values
+	Files     map[string][]byte
+	MessageId int
+}
+
+func (s Sent) ChatId() int64 {
+	id, _ := strconv.ParseInt(s.Params.Get("chat_id"), 10, 64)
+	return id
+}
+
+func (s Sent) Text() string {
+	return s.Params.Get("text")
+}
+
+// Buttons returns the callback data of the inline keyboard by button text.
+func (s Sent) Buttons() map[string]string {
+	var markup tgbotapi.InlineKeyboardMarkup
+	_ = json.Unmarshal([]byte(s.Params.Get("reply_markup")), &markup)
+
+	buttons := map[string]string{}
+	for _, row := range markup.InlineKeyboard {
+		for _, button := range row {
+			if button.CallbackData != nil {
+				buttons[button.Text] = *button.CallbackData
+			}
+		}
+	}
+	return buttons
+}
+
+// Keyboard returns the texts of the reply keyboard buttons in order.
+func (s Sent) Keyboard() []string {
+	var markup tgbotapi.ReplyKeyboardMarkup
+	_ = json.Unmarshal([]byte(s.Params.Get("reply_markup")), &markup)
+
+	var texts []string
+	for _, row := range markup.Keyboard {
+		for _, button := range row {
+			texts = append(texts, button.Text)
+		}
+	}
+	return texts
+}
+
+// Telegram is an in-process Bot API server. Scripted updates are handed out
+// through getUpdates and every other call is captured.
+type Telegram struct {
+	*httptest.Server
+	// Endpoint is the API endpoint format to create tgbotapi.BotAPI with.
+	Endpoint string
+	// FileEndpoint is the URL format documents sent with SendDocument are
+	// downloaded from.
+	FileEndpoint string
+	Bot          tgbotapi.User
+
+	mu            sync.Mutex
+	updates       []tgbotapi.Update
+	lastUpdateId  int
+	lastMessageId int
+	offset        int
+	polling       bool
+	sent          []Sent
+	notify        chan struct{}
+	// files are the documents sent to the bot by file id
+	files map[string]tgbotapi.Document
+	data  map[string][]byte
+}
+
+func NewTelegram() *Telegram {
+	t := &Telegram{
+		Bot:    tgbotapi.User{ID: 123456, IsBot: true, FirstName: "Funds", UserName: "funds_test_bot"},
+		notify: make(chan struct{}),
+		files:  map[string]tgbotapi.Document{},
+		data:   map[string][]byte{},
+	}
+	t.Server = httptest.NewServer(http.HandlerFunc(t.handle))
+	t.Endpoint = t.URL + "/bot%s/%s"
+	t.FileEndpoint = t.URL + "/file/bot%s/%s"
+	return t
+}
+
+// SendMessage queues an update with a private message from user, commands
+// get their bot_command entity like real clients send them.
+func (t *Telegram) SendMessage(chatId int64, from tgbotapi.User, text string) int {
+	message := &tgbotapi.Message{
+		From: &from,
+		Chat: &tgbotapi.Chat{ID: chatId, Type: "private"},
+		Date: int(time.Now().Unix()),
+		Text: text,
+	}
+	if strings.HasPrefix(text, "/") {
+		command := strings.SplitN(text, " ", 2)[0]
+		message.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: len(command)}}
+	}
+
+	return t.Push(tgbotapi.Update{Message: message})
+}
+
+// SendDocument queues an update with a file sent by user, the bot can
+// download it through getFile and FileEndpoint.
+func (t *Telegram) SendDocument(chatId int64, from tgbotapi.User, name string, data []byte) int {
+	t.mu.Lock()
+	id := fmt.Sprintf("file-%d", len(t.files)+1)
+	document := tgbotapi.Document{FileID: id, FileUniqueID: id, FileName: name, FileSize: len(data)}
+	t.files[id] = document
+	t.data["documents/"+id+"/"+name] = data
+	t.mu.Unlock()
+
+	return t.Push(tgbotapi.Update{Message: &tgbotapi.Message{
+		From:     &from,
+		Chat:     &tgbotapi.Chat{ID: chatId, Type: "private"},
+		Date:     int(time.Now().Unix()),
+		Document: &document,
+	}})
+}
+
+// SendPhoto queues an update with a photo sent by user, data is served as
+// its largest size, the bot can download it like a document.
+func (t *Telegram) SendPhoto(chatId int64, from tgbotapi.User, caption string, data []byte) int {
+	t.mu.Lock()
+	id := fmt.Sprintf("file-%d", len(t.files)+1)
+	t.files[id] = tgbotapi.Document{FileID: id, FileUniqueID: id, FileName: "photo.jpg", FileSize: len(data)}
+	t.data["documents/"+id+"/photo.jpg"] = data
+	t.mu.Unlock()
+
+	return t.Push(tgbotapi.Update{Message: &tgbotapi.Message{
+		From:    &from,
+		Chat:    &tgbotapi.Chat{ID: chatId, Type: "private"},
+		Date:    int(time.Now().Unix()),
+		Caption: caption,
+		Photo: []tgbotapi.PhotoSize{
+			{FileID: id + "-thumb", FileUniqueID: id + "-thumb", Width: 90, Height: 90},
+			{FileID: id, FileUniqueID: id, Width: 1280, Height: 1280, FileSize: len(data)},
+		},
+	}})
+}
+
+// PressButton queues a callback query of user pressing the button with data
+// under the message the bot sent as messageId, along with the message it
+// replied to.
+func (t *Telegram) PressButton(chatId int64, from tgbotapi.User, messageId int, data string) int {
+	t.mu.Lock()
+	message := &tgbotapi.Message{MessageID: messageId, From: &t.Bot, Chat: &tgbotapi.Chat{ID: chatId, Type: "private"}}
+	for _, sent := range t.sent {
+		if sent.MessageId == messageId {
+			message.Text = sent.Text()
+			// edits keep the message replied to
+			if reply := sent.Params.Get("reply_to_message_id"); reply != "" {
+				message.ReplyToMessage = t.message(reply)
+			}
+		}
+	}
+	t.mu.Unlock()
+
+	return t.Push(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      fmt.Sprintf("query-%d-%d", messageId, time.Now().UnixNano()),
+		From:    &from,
+		Message: message,
+		Data:    data,
+	}})
+}
+
+// message returns the message with the id sent by a user, t.mu must be held.
+func (t *Telegram) message(id string) *tgbotapi.Message {
+	for _, update := range t.updates {
+		if update.Message != nil && strconv.Itoa(update.Message.MessageID) == id {
+			return update.Message
+		}
+	}
+	return nil
+}
+
+// Push queues update, assigning its update id and, for messages, a message id.
+func (t *Telegram) Push(update tgbotapi.Update) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.lastUpdateId++
+	update.UpdateID = t.lastUpdateId
+	if update.Message != nil && update.Message.MessageID == 0 {
+		t.lastMessageId++
+		update.Message.MessageID = t.lastMessageId
+	}
+	t.updates = append(t.updates, update)
+	t.broadcast()
+
+	return update.UpdateID
+}
+
+// Sent returns the captured calls to method, or all of them if method is empty.
+func (t *Telegram) Sent(method string) []Sent {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var sent []Sent
+	for _, s := range t.sent {
+		if method == "" || s.Method == method {
+			sent = append(sent, s)
+		}
+	}
+	return sent
+}
+
+// WaitSent waits until at least n calls to method were captured.
+func (t *Telegram) WaitSent(method string, n int, timeout time.Duration) ([]Sent, error) {
+	deadline := time.After(timeout)
+	for {
+		t.mu.Lock()
+		notify := t.notify
+		t.mu.Unlock()
+
+		if sent := t.Sent(method); len(sent) >= n {
+			return sent, nil
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return t.Sent(method), fmt.Errorf("got %d %s calls, want %d", len(t.Sent(method)), method, n)
+		}
+	}
+}
+
+// Offset returns the offset of the last getUpdates call, updates below it
+// are considered acknowledged.
+func (t *Telegram) Offset() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.offset
+}
+
+// broadcast wakes everyone waiting for a change, t.mu must be held.
+func (t *Telegram) broadcast() {
+	close(t.notify)
+	t.notify = make(chan struct{})
+}
+
+func (t *Telegram) handle(w http.ResponseWriter, r *http.Request) {
+	if prefix := "/file/bot" + TelegramToken + "/"; strings.HasPrefix(r.URL.Path, prefix) {
+		t.mu.Lock()
+		data, ok := t.data[strings.TrimPrefix(r.URL.Path, prefix)]
+		t.mu.Unlock()
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) != 2 || parts[0] != "bot"+TelegramToken {
+		writeTelegram(w, nil, &tgbotapi.APIResponse{Ok: false, ErrorCode: 401, Description: "Unauthorized"})
+		return
+	}
+	if err := r.ParseMultipartForm(10 << 20); err != nil && err != http.ErrNotMultipart {
+		writeTelegram(w, nil, &tgbotapi.APIResponse{Ok: false, ErrorCode: 400, Description: err.Error()})
+		return
+	}
+	method := parts[1]
+
+	switch method {
+	case "getMe":
+		writeTelegram(w, t.Bot, nil)
+	case "getUpdates":
+		updates, ok := t.getUpdates(r)
+		if !ok {
+			writeTelegram(w, nil, &tgbotapi.APIResponse{Ok: false, ErrorCode: 409, Description: "Conflict: terminated by other getUpdates request"})
+			return
+		}
+		writeTelegram(w, updates, nil)
+	case "getFile":
+		t.mu.Lock()
+		document, ok := t.files[r.Form.Get("file_id")]
+		t.mu.Unlock()
+		if !ok {
+			writeTelegram(w, nil, &tgbotapi.APIResponse{Ok: false, ErrorCode: 400, Description: "Bad Request: invalid file_id"})
+			return
+		}
+		writeTelegram(w, tgbotapi.File{
+			FileID:       document.FileID,
+			FileUniqueID: document.FileUniqueID,
+			FileSize:     document.FileSize,
+			FilePath:     "documents/" + document.FileID + "/" + document.FileName,
+		}, nil)
+	default:
+		files, err := readFiles(r)
+		if err != nil {
+			writeTelegram(w, nil, &tgbotapi.APIResponse{Ok: false, ErrorCode: 400, Description: err.Error()})
+			return
+		}
+		writeTelegram(w, t.capture(method, r.Form, files), nil)
+	}
+}
+
+func readFiles(r *http.Request) (map[string][]byte, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+
+	files := map[string][]byte{}
+	for field, headers := range r.MultipartForm.File {
+		for _, header := range headers {
+			file, err := header.Open()
+			if err != nil {
+				return nil, err
+			}
+			data, err := io.ReadAll(file)
+			_ = file.Close()
+			if err != nil {
+				return nil, err
+			}
+			files[field] = data
+		}
+	}
+	return files, nil
+}
+
+// getUpdates answers a long poll, it fails like Telegram does when another
+// getUpdates call is still waiting.
+func (t *Telegram) getUpdates(r *http.Request) ([]tgbotapi.Update, bool) {
+	params := r.Form
+	offset, _ := strconv.Atoi(params.Get("offset"))
+	limit, _ := strconv.Atoi(params.Get("limit"))
+	timeout, _ := strconv.Atoi(params.Get("timeout"))
+
+	grace := time.After(pollGrace)
+	for {
+		t.mu.Lock()
+		if !t.polling {
+			t.polling = true
+			t.mu.Unlock()
+			break
+		}
+		notify := t.notify
+		t.mu.Unlock()
+
+		select {
+		case <-notify:
+		case <-grace:
+			return nil, false
+		}
+	}
+	defer func() {
+		t.mu.Lock()
+		t.polling = false
+		t.broadcast()
+		t.mu.Unlock()
+	}()
+
+	wait := time.Duration(timeout) * time.Second
+	if wait > maxPollWait {
+		wait = maxPollWait
+	}
+	deadline := time.After(wait)
+
+	for {
+		t.mu.Lock()
+		if offset > t.offset {
+			t.offset = offset
+			t.broadcast()
+		}
+
+		updates := []tgbotapi.Update{}
+		for _, update := range t.updates {
+			if update.UpdateID >= offset && (limit == 0 || len(updates) < limit) {
+				updates = append(updates, update)
+			}
+		}
+		notify := t.notify
+		t.mu.Unlock()
+
+		if len(updates) > 0 {
+			return updates, true
+		}
+
+		select {
+		case <-notify:
+		case <-deadline:
+			return updates, true
+		case <-r.Context().Done():
+			return updates, true
+		}
+	}
+}
+
+func (t *Telegram) capture(method string, params url.Values, files map[string][]byte) interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	sent := Sent{Method: method, Params: params, Files: files}
+
+	switch method {
+	case "sendMessage", "sendPhoto", "sendDocument":
+		t.lastMessageId++
+		sent.MessageId = t.lastMessageId
+	case "editMessageText", "editMessageReplyMarkup":
+		sent.MessageId, _ = strconv.Atoi(params.Get("message_id"))
+	}
+	t.sent = append(t.sent, sent)
+	t.broadcast()
+
+	switch method {
+	case "sendMessage", "sendPhoto", "sendDocument", "editMessageText", "editMessageReplyMarkup":
+		chatId, _ := strconv.ParseInt(params.Get("chat_id"), 10, 64)
+		return tgbotapi.Message{
+			MessageID: sent.MessageId,
+			From:      &t.Bot,
+			Chat:      &tgbotapi.Chat{ID: chatId, Type: "private"},
+			Date:      int(time.Now().Unix()),
+			Text:      params.Get("text"),
+		}
+	default:
+		return true
+	}
+}
+
+func writeTelegram(w http.ResponseWriter, result interface{}, failure *tgbotapi.APIResponse) {
+	resp := failure
+	if resp == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp = &tgbotapi.APIResponse{Ok: true, Result: data}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}